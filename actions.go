@@ -0,0 +1,633 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// Action is what a rule does with the files it matches.
+type Action string
+
+const (
+	ActionMove     Action = "move"     // move into the destination folder (default)
+	ActionCopy     Action = "copy"     // copy into the destination folder, keep the original
+	ActionDelete   Action = "delete"   // remove the file
+	ActionSkip     Action = "skip"     // leave the file alone
+	ActionRename   Action = "rename"   // rename in place using the rule's rename template
+	ActionCompress Action = "compress" // gzip into the destination folder, remove the original
+	ActionExec     Action = "exec"     // run the rule's command template
+	ActionArchive  Action = "archive"  // add to a dated archive in the destination folder, remove the original
+	ActionExtract  Action = "extract"  // unpack into a folder filed by its contents, remove the archive
+)
+
+// Modes for -mode, deciding what a run may do to the files it organizes.
+const (
+	ModeMove     = "move"     // carry out each file's action (default)
+	ModeCopy     = "copy"     // copy instead of moving, leaving the source untouched
+	ModeHardlink = "hardlink" // like copy, but hard link instead of copying
+	ModeReflink  = "reflink"  // like copy, but clone the data copy-on-write
+)
+
+// runMode holds -mode.
+var runMode = ModeMove
+
+// validActions lists the actions accepted in the config.
+var validActions = []Action{ActionMove, ActionCopy, ActionDelete, ActionSkip, ActionRename, ActionCompress, ActionExec, ActionArchive, ActionExtract}
+
+// parseAction validates an action name from the config; "" means move.
+func parseAction(name string) (Action, error) {
+	if name == "" {
+		return ActionMove, nil
+	}
+	for _, a := range validActions {
+		if string(a) == strings.ToLower(name) {
+			return a, nil
+		}
+	}
+	names := make([]string, len(validActions))
+	for i, a := range validActions {
+		names[i] = string(a)
+	}
+	return "", fmt.Errorf("unknown action %q (valid: %s)", name, strings.Join(names, ", "))
+}
+
+// fileAction returns the action that applies to the file: a move into a
+// category with a compress format compresses the file. In the copy,
+// hardlink and reflink modes, moves become copies and actions that change
+// the source in place, or may, as commands do, are skipped. A resumed file
+// keeps its planned action.
+func fileAction(f File) Action {
+	if f.plan != nil {
+		return f.plan.Action
+	}
+	action := ActionMove
+	if f.Rule != nil && f.Rule.action != "" {
+		action = f.Rule.action
+	}
+	if action == ActionMove && compressesOnMove(f) {
+		action = ActionCompress
+	}
+	if runMode != ModeMove {
+		switch action {
+		case ActionMove:
+			return ActionCopy
+		case ActionDelete, ActionRename, ActionExec:
+			return ActionSkip
+		}
+	}
+	return action
+}
+
+// renderName renders a rename template for the file and checks that the
+// result is a plain file name.
+func renderName(tmpl *template.Template, f File) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, f); err != nil {
+		return "", fmt.Errorf("failed to render name: %v", err)
+	}
+	name := strings.TrimSpace(b.String())
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("rendered name %q is not a valid file name", name)
+	}
+	return name, nil
+}
+
+// plannedName returns the file's new name for the rename action: the one
+// journaled for a resumed file, otherwise its rule's template rendered.
+func plannedName(f File) (string, error) {
+	if f.plan != nil && f.plan.Dest == "" {
+		return "", errors.New("no new name was planned")
+	} else if f.plan != nil {
+		return filepath.Base(f.plan.Dest), nil
+	}
+	return renderName(f.Rule.rename, f)
+}
+
+// plannedCommand returns the command the exec action runs for the file and
+// its time limit, as journaled for a resumed file.
+func plannedCommand(f File) (string, time.Duration, error) {
+	if f.plan != nil && f.plan.Command == "" {
+		return "", 0, errors.New("no command was planned")
+	} else if f.plan != nil {
+		return f.plan.Command, f.plan.Timeout, nil
+	}
+	command, err := renderCommand(f.Rule.exec, f)
+	return command, time.Duration(f.Rule.Timeout), err
+}
+
+// executeAction carries out the file's action. rel is the destination
+// directory relative to the organized directory. In dry-run mode the
+// intended action is printed instead.
+func executeAction(file File, rel string, dryRun bool) error {
+	if !dryRun {
+		throttleOp()
+	}
+	srcDir := filepath.Dir(file.Path)
+	destDir := filepath.Join(file.baseDir(), rel)
+	if file.link != nil {
+		// Other hard links to this file wait rather than race over its data.
+		file.link.mu.Lock()
+		defer file.link.mu.Unlock()
+		if file.link.first == "" {
+			file.link.first = file.Path
+		}
+	}
+
+	switch action := fileAction(file); action {
+	case ActionSkip:
+		if dryRun {
+			fmt.Printf("Would skip %q\n", file.Name)
+		}
+		return nil
+
+	case ActionDelete:
+		if dryRun {
+			fmt.Printf("Would delete %q\n", file.Name)
+			return nil
+		}
+		if runJournal.deferring() {
+			runJournal.remove(file.Path, action)
+			return nil
+		}
+		trashed, err := deleteFile(file.Path)
+		if err != nil {
+			return fmt.Errorf("failed to delete file: %v", err)
+		}
+		runJournal.add(journalOp{Action: action, Source: file.Path, Trash: trashed})
+		return nil
+
+	case ActionRename:
+		name, err := plannedName(file)
+		if err != nil {
+			return err
+		}
+		original := ""
+		if sanitizeNames && sanitizeName(name) != name {
+			original, name = name, sanitizeName(name)
+		}
+		target := filepath.Join(srcDir, name)
+		if target != file.Path {
+			if target, err = claimDestination(file, target, dryRun); err != nil || target == "" {
+				return err
+			}
+			name = filepath.Base(target)
+		}
+		if dryRun {
+			fmt.Printf("Would rename %q to %q\n", file.Name, name)
+			return nil
+		}
+		turn, replace, err := land(file, target)
+		if errors.Is(err, errSuperseded) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to replace %s: %v", target, err)
+		}
+		defer turn.release()
+		if replace && target != file.Path {
+			runJournal.add(journalOp{Action: opReplace, Dest: target})
+		}
+		if err := retryStale(func() error { return os.Rename(longPath(file.Path), longPath(target)) }); err != nil {
+			return fmt.Errorf("failed to rename file: %v", err)
+		}
+		runJournal.add(journalOp{Action: action, Source: file.Path, Dest: target, Original: original})
+		turn.landed()
+		return nil
+
+	case ActionExec:
+		command, timeout, err := plannedCommand(file)
+		if err != nil {
+			return err
+		}
+		if file.link != nil {
+			if file.link.ran {
+				fmt.Printf("Skipped %q: the command already ran for %s, a hard link to the same file\n", file.Name, file.link.first)
+				return nil
+			}
+			file.link.ran = true
+		}
+		if dryRun {
+			fmt.Printf("Would run for %q: %s\n", file.Name, command)
+			return nil
+		}
+		output, err := runCommand(command, timeout)
+		runJournal.add(journalOp{Action: action, Source: file.Path})
+		printCommandOutput(file.Name, output)
+		if err != nil {
+			return fmt.Errorf("command %q failed: %v", command, err)
+		}
+		return nil
+
+	case ActionArchive:
+		if remoteDest != nil {
+			return errors.New("the archive action needs a local destination")
+		}
+		if file.symlink || file.unit {
+			return errors.New("only regular files are archived")
+		}
+		rel = existingDir(file.baseDir(), portablePath(rel))
+		destDir = filepath.Join(file.baseDir(), rel)
+		name := archiveName(file)
+		if dryRun {
+			fmt.Printf("Would archive %q into %s\n", file.Name, filepath.Join(rel, name))
+			return nil
+		}
+		unlock, err := lockForMove(file)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := runJournal.mkdirAll(destDir); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		markOutputFolder(file.baseDir(), rel)
+		// Written with the run's other files for the archive, and removed
+		// once it has been checked; see closeArchives.
+		return addToArchive(file, filepath.Join(destDir, name))
+
+	case ActionExtract:
+		if file.symlink || file.unit {
+			return errors.New("only regular files are extracted")
+		}
+		return extractFile(file, dryRun)
+
+	case ActionCopy, ActionCompress, ActionMove:
+		name, err := movedName(file)
+		if err != nil {
+			return err
+		}
+		name = normalizeName(name, normalizeNames)
+		if action == ActionCompress {
+			name += compressedExt(compression(file))
+		}
+		original := "" // journaled when -sanitize-names changes the name
+		if sanitizeNames && sanitizeName(name) != name {
+			original, name = name, sanitizeName(name)
+		}
+		if remoteDest != nil {
+			return uploadFile(file, action, portablePath(rel), name, original, dryRun)
+		}
+		// Reuse a folder that only differs in Unicode normalization, such as
+		// one created on macOS, rather than a second one that looks the same.
+		rel = existingDir(file.baseDir(), portablePath(rel))
+		rel = existingDir(file.baseDir(), portablePath(shardDir(file, rel, name, dryRun)))
+		destDir = filepath.Join(file.baseDir(), rel)
+		if trashDuplicates && action == ActionMove && !file.unit && !file.symlink && isDuplicate(file, filepath.Join(destDir, name)) {
+			return trashDuplicate(file, filepath.Join(destDir, name), dryRun)
+		}
+		destPath, err := claimDestination(file, filepath.Join(destDir, name), dryRun)
+		if err != nil || destPath == "" {
+			return err
+		}
+		name = filepath.Base(destPath)
+		sum := "" // of the original, journaled when compressing
+		// A copy or archive of another link to this file is reused.
+		reuse := file.link != nil && file.link.output != "" && action != ActionMove
+		if file.link != nil && file.link.output == "" && action != ActionMove {
+			file.link.output = destPath
+		}
+		if dryRun {
+			if reuse {
+				fmt.Printf("Would hard link %q to %s, sharing what was made for %s\n", file.Name, filepath.Join(rel, name), file.link.first)
+				return nil
+			}
+			if file.unit {
+				fmt.Printf("Would %s folder %q (%s) to %s\n", action, file.Name, ByteSize(file.Size), filepath.Join(rel, name))
+				return nil
+			}
+			verb := string(action)
+			if action == ActionCopy && runMode == ModeHardlink {
+				verb = "hard link"
+			} else if action == ActionCopy && runMode == ModeReflink {
+				verb = "clone"
+			}
+			fmt.Printf("Would %s %q to %s\n", verb, file.Name, filepath.Join(rel, name))
+			runHooks(file, destPath, true)
+			return nil
+		}
+		unlock, err := lockForMove(file)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := runJournal.mkdirAll(destDir); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		markOutputFolder(file.baseDir(), rel)
+		turn, replace, err := land(file, destPath)
+		if errors.Is(err, errSuperseded) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to replace %s: %v", destPath, err)
+		}
+		defer turn.release()
+		if replace && runJournal.deferring() {
+			// Kept until the run commits, in case it is rolled back.
+			if err := runJournal.setAside(destPath); err != nil {
+				return fmt.Errorf("failed to replace %s: %v", destPath, err)
+			}
+		} else if replace {
+			runJournal.add(journalOp{Action: opReplace, Dest: destPath})
+		}
+		// A large copy over its older version only writes what changed.
+		delta := replace && !runJournal.deferring() && action == ActionCopy && runMode == ModeCopy && !reuse && useDelta(file, destPath)
+		if replace && !runJournal.deferring() && (action != ActionMove || file.symlink) && !delta {
+			// Renames replace files by themselves; the rest need room.
+			if err := os.Remove(longPath(destPath)); err != nil {
+				return fmt.Errorf("failed to replace %s: %v", destPath, err)
+			}
+		}
+		switch {
+		case reuse && os.Link(longPath(file.link.output), longPath(destPath)) == nil:
+			if action == ActionCompress && runMode == ModeMove && runJournal.deferring() {
+				runJournal.remove(file.Path, action)
+			} else if action == ActionCompress && runMode == ModeMove {
+				if err := os.Remove(longPath(file.Path)); err != nil {
+					return fmt.Errorf("failed to remove original after compressing: %v", err)
+				}
+			}
+		case file.symlink && action != ActionCompress:
+			// Relocate the link itself; its target may live anywhere.
+			if err := moveSymlink(file.Path, destPath, action == ActionCopy); err != nil {
+				return fmt.Errorf("failed to %s link: %v", action, err)
+			}
+		case action == ActionCopy && runMode == ModeHardlink:
+			if err := os.Link(longPath(file.Path), longPath(destPath)); err != nil {
+				return fmt.Errorf("failed to link file: %v", err)
+			}
+		case action == ActionCopy && runMode == ModeReflink:
+			if err := cloneFile(file.Path, destPath); err != nil {
+				return fmt.Errorf("failed to clone file: %v", err)
+			}
+		case delta:
+			sent, err := deltaCopy(file.Path, destPath)
+			if err != nil {
+				return fmt.Errorf("failed to delta-copy file: %v", err)
+			}
+			fmt.Printf("🔁 Delta-copied %q: %s of %s was new\n", file.Name, ByteSize(sent), ByteSize(file.Size))
+		case action == ActionCopy:
+			if err := copyFile(file.Path, destPath); err != nil {
+				return fmt.Errorf("failed to copy file: %v", err)
+			}
+		case action == ActionCompress:
+			if sum, err = compressFile(file.Path, destPath, compression(file)); err != nil {
+				return fmt.Errorf("failed to compress file: %v", err)
+			}
+			if runMode != ModeMove {
+				break // The source stays untouched.
+			}
+			if runJournal.deferring() {
+				runJournal.remove(file.Path, action)
+				break
+			}
+			if err := os.Remove(longPath(file.Path)); err != nil {
+				return fmt.Errorf("failed to remove original after compressing: %v", err)
+			}
+		default:
+			err := retryStale(func() error { return os.Rename(longPath(file.Path), longPath(destPath)) })
+			if errors.Is(err, syscall.EXDEV) {
+				// The destination folder is a mount of its own, such as
+				// another network share; a rename can't cross it.
+				if file.unit {
+					return fmt.Errorf("failed to move folder: %s is on another file system", filepath.Dir(destPath))
+				}
+				err = moveAcross(file.Path, destPath)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to move file: %v", err)
+			}
+		}
+		runJournal.add(journalOp{Action: action, Source: file.Path, Dest: destPath, Symlink: file.symlink && action != ActionCompress, Original: original, SHA256: sum})
+		turn.landed()
+		turn.release()
+		unlock() // Hooks may take a while and want the file to themselves.
+		runHooks(file, destPath, false)
+		return nil
+	}
+	return fmt.Errorf("unsupported action %q", fileAction(file))
+}
+
+// moveAcross moves the regular file src to dst on another file system. It
+// copies src to a temporary file next to dst, checks the copy against the
+// original, renames it into place and only then removes src, so a failure
+// at any point leaves src intact and no partial file at dst.
+func moveAcross(src, dst string) (err error) {
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".organizer-tmp")
+	os.Remove(longPath(tmp)) // Left over from an interrupted run.
+	if err := copyFile(src, tmp); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(longPath(tmp))
+		}
+	}()
+	if err := verifyCopy(src, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(longPath(tmp), longPath(dst)); err != nil {
+		return err
+	}
+	if err := os.Remove(longPath(src)); err != nil {
+		return fmt.Errorf("copied to %s but failed to remove the original: %v", dst, err)
+	}
+	return nil
+}
+
+// verifyCopy checks that dst has the same size and contents as src.
+func verifyCopy(src, dst string) error {
+	want, err := hashFile(src)
+	if err != nil {
+		return err
+	}
+	got, err := hashFile(dst)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("copy of %s does not match the original", src)
+	}
+	return nil
+}
+
+// copyFile copies the regular file src to dst, keeping its metadata (see
+// copyMetadata) and, where the platform allows, its holes. A partial copy
+// is removed on failure.
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(longPath(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(longPath(dst), os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(longPath(dst))
+		}
+	}()
+	t := startTransfer(filepath.Base(src), info.Size(), filePos(out))
+	defer t.finish()
+	if err = copyContents(out, in, info.Size()); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	return copyMetadata(src, info, dst)
+}
+
+// compressFile writes a copy of src compressed in the format to dst and
+// returns the SHA-256 of src. gzip records the original name and
+// modification time in its header.
+func compressFile(src, dst, format string) (sum string, err error) {
+	in, err := os.Open(longPath(src))
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.OpenFile(longPath(dst), os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(longPath(dst))
+		}
+	}()
+	var zw io.WriteCloser
+	if format == CompressZstd {
+		if zw, err = newZstdWriter(out); err != nil {
+			return "", err
+		}
+	} else {
+		gw := gzip.NewWriter(out)
+		gw.Name = info.Name()
+		gw.ModTime = info.ModTime()
+		zw = gw
+	}
+	h := sha256.New()
+	t := startTransfer(filepath.Base(src), info.Size(), filePos(in))
+	defer t.finish()
+	if _, err = io.Copy(zw, io.TeeReader(throttle(in), h)); err != nil {
+		zw.Close()
+		return "", err
+	}
+	if err = zw.Close(); err != nil {
+		return "", err
+	}
+	if err = out.Sync(); err != nil {
+		return "", err
+	}
+	// The archive keeps the original's time, so copy mode can recognize it.
+	if err = os.Chtimes(longPath(dst), info.ModTime(), info.ModTime()); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// decompressFile unpacks src, made by compressFile in the format its
+// extension names, to dst, which must not exist, with the original's
+// modification time.
+func decompressFile(src, dst string) (err error) {
+	in, err := os.Open(longPath(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(longPath(dst), os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(longPath(dst))
+		}
+	}()
+	if strings.HasSuffix(src, compressedExt(CompressZstd)) {
+		cmd, err := zstdCommand("-d", "-q", "-c")
+		if err != nil {
+			return err
+		}
+		var stderr strings.Builder
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = in, out, &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("zstd: %v %s", err, strings.TrimSpace(stderr.String()))
+		}
+	} else {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(out, zr); err != nil {
+			return err
+		}
+		if err = zr.Close(); err != nil {
+			return err
+		}
+	}
+	return os.Chtimes(longPath(dst), info.ModTime(), info.ModTime())
+}
+
+// moveSymlink recreates the symbolic link src at dst, rewriting a relative
+// target so the new link points at the same file, and removes src unless
+// keep is set.
+func moveSymlink(src, dst string, keep bool) error {
+	target, err := os.Readlink(longPath(src))
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(target) {
+		abs := filepath.Join(filepath.Dir(src), target)
+		if rel, err := filepath.Rel(filepath.Dir(dst), abs); err == nil {
+			target = rel
+		} else {
+			target = abs
+		}
+	}
+	if err := os.Symlink(target, longPath(dst)); err != nil {
+		return err
+	}
+	if keep {
+		return nil
+	}
+	if err := os.Remove(longPath(src)); err != nil {
+		os.Remove(longPath(dst))
+		return err
+	}
+	return nil
+}
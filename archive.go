@@ -0,0 +1,429 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Formats for the archive action, set with a rule's format.
+const (
+	ArchiveZip    = "zip"     // a zip file, deflated (default)
+	ArchiveTarZst = "tar.zst" // a tar file compressed with the zstd command
+)
+
+// archiveName returns the name of the archive the archive action adds the
+// file to: one per month of modification in the destination folder, such
+// as "2024-05.zip". A resumed file keeps its planned archive.
+func archiveName(f File) string {
+	if f.plan != nil {
+		return filepath.Base(f.plan.Dest)
+	}
+	format := ArchiveZip
+	if f.Rule != nil && f.Rule.Format != "" {
+		format = f.Rule.Format
+	}
+	return f.ModTime.Format("2006-01") + "." + format
+}
+
+// archiveMember is a file added to an archive during the run.
+type archiveMember struct {
+	file File
+	name string   // its name inside the archive
+	sum  [32]byte // SHA-256 of what was read from it
+}
+
+// archiveBuilder writes a new version of an archive next to it: the
+// entries it already had, then the files the run adds. The files are
+// removed only once it has been checked and put in place.
+type archiveBuilder struct {
+	mu      sync.Mutex
+	path    string // the archive
+	tmp     string // where the new version is written
+	existed bool   // whether the archive was there before the run
+	names   map[string]bool
+	members []archiveMember
+	err     error // the first failure; the new version is then dropped
+
+	out *os.File    // the new version
+	zw  *zip.Writer // for zip
+	tw  *tar.Writer // for tar.zst, feeding zst
+	zst *zstdWriter
+}
+
+// archives holds the archives the run is adding to, by path, until
+// closeArchives finishes them.
+var archives = struct {
+	mu   sync.Mutex
+	open map[string]*archiveBuilder
+}{open: map[string]*archiveBuilder{}}
+
+// addToArchive adds the file to the archive at path, which is finished
+// with the rest of the run's files by closeArchives.
+func addToArchive(file File, path string) error {
+	archives.mu.Lock()
+	a := archives.open[path]
+	if a == nil {
+		var err error
+		if a, err = openArchive(path); err != nil {
+			archives.mu.Unlock()
+			return err
+		}
+		archives.open[path] = a
+	}
+	archives.mu.Unlock()
+	return a.add(file)
+}
+
+// openArchive starts the new version of the archive at path, copying in
+// the entries it already has.
+func openArchive(path string) (*archiveBuilder, error) {
+	a := &archiveBuilder{
+		path:  path,
+		tmp:   filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".organizer-tmp"),
+		names: map[string]bool{},
+	}
+	_, err := os.Lstat(longPath(path))
+	a.existed = err == nil
+	os.Remove(longPath(a.tmp)) // Left over from an interrupted run.
+
+	out, err := os.OpenFile(longPath(a.tmp), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	a.out = out
+	if strings.HasSuffix(path, "."+ArchiveTarZst) {
+		if a.zst, err = newZstdWriter(out); err != nil {
+			out.Close()
+			os.Remove(longPath(a.tmp))
+			return nil, err
+		}
+		a.tw = tar.NewWriter(a.zst)
+		if a.existed {
+			err := readTarZst(path, func(hdr *tar.Header, r io.Reader) error {
+				a.names[hdr.Name] = true
+				if err := a.tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+				_, err := io.Copy(a.tw, r)
+				return err
+			})
+			if err != nil {
+				a.err = err
+				a.abandon()
+				return nil, fmt.Errorf("failed to read %s: %v", path, err)
+			}
+		}
+		return a, nil
+	}
+
+	a.zw = zip.NewWriter(out)
+	if a.existed {
+		r, err := zip.OpenReader(longPath(path))
+		if err == nil {
+			for _, f := range r.File {
+				a.names[f.Name] = true
+				if err = a.zw.Copy(f); err != nil {
+					break
+				}
+			}
+			r.Close()
+		}
+		if err != nil {
+			a.err = err
+			a.abandon()
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+	return a, nil
+}
+
+// add writes the file into the archive under its name, or a numbered one
+// if the archive already holds that name.
+func (a *archiveBuilder) add(file File) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return fmt.Errorf("%s could not be written: %v", a.path, a.err)
+	}
+	name := file.Name
+	ext := filepath.Ext(name)
+	for i := 1; a.names[name]; i++ {
+		name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(file.Name, ext), i, ext)
+	}
+
+	in, err := os.Open(longPath(file.Path))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	sum := sha256.New()
+	src := io.TeeReader(throttle(in), sum)
+	var w io.Writer
+	if a.zw != nil {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: info.ModTime()}
+		hdr.SetMode(info.Mode())
+		w, err = a.zw.CreateHeader(hdr)
+	} else {
+		var hdr *tar.Header
+		if hdr, err = tar.FileInfoHeader(info, ""); err == nil {
+			hdr.Name = name
+			err = a.tw.WriteHeader(hdr)
+			w = a.tw
+		}
+	}
+	if err == nil {
+		t := startTransfer(file.Name, info.Size(), filePos(in))
+		_, err = io.Copy(w, src)
+		t.finish()
+	}
+	if err != nil {
+		// Half an entry is in the archive; the new version is no good.
+		a.err = err
+		return fmt.Errorf("failed to add to %s: %v", a.path, err)
+	}
+	a.names[name] = true
+	a.members = append(a.members, archiveMember{file: file, name: name, sum: [32]byte(sum.Sum(nil))})
+	return nil
+}
+
+// abandon stops writing the new version and removes it.
+func (a *archiveBuilder) abandon() {
+	if a.zst != nil {
+		a.zst.Close()
+	}
+	a.out.Close()
+	os.Remove(longPath(a.tmp))
+}
+
+// finish completes the new version, reads each added file back from it to
+// check it against what was read from the file, and puts it in place of
+// the archive.
+func (a *archiveBuilder) finish() error {
+	if a.err != nil {
+		a.abandon()
+		return a.err
+	}
+	var err error
+	if a.zw != nil {
+		err = a.zw.Close()
+	} else if err = a.tw.Close(); err == nil {
+		err = a.zst.Close()
+	}
+	if err == nil {
+		err = a.out.Sync()
+	}
+	if cerr := a.out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = a.check()
+	}
+	if err == nil {
+		err = os.Rename(longPath(a.tmp), longPath(a.path))
+	}
+	if err != nil {
+		os.Remove(longPath(a.tmp))
+	}
+	return err
+}
+
+// check reads the new version back and compares each added file with the
+// checksum taken when it was written.
+func (a *archiveBuilder) check() error {
+	want := make(map[string][32]byte, len(a.members))
+	for _, m := range a.members {
+		want[m.name] = m.sum
+	}
+	verify := func(name string, r io.Reader) error {
+		sum, ok := want[name]
+		if !ok {
+			return nil
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, throttle(r)); err != nil {
+			return fmt.Errorf("failed to read %s back: %v", name, err)
+		}
+		if [32]byte(h.Sum(nil)) != sum {
+			return fmt.Errorf("%s does not match the original once archived", name)
+		}
+		delete(want, name)
+		return nil
+	}
+	var err error
+	if a.zw != nil {
+		var r *zip.ReadCloser
+		if r, err = zip.OpenReader(longPath(a.tmp)); err == nil {
+			for _, f := range r.File {
+				var rc io.ReadCloser
+				if rc, err = f.Open(); err != nil {
+					break
+				}
+				err = verify(f.Name, rc)
+				rc.Close()
+				if err != nil {
+					break
+				}
+			}
+			r.Close()
+		}
+	} else {
+		err = readTarZst(a.tmp, func(hdr *tar.Header, r io.Reader) error {
+			return verify(hdr.Name, r)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	for name := range want {
+		return fmt.Errorf("%s is missing from the archive", name)
+	}
+	return nil
+}
+
+// closeArchives finishes the archives the run added files to. The files
+// in an archive that was written and checked are journaled and, when
+// moving, removed; if anything went wrong with an archive it is left as
+// it was and so are its files.
+func closeArchives() {
+	archives.mu.Lock()
+	open := archives.open
+	archives.open = map[string]*archiveBuilder{}
+	archives.mu.Unlock()
+	paths := make([]string, 0, len(open))
+	for path := range open {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		a := open[path]
+		if err := a.finish(); err != nil {
+			fmt.Printf("❌ Failed to archive %d file(s) into %s, which were left in place: %v\n", len(a.members), path, err)
+			runJournal.fail()
+			continue
+		}
+		if !a.existed {
+			runJournal.add(journalOp{Action: opNewArchive, Dest: path})
+		}
+		for _, m := range a.members {
+			runJournal.add(journalOp{Action: ActionArchive, Source: m.file.Path, Dest: path, Member: m.name})
+			if runMode != ModeMove {
+				continue // The source stays untouched.
+			}
+			if info, err := os.Lstat(longPath(m.file.Path)); err != nil || info.Size() != m.file.Size || !info.ModTime().Equal(m.file.ModTime) {
+				fmt.Printf("⚠️ Kept %q: it changed while being archived\n", m.file.Name)
+				continue
+			}
+			if runJournal.deferring() {
+				runJournal.remove(m.file.Path, ActionArchive)
+			} else if err := retryStale(func() error { return os.Remove(longPath(m.file.Path)) }); err != nil {
+				fmt.Printf("❌ failed to remove %s after archiving: %v\n", m.file.Path, err)
+			}
+		}
+		fmt.Printf("📦 Archived %d file(s) into %s\n", len(a.members), path)
+	}
+}
+
+// readTarZst calls fn for each entry of the tar.zst archive at path.
+func readTarZst(path string, fn func(*tar.Header, io.Reader) error) error {
+	cmd, err := zstdCommand("-d", "-c", "-q", longPath(path))
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	tr := tar.NewReader(out)
+	for {
+		var hdr *tar.Header
+		if hdr, err = tr.Next(); err != nil {
+			break
+		}
+		if err = fn(hdr, tr); err != nil {
+			break
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	io.Copy(io.Discard, out)
+	if werr := cmd.Wait(); err == nil && werr != nil {
+		err = fmt.Errorf("zstd: %v %s", werr, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// extractMember writes the entry called name in the archive at path to
+// dst, with its modification time, through a temporary file next to it.
+func extractMember(path, name, dst string) (err error) {
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".organizer-tmp")
+	write := func(r io.Reader, info os.FileInfo) error {
+		out, err := os.OpenFile(longPath(tmp), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chtimes(longPath(tmp), info.ModTime(), info.ModTime())
+		}
+		return err
+	}
+	found := false
+	if strings.HasSuffix(path, "."+ArchiveTarZst) {
+		err = readTarZst(path, func(hdr *tar.Header, r io.Reader) error {
+			if hdr.Name != name || found {
+				return nil
+			}
+			found = true
+			return write(r, hdr.FileInfo())
+		})
+	} else {
+		var r *zip.ReadCloser
+		if r, err = zip.OpenReader(longPath(path)); err == nil {
+			for _, f := range r.File {
+				if f.Name != name {
+					continue
+				}
+				found = true
+				var rc io.ReadCloser
+				if rc, err = f.Open(); err == nil {
+					err = write(rc, f.FileInfo())
+					rc.Close()
+				}
+				break
+			}
+			r.Close()
+		}
+	}
+	if err == nil && !found {
+		err = fmt.Errorf("%s is not in the archive", name)
+	}
+	if err == nil {
+		err = os.Rename(longPath(tmp), longPath(dst))
+	}
+	if err != nil {
+		os.Remove(longPath(tmp))
+	}
+	return err
+}
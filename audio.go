@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// AudioTags are the tags of a music file, which templates use as
+// {{.Artist}}, {{.Album}} and so on. Tags the file lacks are empty.
+type AudioTags struct {
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Title       string
+	Track       string // the track number, two digits or more: "03"
+	Genre       string
+}
+
+// audioTagsLimit bounds how much of a file's tags is read; cover art can
+// make them large.
+const audioTagsLimit = 16 << 20
+
+// errNoTags is returned for files without tags that can be read.
+var errNoTags = errors.New("no tags")
+
+// audioTags returns the file's tags, read on first use.
+func (f File) audioTags() AudioTags {
+	return readMeta(f, "audio", func(path string) any {
+		if path == "" {
+			return AudioTags{}
+		}
+		tags, _ := readAudioTags(path)
+		return tags
+	}).(AudioTags)
+}
+
+// Artist returns the artist tag of a music file.
+func (f File) Artist() string { return f.audioTags().Artist }
+
+// AlbumArtist returns the album artist tag of a music file, or its artist
+// if it has none, so compilations can be kept together.
+func (f File) AlbumArtist() string {
+	if tags := f.audioTags(); tags.AlbumArtist != "" {
+		return tags.AlbumArtist
+	}
+	return f.Artist()
+}
+
+// Album returns the album tag of a music file.
+func (f File) Album() string { return f.audioTags().Album }
+
+// Title returns the title tag of a music file.
+func (f File) Title() string { return f.audioTags().Title }
+
+// Track returns the track number of a music file, zero-padded to two
+// digits so names sort in order.
+func (f File) Track() string { return f.audioTags().Track }
+
+// Genre returns the genre tag of a music file.
+func (f File) Genre() string { return f.audioTags().Genre }
+
+// readAudioTags reads the tags of the music file at path: ID3v2 or, failing
+// that, ID3v1 tags as in MP3 files, or Vorbis comments in FLAC and Ogg
+// (Vorbis and Opus) files. Tag values are cleaned up for use in names, see
+// metaText.
+func readAudioTags(path string) (AudioTags, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return AudioTags{}, err
+	}
+	defer f.Close()
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil {
+		return AudioTags{}, errNoTags
+	}
+	f.Seek(0, io.SeekStart)
+	var tags AudioTags
+	switch {
+	case string(magic[:3]) == "ID3":
+		tags, err = readID3v2(f)
+	case string(magic[:]) == "fLaC":
+		tags, err = readFLACTags(f)
+	case string(magic[:]) == "OggS":
+		tags, err = readOggTags(f)
+	default:
+		err = errNoTags
+	}
+	if err != nil || tags == (AudioTags{}) {
+		if v1, err1 := readID3v1(f); err1 == nil {
+			tags, err = v1, nil
+		}
+	}
+	if err != nil {
+		return AudioTags{}, err
+	}
+	tags.Artist, tags.AlbumArtist = metaText(tags.Artist), metaText(tags.AlbumArtist)
+	tags.Album, tags.Title, tags.Genre = metaText(tags.Album), metaText(tags.Title), metaText(tags.Genre)
+	tags.Track = trackNumber(tags.Track)
+	return tags, nil
+}
+
+// trackNumber turns a track tag such as "3/12" into "03", or "" if it
+// doesn't start with a number.
+func trackNumber(s string) string {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	if err != nil || n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%02d", n)
+}
+
+// id3Frames maps ID3v2 text frames, as of v2.3 and v2.2, to the tags.
+var id3Frames = map[string]func(*AudioTags) *string{
+	"TPE1": func(t *AudioTags) *string { return &t.Artist },
+	"TP1":  func(t *AudioTags) *string { return &t.Artist },
+	"TPE2": func(t *AudioTags) *string { return &t.AlbumArtist },
+	"TP2":  func(t *AudioTags) *string { return &t.AlbumArtist },
+	"TALB": func(t *AudioTags) *string { return &t.Album },
+	"TAL":  func(t *AudioTags) *string { return &t.Album },
+	"TIT2": func(t *AudioTags) *string { return &t.Title },
+	"TT2":  func(t *AudioTags) *string { return &t.Title },
+	"TRCK": func(t *AudioTags) *string { return &t.Track },
+	"TRK":  func(t *AudioTags) *string { return &t.Track },
+	"TCON": func(t *AudioTags) *string { return &t.Genre },
+	"TCO":  func(t *AudioTags) *string { return &t.Genre },
+}
+
+// readID3v2 reads the ID3v2 tag at the start of r.
+func readID3v2(r io.Reader) (AudioTags, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return AudioTags{}, err
+	}
+	version, flags := header[3], header[5]
+	if version < 2 || version > 4 {
+		return AudioTags{}, fmt.Errorf("unsupported ID3v2.%d tag", version)
+	}
+	size := syncsafe(header[6:10])
+	if size > audioTagsLimit {
+		return AudioTags{}, errors.New("ID3v2 tag too large")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return AudioTags{}, err
+	}
+	if flags&0x80 != 0 && version < 4 {
+		// Unsynchronized: every 0xFF 0x00 stands for 0xFF.
+		data = bytes.ReplaceAll(data, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	if flags&0x40 != 0 && version > 2 && len(data) >= 4 {
+		// Skip the extended header.
+		ext := int(binary.BigEndian.Uint32(data))
+		if version == 4 {
+			ext = syncsafe(data[:4])
+		} else {
+			ext += 4
+		}
+		if ext > len(data) {
+			return AudioTags{}, errors.New("malformed ID3v2 tag")
+		}
+		data = data[ext:]
+	}
+
+	idLen, headLen := 4, 10
+	if version == 2 {
+		idLen, headLen = 3, 6
+	}
+	var tags AudioTags
+	for len(data) >= headLen && data[0] != 0 {
+		id := string(data[:idLen])
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(data[4:8]))
+		default:
+			frameSize = syncsafe(data[4:8])
+		}
+		if frameSize < 0 || headLen+frameSize > len(data) {
+			break
+		}
+		frame := data[headLen : headLen+frameSize]
+		if version == 4 {
+			// Per-frame unsynchronization, and a data length indicator
+			// before the data.
+			format := data[9]
+			if format&0x02 != 0 {
+				frame = bytes.ReplaceAll(frame, []byte{0xFF, 0x00}, []byte{0xFF})
+			}
+			if format&0x01 != 0 && len(frame) >= 4 {
+				frame = frame[4:]
+			}
+		}
+		data = data[headLen+frameSize:]
+		if field, ok := id3Frames[id]; ok && len(frame) > 1 {
+			*field(&tags) = id3Text(frame[0], frame[1:])
+		}
+	}
+	return tags, nil
+}
+
+// syncsafe decodes a 28-bit ID3v2 syncsafe integer.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+// id3Text decodes the text of an ID3v2 text frame in the encoding: 0 for
+// ISO-8859-1, 1 for UTF-16 with a byte order mark, 2 for UTF-16BE and 3
+// for UTF-8. Of several values, the first is returned.
+func id3Text(encoding byte, b []byte) string {
+	switch encoding {
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == 1 && len(b) >= 2 {
+			if b[0] == 0xFF && b[1] == 0xFE {
+				order = binary.LittleEndian
+			}
+			if b[0] == 0xFF && b[1] == 0xFE || b[0] == 0xFE && b[1] == 0xFF {
+				b = b[2:]
+			}
+		}
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u := order.Uint16(b[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		text, _, _ := strings.Cut(string(b), "\x00")
+		return text
+	}
+	return latin1(b)
+}
+
+// latin1 decodes ISO-8859-1 text up to the first NUL.
+func latin1(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// readID3v1 reads the ID3v1 tag in the last 128 bytes of f.
+func readID3v1(f *os.File) (AudioTags, error) {
+	var tag [128]byte
+	info, err := f.Stat()
+	if err != nil || info.Size() < int64(len(tag)) {
+		return AudioTags{}, errNoTags
+	}
+	if _, err := f.ReadAt(tag[:], info.Size()-int64(len(tag))); err != nil || string(tag[:3]) != "TAG" {
+		return AudioTags{}, errNoTags
+	}
+	field := func(b []byte) string { return strings.TrimRight(latin1(b), " ") }
+	tags := AudioTags{Title: field(tag[3:33]), Artist: field(tag[33:63]), Album: field(tag[63:93])}
+	if tag[125] == 0 && tag[126] != 0 {
+		tags.Track = strconv.Itoa(int(tag[126])) // ID3v1.1
+	}
+	return tags, nil
+}
+
+// readFLACTags reads the Vorbis comments among the metadata blocks of a
+// FLAC stream.
+func readFLACTags(r io.Reader) (AudioTags, error) {
+	br := bufio.NewReader(r)
+	if _, err := br.Discard(4); err != nil {
+		return AudioTags{}, err
+	}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return AudioTags{}, err
+		}
+		last, typ := header[0]&0x80 != 0, header[0]&0x7F
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if typ == 4 {
+			block := make([]byte, size)
+			if _, err := io.ReadFull(br, block); err != nil {
+				return AudioTags{}, err
+			}
+			return vorbisComments(block)
+		}
+		if last {
+			return AudioTags{}, errNoTags
+		}
+		if _, err := br.Discard(size); err != nil {
+			return AudioTags{}, err
+		}
+	}
+}
+
+// readOggTags reads the Vorbis comments in the second packet of an Ogg
+// Vorbis or Opus stream.
+func readOggTags(r io.Reader) (AudioTags, error) {
+	br := bufio.NewReader(io.LimitReader(r, audioTagsLimit))
+	var packets [][]byte
+	var packet []byte
+	for len(packets) < 2 {
+		var header [27]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return AudioTags{}, err
+		}
+		if string(header[:4]) != "OggS" {
+			return AudioTags{}, errors.New("malformed Ogg page")
+		}
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(br, lacing); err != nil {
+			return AudioTags{}, err
+		}
+		for _, n := range lacing {
+			segment := make([]byte, n)
+			if _, err := io.ReadFull(br, segment); err != nil {
+				return AudioTags{}, err
+			}
+			packet = append(packet, segment...)
+			if n < 255 {
+				packets, packet = append(packets, packet), nil
+			}
+		}
+	}
+	comments := packets[1]
+	switch {
+	case bytes.HasPrefix(comments, []byte("\x03vorbis")):
+		return vorbisComments(comments[7:])
+	case bytes.HasPrefix(comments, []byte("OpusTags")):
+		return vorbisComments(comments[8:])
+	}
+	return AudioTags{}, errNoTags
+}
+
+// vorbisComments reads the tags from a Vorbis comment block: a vendor
+// string, then a count of "NAME=value" comments, each with a little-endian
+// length.
+func vorbisComments(b []byte) (AudioTags, error) {
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+	if _, ok := next(); !ok { // The vendor.
+		return AudioTags{}, errors.New("malformed Vorbis comments")
+	}
+	if len(b) < 4 {
+		return AudioTags{}, errors.New("malformed Vorbis comments")
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	var tags AudioTags
+	for i := uint32(0); i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		name, value, _ := strings.Cut(comment, "=")
+		var field *string
+		switch strings.ToUpper(name) {
+		case "ARTIST":
+			field = &tags.Artist
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			field = &tags.AlbumArtist
+		case "ALBUM":
+			field = &tags.Album
+		case "TITLE":
+			field = &tags.Title
+		case "TRACKNUMBER":
+			field = &tags.Track
+		case "GENRE":
+			field = &tags.Genre
+		default:
+			continue
+		}
+		if *field == "" {
+			*field = value
+		}
+	}
+	return tags, nil
+}
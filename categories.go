@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// CategoryMap maps category names to extensions. Nested categories are
+// stored under slash-separated names such as "Docs/Spreadsheets".
+//
+// In YAML a category is either a list of extensions or a mapping whose
+// "extensions" key lists its own extensions and whose other keys are
+// sub-categories:
+//
+//	categories:
+//	  Docs:
+//	    extensions: [.pdf, .txt]
+//	    Spreadsheets: [.xlsx, .csv]
+//	    Presentations: [.pptx]
+type CategoryMap map[string][]string
+
+// UnmarshalYAML implements yamlUnmarshaler, flattening nested categories.
+func (c *CategoryMap) UnmarshalYAML(node any) error {
+	m, ok := node.(map[string]any)
+	if !ok {
+		return fmt.Errorf("expected a mapping of categories")
+	}
+	if *c == nil {
+		*c = CategoryMap{}
+	}
+	return c.add("", m)
+}
+
+// add flattens the categories in m under the parent category prefix.
+func (c CategoryMap) add(prefix string, m map[string]any) error {
+	for name, child := range m {
+		if strings.Contains(name, "/") {
+			return fmt.Errorf("category %q: use nesting instead of / in names", name)
+		}
+		full := name
+		if prefix != "" {
+			full = prefix + "/" + name
+		}
+		sub, nested := child.(map[string]any)
+		if !nested {
+			var exts []string
+			if err := decodeYAMLValue(child, reflectValueOf(&exts), full); err != nil {
+				return err
+			}
+			c[full] = exts
+			continue
+		}
+		var exts []string
+		if own, ok := sub["extensions"]; ok {
+			if err := decodeYAMLValue(own, reflectValueOf(&exts), full+".extensions"); err != nil {
+				return err
+			}
+		}
+		c[full] = exts
+		rest := make(map[string]any, len(sub))
+		for k, v := range sub {
+			if k != "extensions" {
+				rest[k] = v
+			}
+		}
+		if err := c.add(full, rest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// categoryOrder returns the category names in the order they are checked
+// for an extension: deeper sub-categories first, so "Docs/Spreadsheets"
+// wins over "Docs", then alphabetically.
+func categoryOrder(categories map[string][]string) []string {
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		di, dj := strings.Count(names[i], "/"), strings.Count(names[j], "/")
+		if di != dj {
+			return di > dj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// isSubCategory reports whether child is nested somewhere below parent.
+func isSubCategory(child, parent string) bool {
+	return strings.HasPrefix(child, parent+"/")
+}
+
+// builtinCategories is the compiled-in category map, used whenever the
+// config does not define its own categories.
+var builtinCategories = Categories
+
+// Aliases maps alternative category names to their canonical category,
+// e.g. "Pictures" -> "Images". It is set from the config file.
+var Aliases map[string]string
+
+// canonicalCategory resolves name through Aliases. Chains are followed, and
+// a cycle stops at the last name before it repeats.
+func canonicalCategory(name string) string {
+	seen := map[string]bool{name: true}
+	for {
+		next, ok := Aliases[name]
+		if !ok || seen[next] {
+			return name
+		}
+		seen[next] = true
+		name = next
+	}
+}
+
+// categoryFolder returns the folder name to use for category inside dir:
+// the category itself, unless only a folder named after one of its aliases
+// already exists there, in which case that folder is reused.
+func categoryFolder(dir, category string) string {
+	if len(Aliases) == 0 || isDir(filepath.Join(dir, category)) {
+		return category
+	}
+	var aliases []string
+	for alias := range Aliases {
+		if canonicalCategory(alias) == category {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if isDir(filepath.Join(dir, alias)) {
+			return alias
+		}
+	}
+	return category
+}
+
+// isDir reports whether path exists and is a directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// resolveCategories returns categories with the extend lists added and the
+// extensions of alias-named categories folded into their canonical ones.
+func resolveCategories(categories map[string][]string, extend CategoryMap) map[string][]string {
+	resolved := make(map[string][]string, len(categories))
+	for name, exts := range categories {
+		canonical := canonicalCategory(name)
+		resolved[canonical] = mergeExts(resolved[canonical], exts)
+	}
+	for name, exts := range extend {
+		canonical := canonicalCategory(name)
+		resolved[canonical] = mergeExts(resolved[canonical], exts)
+	}
+	return resolved
+}
+
+// mergeExts returns the union of two extension lists, keeping a's order
+// and appending b's new entries.
+func mergeExts(a, b []string) []string {
+	merged := append([]string{}, a...)
+	for _, ext := range b {
+		if !slices.Contains(merged, ext) {
+			merged = append(merged, ext)
+		}
+	}
+	return merged
+}
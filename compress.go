@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Formats for the compress action, set per category in the config's
+// compress section.
+const (
+	CompressGzip = "gzip" // .gz, the default
+	CompressZstd = "zstd" // .zst, with the zstd command
+)
+
+// CompressCategories holds the config's compress section: per category,
+// the format the files moved into it are compressed with.
+var CompressCategories map[string]string
+
+// categoryCompression returns the format the category compresses the files
+// moved into it with, or "" if it doesn't.
+func categoryCompression(category string) string {
+	if format := CompressCategories[category]; format != "" {
+		return format
+	}
+	return CompressCategories[canonicalCategory(category)]
+}
+
+// compressesOnMove reports whether the file, moved by its rule, is
+// compressed instead because of its category. Files that are compressed
+// already, links, folders moved as units and files sent to a remote
+// destination are moved as they are.
+func compressesOnMove(f File) bool {
+	if f.unit || f.symlink || remoteDest != nil || f.Extension == ".gz" || f.Extension == ".zst" {
+		return false
+	}
+	return categoryCompression(f.Category) != ""
+}
+
+// compression returns the format the compress action uses for the file:
+// its category's, or gzip. A resumed file keeps its planned format.
+func compression(f File) string {
+	if f.plan != nil {
+		if strings.HasSuffix(f.plan.Dest, compressedExt(CompressZstd)) {
+			return CompressZstd
+		}
+		return CompressGzip
+	}
+	if format := categoryCompression(f.Category); format != "" {
+		return format
+	}
+	return CompressGzip
+}
+
+// compressedExt returns the extension added to the names of files
+// compressed in the format.
+func compressedExt(format string) string {
+	if format == CompressZstd {
+		return ".zst"
+	}
+	return ".gz"
+}
+
+// checkCompression validates a format from the config.
+func checkCompression(format string) error {
+	switch format {
+	case CompressGzip, CompressZstd:
+		return nil
+	}
+	return fmt.Errorf("unknown compression %q (valid: %s, %s)", format, CompressGzip, CompressZstd)
+}
+
+// zstdCommand returns the zstd command with the arguments, or an error if
+// it isn't installed.
+func zstdCommand(args ...string) (*exec.Cmd, error) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		return nil, errors.New("zstd compression needs the zstd command")
+	}
+	return exec.Command("zstd", args...), nil
+}
+
+// zstdWriter compresses what is written to it with the zstd command.
+type zstdWriter struct {
+	stdin  io.WriteCloser
+	cmd    *exec.Cmd
+	stderr strings.Builder
+}
+
+// newZstdWriter starts zstd writing the compressed data to w.
+func newZstdWriter(w io.Writer) (*zstdWriter, error) {
+	cmd, err := zstdCommand("-q", "-c")
+	if err != nil {
+		return nil, err
+	}
+	z := &zstdWriter{cmd: cmd}
+	cmd.Stdout, cmd.Stderr = w, &z.stderr
+	if z.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	n, err := z.stdin.Write(p)
+	if err != nil {
+		z.cmd.Wait()
+		return n, z.failure(err)
+	}
+	return n, nil
+}
+
+// Close ends the input and waits for zstd to finish writing.
+func (z *zstdWriter) Close() error {
+	z.stdin.Close()
+	if err := z.cmd.Wait(); err != nil {
+		return z.failure(err)
+	}
+	return nil
+}
+
+// failure describes why zstd failed, in its own words when it gave some.
+func (z *zstdWriter) failure(err error) error {
+	if msg := strings.TrimSpace(z.stderr.String()); msg != "" {
+		return fmt.Errorf("zstd: %s", msg)
+	}
+	return fmt.Errorf("zstd: %v", err)
+}
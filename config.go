@@ -0,0 +1,442 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Config holds the user-editable settings read from the config file.
+type Config struct {
+	Categories  CategoryMap        `yaml:"categories"`  // category name -> extensions
+	Rules       []Rule             `yaml:"rules"`       // evaluated in order before Categories
+	Destination string             `yaml:"destination"` // destination template, e.g. "{{.Category}}/{{.ModTime.Year}}"
+	Replace     bool               `yaml:"replace"`     // .organizerrc only: ignore the global config
+	Options     map[string]string  `yaml:"options"`     // flag defaults, e.g. dry-run: true
+	Exclude     []string           `yaml:"exclude"`     // gitignore-style patterns never touched
+	Include     []string           `yaml:"include"`     // presets layered underneath this config
+	Profiles    map[string]*Config `yaml:"profiles"`    // named overrides selected with -profile
+	Aliases     map[string]string  `yaml:"aliases"`     // alias -> canonical category, e.g. Pictures: Images
+	Extend      CategoryMap        `yaml:"extend"`      // extensions added to inherited categories
+	Names       map[string]string  `yaml:"names"`       // category -> template renaming files moved into it
+	Hooks       map[string][]Hook  `yaml:"hooks"`       // category -> commands run after files are moved into it
+	Compress    map[string]string  `yaml:"compress"`    // category -> format files moved into it are compressed with: gzip or zstd
+	Shard       map[string]string  `yaml:"shard"`       // category -> scheme its folders are split by when too big: letter, year or month
+	Validators  []Validator        `yaml:"validators"`  // checks that can veto a file's move
+	Geocoder    *Geocoder          `yaml:"geocoder"`    // turns photos' GPS coordinates into .Location
+
+	ExtensionGroups [][]string `yaml:"extension_groups"` // equivalent extensions, e.g. [jpg, jpeg]
+
+	Source  string `yaml:"-"` // file the config was loaded from, "" for none
+	Profile string `yaml:"-"` // name of the selected profile, "" for none
+
+	dest     *template.Template            // compiled Destination
+	names    map[string]*template.Template // compiled Names
+	excludes *IgnoreList                   // compiled Exclude
+}
+
+// localConfigName is the per-directory override file looked up in the
+// directory being organized.
+const localConfigName = ".organizerrc"
+
+// ignoreFileName is the per-directory gitignore-style exclude file.
+const ignoreFileName = ".organizerignore"
+
+// configDirName is the directory under the user config directory that
+// holds the config file.
+const configDirName = "go-file-organizer"
+
+// configSearchPaths returns the locations searched for the config file, in
+// order: $XDG_CONFIG_HOME/go-file-organizer/ and then
+// ~/.config/go-file-organizer/, each as config.yaml or config.yml.
+func configSearchPaths() []string {
+	var dirs []string
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" && filepath.IsAbs(xdg) {
+		dirs = append(dirs, filepath.Join(xdg, configDirName))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dir := filepath.Join(home, ".config", configDirName)
+		if len(dirs) == 0 || dirs[0] != dir {
+			dirs = append(dirs, dir)
+		}
+	}
+	var paths []string
+	for _, dir := range dirs {
+		paths = append(paths, filepath.Join(dir, "config.yaml"), filepath.Join(dir, "config.yml"))
+	}
+	return paths
+}
+
+// defaultConfigPath returns where a new config file should be written: the
+// first search location, or "" if no location can be determined.
+func defaultConfigPath() string {
+	paths := configSearchPaths()
+	if len(paths) == 0 {
+		return ""
+	}
+	return paths[0]
+}
+
+// findConfig returns the first existing config file in the search path, or
+// "" if there is none.
+func findConfig() string {
+	for _, path := range configSearchPaths() {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig reads and parses the YAML config file at path.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+// parseConfig parses YAML config data and compiles its rules and templates.
+func parseConfig(data []byte) (*Config, error) {
+	cfg, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return compileConfig(cfg)
+}
+
+// compileConfig compiles the rules, templates, excludes and profiles of a
+// decoded config and layers its includes underneath it.
+func compileConfig(cfg *Config) (*Config, error) {
+	if err := compileRules(cfg.Rules); err != nil {
+		return nil, err
+	}
+	if cfg.Destination != "" {
+		tmpl, err := parseDestination(cfg.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination: %v", err)
+		}
+		cfg.dest = tmpl
+	}
+	for category, text := range cfg.Names {
+		tmpl, err := parseDestination(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid names template for %s: %v", category, err)
+		}
+		if cfg.names == nil {
+			cfg.names = map[string]*template.Template{}
+		}
+		cfg.names[category] = tmpl
+	}
+	for category, format := range cfg.Compress {
+		if err := checkCompression(format); err != nil {
+			return nil, fmt.Errorf("compress for %s: %v", category, err)
+		}
+	}
+	for category, scheme := range cfg.Shard {
+		if err := checkShard(scheme); err != nil {
+			return nil, fmt.Errorf("shard for %s: %v", category, err)
+		}
+	}
+	if err := compileHooks(cfg.Hooks); err != nil {
+		return nil, err
+	}
+	if err := compileValidators(cfg.Validators); err != nil {
+		return nil, err
+	}
+	if cfg.Geocoder != nil {
+		if err := cfg.Geocoder.compile(); err != nil {
+			return nil, err
+		}
+	}
+	excludes, err := parseIgnorePatterns(cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	cfg.excludes = excludes
+	for name, profile := range cfg.Profiles {
+		if len(profile.Profiles) > 0 {
+			return nil, fmt.Errorf("profile %s: profiles cannot be nested", name)
+		}
+		compiled, err := compileConfig(profile)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", name, err)
+		}
+		cfg.Profiles[name] = compiled
+	}
+	if len(cfg.Include) > 0 {
+		base, err := loadPresets(cfg.Include)
+		if err != nil {
+			return nil, err
+		}
+		cfg = base.layer(cfg)
+	}
+	return cfg, nil
+}
+
+// decodeConfig parses YAML config data and normalizes its extensions
+// without compiling anything.
+func decodeConfig(data []byte) (*Config, error) {
+	tree, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := decodeYAML(tree, &cfg); err != nil {
+		return nil, err
+	}
+	cfg.normalize()
+	return &cfg, nil
+}
+
+// normalize normalizes the category extensions of cfg and its profiles.
+func (cfg *Config) normalize() {
+	for category, exts := range cfg.Categories {
+		for i, ext := range exts {
+			exts[i] = normalizeExt(ext)
+		}
+		cfg.Categories[category] = exts
+	}
+	for category, exts := range cfg.Extend {
+		for i, ext := range exts {
+			exts[i] = normalizeExt(ext)
+		}
+		cfg.Extend[category] = exts
+	}
+	for _, group := range cfg.ExtensionGroups {
+		for i, ext := range group {
+			group[i] = normalizeExt(ext)
+		}
+	}
+	for name, profile := range cfg.Profiles {
+		if profile == nil {
+			profile = &Config{}
+			cfg.Profiles[name] = profile
+		}
+		profile.normalize()
+	}
+}
+
+// selectProfile returns cfg with the named profile layered on top of it.
+func (cfg *Config) selectProfile(name string) (*Config, error) {
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(cfg.Profiles))
+		for n := range cfg.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown profile %q: the config defines no profiles", name)
+		}
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	merged := cfg.layer(profile)
+	merged.Profile = name
+	return merged, nil
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// isWithin reports whether path is dir itself or somewhere below it. Both
+// must be absolute and clean.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// normalizeExt lower-cases ext and makes sure it starts with a dot, so
+// "PDF", "pdf" and ".pdf" in a config file all mean the same thing.
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// merge layers an .organizerrc on top of cfg. With replace: true the local
+// file is used alone; otherwise see layer.
+func (cfg *Config) merge(local *Config) *Config {
+	if local.Replace {
+		return local
+	}
+	return cfg.layer(local)
+}
+
+// layer returns top applied over cfg: top's rules and validators are
+// checked before cfg's, its categories, aliases, names, hooks, compress
+// formats, shard schemes and options replace same-named ones, its extend
+// lists are added to cfg's, its destination and geocoder win, and its
+// excludes are applied after cfg's.
+func (cfg *Config) layer(top *Config) *Config {
+	merged := &Config{
+		Categories:      make(CategoryMap, len(cfg.Categories)+len(top.Categories)),
+		Aliases:         make(map[string]string, len(cfg.Aliases)+len(top.Aliases)),
+		Extend:          make(CategoryMap, len(cfg.Extend)+len(top.Extend)),
+		Names:           make(map[string]string, len(cfg.Names)+len(top.Names)),
+		Hooks:           make(map[string][]Hook, len(cfg.Hooks)+len(top.Hooks)),
+		Compress:        make(map[string]string, len(cfg.Compress)+len(top.Compress)),
+		Shard:           make(map[string]string, len(cfg.Shard)+len(top.Shard)),
+		Validators:      append(append([]Validator{}, top.Validators...), cfg.Validators...),
+		Rules:           append(append([]Rule{}, top.Rules...), cfg.Rules...),
+		Destination:     cfg.Destination,
+		Replace:         top.Replace,
+		Options:         make(map[string]string, len(cfg.Options)+len(top.Options)),
+		Exclude:         append(append([]string{}, cfg.Exclude...), top.Exclude...),
+		ExtensionGroups: append(append([][]string{}, cfg.ExtensionGroups...), top.ExtensionGroups...),
+		Include:         append(append([]string{}, cfg.Include...), top.Include...),
+		Profiles:        cfg.Profiles,
+		Geocoder:        cfg.Geocoder,
+		Source:          cfg.Source,
+		Profile:         cfg.Profile,
+		dest:            cfg.dest,
+		names:           make(map[string]*template.Template, len(cfg.names)+len(top.names)),
+		excludes:        cfg.excludes.merge(top.excludes),
+	}
+	orderRules(merged.Rules)
+	if top.Geocoder != nil {
+		merged.Geocoder = top.Geocoder
+	}
+	for category, exts := range cfg.Categories {
+		merged.Categories[category] = exts
+	}
+	for category, exts := range top.Categories {
+		merged.Categories[category] = exts
+	}
+	for alias, category := range cfg.Aliases {
+		merged.Aliases[alias] = category
+	}
+	for alias, category := range top.Aliases {
+		merged.Aliases[alias] = category
+	}
+	for _, layer := range []*Config{cfg, top} {
+		for category, text := range layer.Names {
+			merged.Names[category], merged.names[category] = text, layer.names[category]
+		}
+		for category, hooks := range layer.Hooks {
+			merged.Hooks[category] = hooks
+		}
+		for category, format := range layer.Compress {
+			merged.Compress[category] = format
+		}
+		for category, scheme := range layer.Shard {
+			merged.Shard[category] = scheme
+		}
+	}
+	for _, extend := range []CategoryMap{cfg.Extend, top.Extend} {
+		for category, exts := range extend {
+			merged.Extend[category] = mergeExts(merged.Extend[category], exts)
+		}
+	}
+	for name, value := range cfg.Options {
+		merged.Options[name] = value
+	}
+	for name, value := range top.Options {
+		merged.Options[name] = value
+	}
+	if top.dest != nil {
+		merged.Destination, merged.dest = top.Destination, top.dest
+	}
+	if top.Profiles != nil {
+		merged.Profiles = top.Profiles
+	}
+	if top.Source != "" {
+		merged.Source, merged.Profile = top.Source, top.Profile
+	}
+	return merged
+}
+
+// loadGlobalConfig loads the config file at path, with the rules learned
+// by "organizer review" underneath it. When path is empty the search path
+// is used, and finding no config yields an empty one. The returned
+// config's Source records the file that was loaded.
+func loadGlobalConfig(path string) (*Config, error) {
+	learned, err := loadLearnedRules()
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = findConfig()
+		if path == "" {
+			return learned, nil
+		}
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config %s: %v", path, err)
+	}
+	cfg.Source = path
+	return learned.layer(cfg), nil
+}
+
+// prepareConfig layers the comma-separated presets underneath cfg and then
+// installs it for dir with setupConfig.
+func prepareConfig(cfg *Config, presets, dir string) error {
+	if presets != "" {
+		base, err := loadPresets(strings.Split(presets, ","))
+		if err != nil {
+			return err
+		}
+		cfg = base.layer(cfg)
+	}
+	return setupConfig(cfg, dir)
+}
+
+// setupConfig merges any .organizerrc in dir into the global config, then
+// installs the resulting rules, destination and name templates, excludes (plus those
+// in dir's .organizerignore), and categories in place of the built-ins.
+func setupConfig(cfg *Config, dir string) error {
+	localPath := filepath.Join(dir, localConfigName)
+	local, err := loadConfig(localPath)
+	switch {
+	case err == nil:
+		cfg = cfg.merge(local)
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("failed to load %s: %v", localPath, err)
+	}
+
+	ignorePath := filepath.Join(dir, ignoreFileName)
+	ignores, err := loadIgnoreFile(ignorePath)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %v", ignorePath, err)
+	}
+
+	// Everything has loaded; install it in one go so a failed (re)load
+	// leaves the previous settings untouched.
+	categories := builtinCategories
+	if len(cfg.Categories) > 0 {
+		categories = cfg.Categories
+	}
+	Aliases = cfg.Aliases
+	extCanonical = extensionGroups(builtinExtensionGroups, cfg.ExtensionGroups)
+	Categories = resolveCategories(categories, cfg.Extend)
+	Rules = cfg.Rules
+	Destination = defaultDestinationTemplate
+	if cfg.dest != nil {
+		Destination = cfg.dest
+	}
+	NameTemplates = cfg.names
+	Hooks = cfg.Hooks
+	CompressCategories = cfg.Compress
+	ShardCategories = cfg.Shard
+	Validators = cfg.Validators
+	activeGeocoder = cfg.Geocoder
+	Exclude = cfg.excludes.merge(ignores)
+	return nil
+}
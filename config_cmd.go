@@ -0,0 +1,422 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runConfigCommand implements "organizer config <subcommand>" and returns
+// the process exit code.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer config <init|validate|schema> [-config path]")
+		return 2
+	}
+	switch args[0] {
+	case "init":
+		return runConfigInit(args[1:])
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "schema":
+		return runConfigSchema(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown config subcommand %q\n", args[0])
+		return 2
+	}
+}
+
+// runConfigInit writes a commented starter config built from the built-in
+// Categories map.
+func runConfigInit(args []string) int {
+	fs := flag.NewFlagSet("config init", flag.ExitOnError)
+	configPath := fs.String("config", "", "Where to write the config (default $XDG_CONFIG_HOME or ~/.config/go-file-organizer/config.yaml)")
+	force := fs.Bool("force", false, "Overwrite an existing config file")
+	fs.Parse(args)
+	path := *configPath
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	if path == "" {
+		fmt.Println("❌ cannot determine the config location; pass -config")
+		return 1
+	}
+
+	if !*force {
+		if _, err := os.Stat(path); err == nil {
+			fmt.Printf("❌ %s already exists (use -force to overwrite)\n", path)
+			return 1
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Printf("❌ failed to create directory: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(path, []byte(starterConfig()), 0644); err != nil {
+		fmt.Printf("❌ failed to write config: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Wrote %s\n", path)
+	return 0
+}
+
+// starterConfig renders the built-in categories as a commented YAML config.
+func starterConfig() string {
+	var b strings.Builder
+	b.WriteString(`# go-file-organizer configuration.
+# Edit the categories below, or add rules and a destination template.
+
+# Destination folder for each file, relative to the organized directory.
+# Templates see .Name, .Extension, .Size, .ModTime and .Category.
+# destination: "{{.Category}}/{{.ModTime.Year}}"
+
+# Templates renaming the files moved into a category; slug lower-cases a
+# name and replaces spaces and punctuation with hyphens.
+# names:
+#   Images: '{{.ModTime.Format "2006-01-02"}}_{{.Name}}'
+#   Docs: '{{slug .Name}}'
+
+# Categories whose files are compressed as they are moved in: gzip or zstd.
+# compress:
+#   Logs: zstd
+
+# Categories whose folders are split into subfolders once they hold more
+# than -shard-limit entries: by first letter, year or month.
+# shard:
+#   Images: month
+
+# Commands run after files are moved into a category. Templates see the
+# file's fields as before the move plus .Dest and .DestDir, where it is now.
+# hooks:
+#   Docs:
+#     - exec: 'tesseract {{quote .Dest}} {{quote .Dest}}'
+#       timeout: 5m
+
+# Checks run before files are moved, copied or compressed; any of them can
+# veto a file, which then stays put and is listed in the skip report.
+# validators:
+#   - name: clamav
+#     exec: 'clamscan --no-summary {{quote .Path}}'
+#   - name: no keys
+#     secrets: ['-----BEGIN [A-Z ]*PRIVATE KEY-----']
+#   - name: space
+#     min_free: 1GB
+
+# Rules are checked in order before the extension categories. A rule
+# matches when all of its conditions (glob, regex, extensions, min_size,
+# max_size, older_than, newer_than) match.
+# rules:
+#   - name: invoices
+#     glob: "invoice-*.pdf"
+#     category: Finance
+#   - name: large
+#     min_size: 1GB
+#     category: Large
+#   - name: clips
+#     max_duration: 2m  # also min_duration, min_resolution: 4K, max_resolution, codec: [hevc]
+#     category: Videos
+#     destination: Videos/Clips
+#   - name: receipts
+#     pdf: {creator: "*scansnap*"}  # also title, author, subject, keywords, producer
+#     category: Receipts
+#   - name: acme
+#     office: {company: "acme*", created: "2024-*"}  # docx, xlsx and pptx properties
+#     category: Clients
+
+# Categories map folder names to file extensions.
+categories:
+`)
+	names := make([]string, 0, len(Categories))
+	for name := range Categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s: [%s]\n", name, strings.Join(Categories[name], ", "))
+	}
+	return b.String()
+}
+
+// runConfigSchema prints, or writes with -o, the JSON Schema of the config
+// file format.
+func runConfigSchema(args []string) int {
+	fs := flag.NewFlagSet("config schema", flag.ExitOnError)
+	output := fs.String("o", "", "Write the schema to this file instead of stdout")
+	fs.Parse(args)
+	data, err := configSchemaJSON()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Printf("❌ failed to write schema: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Wrote %s\n", *output)
+	return 0
+}
+
+// runConfigValidate parses the config file and reports every problem found.
+func runConfigValidate(args []string) int {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(envName("config")), "Path to the config file to validate (default: the first one found in the search path)")
+	fs.Parse(args)
+	path := *configPath
+	if path == "" && fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+	if path == "" {
+		path = findConfig()
+	}
+	if path == "" {
+		fmt.Printf("❌ no config file found in %s\n", strings.Join(configSearchPaths(), ", "))
+		return 1
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	problems := validateConfig(data)
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Printf("❌ %s\n", p)
+		}
+		fmt.Printf("%s: %d problem(s) found\n", path, len(problems))
+		return 1
+	}
+	fmt.Printf("✅ %s is valid\n", path)
+	return 0
+}
+
+// validateConfig checks config data and returns a description of every
+// problem found, rather than stopping at the first one like loadConfig.
+func validateConfig(data []byte) []string {
+	cfg, err := decodeConfig(data)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	problems := validateDecoded(cfg)
+
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		profile := cfg.Profiles[name]
+		if len(profile.Profiles) > 0 {
+			problems = append(problems, fmt.Sprintf("profile %s: profiles cannot be nested", name))
+		}
+		for _, p := range validateDecoded(profile) {
+			problems = append(problems, fmt.Sprintf("profile %s: %s", name, p))
+		}
+	}
+	return problems
+}
+
+// validateDecoded checks a single decoded config, ignoring its profiles.
+func validateDecoded(cfg *Config) []string {
+	var problems []string
+
+	// Duplicate extensions are almost always a mistake, except when a
+	// sub-category deliberately claims an extension from its parent.
+	owners := map[string][]string{}
+	for _, category := range categoryOrder(cfg.Categories) {
+		for _, ext := range cfg.Categories[category] {
+			owners[ext] = append(owners[ext], category)
+		}
+	}
+	var exts []string
+	for ext, categories := range owners {
+		for _, other := range categories[1:] {
+			if !isSubCategory(categories[0], other) {
+				exts = append(exts, ext)
+				break
+			}
+		}
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		categories := owners[ext]
+		problems = append(problems, fmt.Sprintf("extension %q is claimed by multiple categories: %s (%s wins)", ext, strings.Join(categories, ", "), categories[0]))
+	}
+
+	// Rules: compile errors, bad templates, and rules shadowed by earlier ones.
+	orderRules(cfg.Rules)
+	sample := sampleFile()
+	valid := make([]bool, len(cfg.Rules))
+	for i := range cfg.Rules {
+		r := &cfg.Rules[i]
+		if err := r.compile(); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		valid[i] = true
+		if r.dest != nil {
+			if err := r.dest.Execute(io.Discard, sample); err != nil {
+				problems = append(problems, fmt.Sprintf("rule %s: invalid destination: %v", r.label(), err))
+			}
+		}
+		if r.exec != nil {
+			if _, err := renderCommand(r.exec, sample); err != nil {
+				problems = append(problems, fmt.Sprintf("rule %s: invalid exec template: %v", r.label(), err))
+			}
+		}
+		if r.rename != nil {
+			if _, err := renderName(r.rename, sample); err != nil {
+				problems = append(problems, fmt.Sprintf("rule %s: invalid rename template: %v", r.label(), err))
+			}
+		}
+		for j := 0; j < i; j++ {
+			if valid[j] && cfg.Rules[j].covers(r) {
+				problems = append(problems, fmt.Sprintf("rule %s is unreachable: rule %s always matches first", r.label(), cfg.Rules[j].label()))
+				break
+			}
+		}
+	}
+
+	aliases := make([]string, 0, len(cfg.Aliases))
+	for alias := range cfg.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		chain := []string{alias}
+		for name := cfg.Aliases[alias]; ; name = cfg.Aliases[name] {
+			if slices.Contains(chain, name) {
+				problems = append(problems, fmt.Sprintf("alias %s forms a cycle: %s -> %s", alias, strings.Join(chain, " -> "), name))
+				break
+			}
+			chain = append(chain, name)
+			if _, ok := cfg.Aliases[name]; !ok {
+				break
+			}
+		}
+	}
+
+	problems = append(problems, validateExtensionGroups(cfg.ExtensionGroups)...)
+
+	for _, name := range cfg.Include {
+		if _, ok := Presets[name]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown preset %q (available: %s)", name, strings.Join(presetNames(), ", ")))
+		}
+	}
+
+	for _, pattern := range cfg.Exclude {
+		if _, err := parseIgnorePatterns([]string{pattern}); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if cfg.Destination != "" {
+		tmpl, err := parseDestination(cfg.Destination)
+		if err == nil {
+			err = tmpl.Execute(io.Discard, sample)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid destination: %v", err))
+		}
+	}
+
+	for i := range cfg.Validators {
+		v := &cfg.Validators[i]
+		if err := v.compile(); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if v.exec != nil {
+			if _, err := renderCommand(v.exec, sample); err != nil {
+				problems = append(problems, fmt.Sprintf("validator %s: invalid exec template: %v", v.label(), err))
+			}
+		}
+	}
+
+	hookCategories := make([]string, 0, len(cfg.Hooks))
+	for category := range cfg.Hooks {
+		hookCategories = append(hookCategories, category)
+	}
+	sort.Strings(hookCategories)
+	for _, category := range hookCategories {
+		for i, h := range cfg.Hooks[category] {
+			if h.Exec == "" {
+				problems = append(problems, fmt.Sprintf("hook %d for %s: exec is required", i+1, category))
+				continue
+			}
+			tmpl, err := parseDestination(h.Exec)
+			if err == nil {
+				_, err = renderCommand(tmpl, hookData{File: sample, Dest: sample.Path, DestDir: filepath.Dir(sample.Path)})
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("hook %d for %s: invalid exec template: %v", i+1, category, err))
+			}
+		}
+	}
+
+	categories := make([]string, 0, len(cfg.Names))
+	for category := range cfg.Names {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		tmpl, err := parseDestination(cfg.Names[category])
+		if err == nil {
+			_, err = renderName(tmpl, sample)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid names template for %s: %v", category, err))
+		}
+	}
+
+	compressed := make([]string, 0, len(cfg.Compress))
+	for category := range cfg.Compress {
+		compressed = append(compressed, category)
+	}
+	sort.Strings(compressed)
+	for _, category := range compressed {
+		if err := checkCompression(cfg.Compress[category]); err != nil {
+			problems = append(problems, fmt.Sprintf("compress for %s: %v", category, err))
+		}
+	}
+
+	sharded := make([]string, 0, len(cfg.Shard))
+	for category := range cfg.Shard {
+		sharded = append(sharded, category)
+	}
+	sort.Strings(sharded)
+	for _, category := range sharded {
+		if err := checkShard(cfg.Shard[category]); err != nil {
+			problems = append(problems, fmt.Sprintf("shard for %s: %v", category, err))
+		}
+	}
+
+	if cfg.Geocoder != nil {
+		if err := cfg.Geocoder.compile(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// sampleFile returns a representative File for test-rendering templates.
+func sampleFile() File {
+	return File{
+		Name:      "example.pdf",
+		Path:      filepath.Join(os.TempDir(), "example.pdf"),
+		Size:      1024,
+		ModTime:   time.Now(),
+		Category:  "Docs",
+		Extension: ".pdf",
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// validateProblem checks that validating the config reports exactly one
+// problem, containing want.
+func validateProblem(t *testing.T, config, want string) {
+	t.Helper()
+	problems := validateConfig([]byte(config))
+	if len(problems) != 1 || !strings.Contains(problems[0], want) {
+		t.Fatalf("validating %q: got problems %q, want one containing %q", config, problems, want)
+	}
+}
+
+func TestValidateConfigCompression(t *testing.T) {
+	validateProblem(t, "compress:\n  Logs: brotli\n", `compress for Logs: unknown compression "brotli"`)
+	validateProblem(t, "profiles:\n  work:\n    compress:\n      Logs: brotli\n", `profile work: compress for Logs`)
+	if problems := validateConfig([]byte("compress:\n  Logs: zstd\n")); len(problems) != 0 {
+		t.Fatalf("valid compression reported: %q", problems)
+	}
+}
+
+func TestValidateConfigShard(t *testing.T) {
+	validateProblem(t, "shard:\n  Images: weekly\n", `shard for Images: unknown shard scheme "weekly"`)
+	if problems := validateConfig([]byte("shard:\n  Images: month\n")); len(problems) != 0 {
+		t.Fatalf("valid shard scheme reported: %q", problems)
+	}
+}
+
+func TestValidateConfigGeocoder(t *testing.T) {
+	validateProblem(t, "geocoder:\n  timeout: 1m\n", "geocoder: set either geonames or command")
+	validateProblem(t, "profiles:\n  trips:\n    geocoder:\n      timeout: 1m\n", "profile trips: geocoder:")
+}
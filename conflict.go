@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Strategies for -on-conflict, deciding what happens when a file's
+// destination already exists.
+const (
+	ConflictSkip      = "skip"        // leave the file where it is
+	ConflictOverwrite = "overwrite"   // replace the existing file
+	ConflictRename    = "rename"      // pick a free name, see -conflict-suffix (default)
+	ConflictNewerWins = "newer-wins"  // replace it only if the incoming file is newer
+	ConflictAsk       = "ask"         // prompt for each conflict
+	ConflictHash      = "hash-suffix" // add a short content hash: "report-1a2b3c4d.pdf"
+)
+
+// Suffixes for -conflict-suffix, used by ConflictRename.
+const (
+	SuffixCounter   = "counter"   // "report (1).pdf", "report (2).pdf", ...
+	SuffixTimestamp = "timestamp" // "report 2024-05-01 093000.pdf", from the file's mtime
+)
+
+// onConflict and conflictSuffix hold -on-conflict and -conflict-suffix.
+var (
+	onConflict     = ConflictRename
+	conflictSuffix = SuffixCounter
+)
+
+// claims records the destinations taken during a run, so two files with
+// the same name arriving at once don't both find the path free. Dry runs
+// claim too, so their renames match what a real run would do.
+var (
+	claimsMu sync.Mutex               // also serializes -on-conflict ask prompts
+	claims   = map[string]time.Time{} // path -> mtime of the file headed there
+)
+
+// resetClaims forgets the destinations claimed by an earlier run.
+func resetClaims() {
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	claims = map[string]time.Time{}
+	landings = map[string]*landing{}
+	claimants = map[[2]string]int{}
+}
+
+// landing lines up the files of a run put at the same destination, which
+// -on-conflict overwrite and newer-wins allow, so they arrive one at a
+// time. Each claim of the path supersedes the ones before it: a file whose
+// claim was superseded by one already in place is skipped rather than put
+// over it, so the last claimant ends up there whatever order they arrive.
+type landing struct {
+	mu     sync.Mutex // held while a file is put there
+	claims int        // claims of the path so far
+	landed int        // the claim in place, 0 for none
+}
+
+// landings and claimants are guarded by claimsMu.
+var (
+	landings  = map[string]*landing{} // destination -> its landing
+	claimants = map[[2]string]int{}   // destination, source -> claim number
+)
+
+// errSuperseded is returned by land for a file whose destination holds a
+// file of the run that claimed it later.
+var errSuperseded = errors.New("superseded by a later claim")
+
+// claim claims path for the file. claimsMu must be held.
+func claim(file File, path string) string {
+	claims[path] = file.ModTime
+	l := landings[path]
+	if l == nil {
+		l = &landing{}
+		landings[path] = l
+	}
+	l.claims++
+	claimants[[2]string{path, file.Path}] = l.claims
+	return path
+}
+
+// landingTurn is a file's turn at its destination, from land.
+type landingTurn struct {
+	l     *landing
+	claim int
+}
+
+// land waits until no other file of the run is being put at destPath,
+// which the file has claimed, and reports whether a file is there that it
+// replaces. The turn must be released once the file is in place, or has
+// failed to get there. If a file that claimed destPath later is already
+// there, the file is reported as skipped and errSuperseded returned.
+// Folders are never replaced.
+func land(file File, destPath string) (landingTurn, bool, error) {
+	claimsMu.Lock()
+	l := landings[destPath]
+	if l == nil {
+		l = &landing{}
+		landings[destPath] = l
+	}
+	turn := landingTurn{l: l, claim: claimants[[2]string{destPath, file.Path}]}
+	claimsMu.Unlock()
+
+	l.mu.Lock()
+	if l.landed > turn.claim {
+		l.mu.Unlock()
+		fmt.Printf("⚠️ Skipped %q: %s already holds a file of this run that replaces it\n", file.Name, destPath)
+		return landingTurn{}, false, errSuperseded
+	}
+	info, err := os.Lstat(longPath(destPath))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return turn, false, nil
+	case err != nil:
+		l.mu.Unlock()
+		return landingTurn{}, false, err
+	case info.IsDir() && !file.unit:
+		l.mu.Unlock()
+		return landingTurn{}, false, fmt.Errorf("%s already exists; folders are never overwritten", destPath)
+	}
+	return turn, true, nil
+}
+
+// landed records that the file is in place.
+func (t *landingTurn) landed() {
+	if t.l != nil {
+		t.l.landed = t.claim
+	}
+}
+
+// release ends the turn, letting the next file at the destination go.
+func (t *landingTurn) release() {
+	if t.l != nil {
+		t.l.mu.Unlock()
+		t.l = nil
+	}
+}
+
+// claimDestination decides where the file goes when destPath is taken,
+// following -on-conflict, and claims it. A path claimed by another file of
+// the run is taken even if that file isn't there yet; land puts them there
+// one at a time. An empty path means the file stays where it is, which has
+// been reported.
+func claimDestination(file File, destPath string, dryRun bool) (string, error) {
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	info, err := os.Lstat(longPath(destPath))
+	exists := err == nil
+	claimed, isClaimed := claims[destPath]
+	if !exists && !isClaimed {
+		return claim(file, destPath), nil
+	}
+	if exists && !isClaimed && runMode != ModeMove && sameCopy(file, info, fileAction(file) == ActionCompress) {
+		// Copied by an earlier run; mirrors are refreshed, not duplicated.
+		if dryRun {
+			fmt.Printf("Would skip %q: %s is already a copy\n", file.Name, destPath)
+		}
+		return "", nil
+	}
+	existing := claimed
+	if exists && (!isClaimed || info.ModTime().After(claimed)) {
+		existing = info.ModTime()
+	}
+
+	strategy := onConflict
+	if strategy == ConflictAsk {
+		if dryRun {
+			fmt.Printf("Would ask what to do with %q: %s already exists\n", file.Name, destPath)
+			return "", nil
+		}
+		strategy = askConflict(file, destPath, info, exists, claimed)
+	}
+	reason := "already exists"
+	if strategy == ConflictNewerWins {
+		strategy = ConflictSkip
+		reason = "already exists and is not older"
+		if file.ModTime.After(existing) {
+			strategy = ConflictOverwrite
+		}
+	}
+
+	switch strategy {
+	case ConflictOverwrite:
+		if file.unit || (exists && info.IsDir()) {
+			return "", fmt.Errorf("%s already exists; folders are never overwritten", destPath)
+		}
+		return claim(file, destPath), nil
+	case ConflictRename:
+		return claim(file, freeName(destPath, file)), nil
+	case ConflictHash:
+		return hashedName(file, destPath, dryRun)
+	}
+	fmt.Printf("⚠️ Skipped %q: %s %s\n", file.Name, destPath, reason)
+	return "", nil
+}
+
+// sameCopy reports whether the existing info looks like a copy of the file,
+// or with compressed its archive: a regular file with the same modification
+// time and, unless compressed, size. In hardlink mode it must be the file.
+// Times are compared to within two seconds, the resolution of FAT file
+// systems used on backup drives.
+func sameCopy(file File, info os.FileInfo, compressed bool) bool {
+	if runMode == ModeHardlink && !compressed {
+		src, err := os.Lstat(longPath(file.Path))
+		return err == nil && os.SameFile(src, info)
+	}
+	diff := file.ModTime.Sub(info.ModTime())
+	if !info.Mode().IsRegular() || file.symlink || diff >= 2*time.Second || diff <= -2*time.Second {
+		return false
+	}
+	return compressed || info.Size() == file.Size
+}
+
+// freeName returns a name next to destPath that is neither on disk nor
+// claimed, by adding a counter or the file's modification time before the
+// extension. claimsMu must be held.
+func freeName(destPath string, file File) string {
+	taken := func(p string) bool {
+		_, err := os.Lstat(longPath(p))
+		_, isClaimed := claims[p]
+		return isClaimed || !errors.Is(err, fs.ErrNotExist)
+	}
+	dir, base := filepath.Split(destPath)
+	ext := filepath.Ext(base)
+	if file.unit {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+	if conflictSuffix == SuffixTimestamp {
+		stem += " " + file.ModTime.Format("2006-01-02 150405")
+		if p := filepath.Join(dir, stem+ext); !taken(p) {
+			return p
+		}
+	}
+	for i := 1; ; i++ {
+		if p := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext)); !taken(p) {
+			return p
+		}
+	}
+}
+
+// hashedName returns destPath with a short hash of the file's contents
+// added to the name, so identical files get identical names. If that name
+// is already taken by the same contents, or claimed by a file of this run
+// with the same hash, the file is a duplicate and stays where it is.
+// Folders get a free name as with rename. claimsMu must be held.
+func hashedName(file File, destPath string, dryRun bool) (string, error) {
+	if file.IsDir || file.symlink {
+		return claim(file, freeName(destPath, file)), nil
+	}
+	sum, err := hashFile(file.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file: %v", err)
+	}
+	dir, base := filepath.Split(destPath)
+	ext := filepath.Ext(base)
+	hashed := filepath.Join(dir, strings.TrimSuffix(base, ext)+"-"+sum[:8]+ext)
+	_, isClaimed := claims[hashed]
+	info, err := os.Lstat(longPath(hashed))
+	if isClaimed || (err == nil && info.Size() == file.Size && fileAction(file) != ActionCompress && verifyCopy(file.Path, hashed) == nil) {
+		if dryRun {
+			fmt.Printf("Would skip %q: %s has the same contents\n", file.Name, hashed)
+		} else {
+			fmt.Printf("⚠️ Skipped %q: %s has the same contents\n", file.Name, hashed)
+		}
+		return "", nil
+	}
+	if err == nil {
+		// Taken by something else after all.
+		hashed = freeName(hashed, file)
+	}
+	return claim(file, hashed), nil
+}
+
+// stdin reads answers to prompts.
+var stdin = bufio.NewReader(os.Stdin)
+
+// askConflict shows the file and what is at destPath side by side, by
+// size, modification time and content hash, and asks what to do about it.
+// info describes destPath if exists is set; otherwise another file of the
+// run modified at claimed is headed there. It returns the chosen strategy.
+// Without an answer, such as at the end of input, the file is skipped.
+func askConflict(file File, destPath string, info os.FileInfo, exists bool, claimed time.Time) string {
+	incoming := [3]string{ByteSize(file.Size).String(), file.ModTime.Format(time.DateTime), conflictHash(file.Path, file.IsDir)}
+	existing := [3]string{"", claimed.Format(time.DateTime), "(arriving in this run)"}
+	if exists {
+		existing = [3]string{ByteSize(info.Size()).String(), info.ModTime().Format(time.DateTime), conflictHash(destPath, info.IsDir())}
+	}
+	if info != nil && info.IsDir() {
+		existing[0] = "folder"
+	}
+	if file.IsDir {
+		incoming[0] = "folder"
+	}
+	fmt.Printf("❓ %s already exists:\n", destPath)
+	fmt.Printf("   %-10s %-24s %s\n", "", "incoming", "existing")
+	for i, label := range []string{"size", "modified", "sha256"} {
+		fmt.Printf("   %-10s %-24s %s\n", label, incoming[i], existing[i])
+	}
+	if exists && incoming[2] != "" && incoming[2] == existing[2] {
+		fmt.Println("   The contents are identical.")
+	}
+	for {
+		fmt.Print("   Keep the [n]ewer, keep [b]oth, [s]kip or [o]verwrite? ")
+		line, err := stdin.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "s", "skip":
+			return ConflictSkip
+		case "o", "overwrite":
+			return ConflictOverwrite
+		case "b", "both", "r", "rename":
+			return ConflictRename
+		case "n", "newer":
+			return ConflictNewerWins
+		}
+		if err != nil {
+			fmt.Println()
+			return ConflictSkip
+		}
+	}
+}
+
+// conflictHash returns the start of the SHA-256 of the file at path for
+// askConflict, "" for folders, or why it could not be read.
+func conflictHash(path string, isDir bool) string {
+	if isDir {
+		return ""
+	}
+	sum, err := hashFile(path)
+	if err != nil {
+		return "(unreadable)"
+	}
+	return sum[:16]
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewerWinsClaimedDestination(t *testing.T) {
+	defer func(strategy string) { onConflict = strategy }(onConflict)
+	onConflict = ConflictNewerWins
+	resetClaims()
+	defer resetClaims()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "report.pdf")
+	now := time.Now()
+	older := File{Name: "report.pdf", Path: filepath.Join(dir, "a", "report.pdf"), ModTime: now.Add(-time.Hour)}
+	newer := File{Name: "report.pdf", Path: filepath.Join(dir, "b", "report.pdf"), ModTime: now}
+
+	for _, f := range []File{older, newer} {
+		if got, err := claimDestination(f, dest, false); err != nil || got != dest {
+			t.Fatalf("claiming %s: got %q, %v; want %q", f.Path, got, err, dest)
+		}
+	}
+
+	// The newer file gets there first and replaces nothing.
+	turn, replace, err := land(newer, dest)
+	if err != nil || replace {
+		t.Fatalf("landing the newer file: replace %v, %v", replace, err)
+	}
+	if err := os.WriteFile(dest, []byte("newer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	turn.landed()
+	turn.release()
+
+	// The older one, arriving after it, must not go over it.
+	if _, _, err := land(older, dest); !errors.Is(err, errSuperseded) {
+		t.Fatalf("landing the older file after the newer one: got %v, want errSuperseded", err)
+	}
+}
+
+func TestOverwriteClaimedDestinationReplaces(t *testing.T) {
+	defer func(strategy string) { onConflict = strategy }(onConflict)
+	onConflict = ConflictOverwrite
+	resetClaims()
+	defer resetClaims()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "report.pdf")
+	first := File{Name: "report.pdf", Path: filepath.Join(dir, "a", "report.pdf"), ModTime: time.Now()}
+	second := File{Name: "report.pdf", Path: filepath.Join(dir, "b", "report.pdf"), ModTime: time.Now()}
+	for _, f := range []File{first, second} {
+		if got, err := claimDestination(f, dest, false); err != nil || got != dest {
+			t.Fatalf("claiming %s: got %q, %v; want %q", f.Path, got, err, dest)
+		}
+	}
+
+	turn, replace, err := land(first, dest)
+	if err != nil || replace {
+		t.Fatalf("landing the first file: replace %v, %v", replace, err)
+	}
+	if err := os.WriteFile(dest, []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	turn.landed()
+	turn.release()
+
+	// The second file replaces the first, so the replacement is journaled.
+	turn, replace, err = land(second, dest)
+	if err != nil || !replace {
+		t.Fatalf("landing the second file: replace %v, %v; want a replacement", replace, err)
+	}
+	turn.release()
+}
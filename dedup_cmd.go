@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runDedup implements "organizer dedup": it finds the files in a directory
+// tree with identical contents and keeps one of each, the oldest, turning
+// the others into hard links to it, or with -symlink symbolic links, and
+// reports the space reclaimed. The replacements are journaled, so undo
+// turns the links back into copies.
+func runDedup(args []string) int {
+	fs := flag.NewFlagSet("dedup", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(envName("config")), "Path to a YAML config file")
+	preset := fs.String("preset", os.Getenv(envName("preset")), "Comma-separated built-in presets to use under the config")
+	profile := fs.String("profile", os.Getenv(envName("profile")), "Named profile from the config file to use")
+	symlink := fs.Bool("symlink", false, "Replace duplicates with symbolic links instead of hard links, e.g. across file systems")
+	dryRun := fs.Bool("dry-run", false, "Show which duplicates would be replaced without replacing them")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer dedup [-config path] [-profile name] [-preset name] [-symlink] [-dry-run] [dir]")
+		return 2
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = expandHome(fs.Arg(0))
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	cfg, err := loadGlobalConfig(*configPath)
+	if err == nil && *profile != "" {
+		cfg, err = cfg.selectProfile(*profile)
+	}
+	if err == nil {
+		err = prepareConfig(cfg, *preset, dir)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	if !*dryRun {
+		release, err := lockDirs([]string{dir})
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		defer release()
+		runJournal = newJournal([]string{dir}, false)
+		defer func() {
+			runJournal.finish()
+			runJournal = nil
+		}()
+	}
+	groups, err := findDuplicates(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	kind := "hard link"
+	if *symlink {
+		kind = "symbolic link"
+	}
+	replaced, failed := 0, 0
+	var reclaimed int64
+	for _, group := range groups {
+		keep := group[0]
+		for _, dup := range group[1:] {
+			rel, _ := filepath.Rel(dir, dup.Path)
+			keepRel, _ := filepath.Rel(dir, keep.Path)
+			if *dryRun {
+				fmt.Printf("Would make %s a %s to %s\n", rel, kind, keepRel)
+			} else if err := linkDuplicate(keep, dup, *symlink); err != nil {
+				runJournal.outcome(dup, err)
+				fmt.Printf("❌ %s: %v\n", rel, err)
+				failed++
+				continue
+			} else {
+				runJournal.outcome(dup, nil)
+				fmt.Printf("🔗 %s is now a %s to %s\n", rel, kind, keepRel)
+			}
+			replaced++
+			reclaimed += dup.Size
+		}
+	}
+	switch {
+	case replaced == 0 && failed == 0:
+		fmt.Printf("No duplicates in %s\n", dir)
+	case *dryRun:
+		fmt.Printf("Would replace %d duplicate(s) of %d file(s) with %ss, reclaiming %s\n", replaced, len(groups), kind, ByteSize(reclaimed))
+	default:
+		fmt.Printf("Replaced %d duplicate(s) of %d file(s) with %ss, reclaiming %s\n", replaced, len(groups), kind, ByteSize(reclaimed))
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// findDuplicates returns the groups of regular files below dir with the
+// same contents, each oldest first. Hidden and excluded files, empty ones
+// and further hard links to a file already seen are left out.
+func findDuplicates(dir string) ([][]File, error) {
+	bySize := map[int64][]File{}
+	seen := map[[2]uint64]bool{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			fmt.Printf("⚠️ Skipping %s: %v\n", path, err)
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") || Exclude.Excluded(filepath.ToSlash(rel), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			fmt.Printf("⚠️ Skipping %s: %v\n", path, err)
+			return nil
+		}
+		file := newFile(path, info)
+		if file.Size == 0 {
+			return nil
+		}
+		if file.linked {
+			if seen[file.linkID] {
+				return nil // Shares its data with one already seen.
+			}
+			seen[file.linkID] = true
+		}
+		bySize[file.Size] = append(bySize[file.Size], file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]File
+	for _, files := range bySize {
+		if len(files) < 2 {
+			continue
+		}
+		byHash := map[string][]File{}
+		for _, file := range files {
+			sum, err := hashFile(file.Path)
+			if err != nil {
+				fmt.Printf("⚠️ Skipping %s: %v\n", file.Path, err)
+				continue
+			}
+			byHash[sum] = append(byHash[sum], file)
+		}
+		for _, group := range byHash {
+			if len(group) < 2 {
+				continue
+			}
+			sort.Slice(group, func(a, b int) bool {
+				if !group[a].ModTime.Equal(group[b].ModTime) {
+					return group[a].ModTime.Before(group[b].ModTime)
+				}
+				return group[a].Path < group[b].Path
+			})
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(a, b int) bool { return groups[a][0].Path < groups[b][0].Path })
+	return groups, nil
+}
+
+// linkDuplicate replaces dup with a link to keep, once it has checked again
+// that the two are identical. The link is made under a temporary name and
+// renamed over dup, so dup is never missing.
+func linkDuplicate(keep, dup File, symlink bool) error {
+	throttleOp()
+	unlock, err := lockForMove(dup)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := verifyCopy(keep.Path, dup.Path); err != nil {
+		return fmt.Errorf("no longer identical to %s: %v", keep.Path, err)
+	}
+	tmp := filepath.Join(filepath.Dir(dup.Path), "."+dup.Name+".organizer-tmp")
+	if symlink {
+		target, err := filepath.Rel(filepath.Dir(dup.Path), keep.Path)
+		if err != nil {
+			target = keep.Path
+		}
+		err = os.Symlink(target, longPath(tmp))
+	} else {
+		err = os.Link(longPath(keep.Path), longPath(tmp))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link: %v", err)
+	}
+	if err := os.Rename(longPath(tmp), longPath(dup.Path)); err != nil {
+		os.Remove(longPath(tmp))
+		return fmt.Errorf("failed to replace: %v", err)
+	}
+	runJournal.add(journalOp{Action: opLink, Source: keep.Path, Dest: dup.Path, Symlink: symlink})
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// deltaMinSize is the size from which a copy replacing an older version of
+// the file at its destination is delta-copied rather than written in full.
+const deltaMinSize = 64 << 20
+
+// deltaSignature describes the blocks of the old version: for each weak
+// rolling checksum the blocks that have it, and each block's strong sum.
+type deltaSignature struct {
+	blockSize int
+	weak      map[uint32][]int
+	strong    [][16]byte
+}
+
+// useDelta reports whether the file replacing what is at destPath is worth
+// delta-copying. It isn't on a network file system: reading the old
+// version to find its blocks would move as many bytes over the wire as
+// writing the new one in full.
+func useDelta(file File, destPath string) bool {
+	if file.Size < deltaMinSize || file.symlink || file.unit {
+		return false
+	}
+	info, err := os.Lstat(longPath(destPath))
+	if err != nil || !info.Mode().IsRegular() || info.Size() < int64(deltaBlockSize(file.Size)) {
+		return false
+	}
+	_, network := networkFS(destPath)
+	return !network
+}
+
+// deltaBlockSize returns the block size for a file of the given size: its
+// square root, as rsync picks, within 8 KiB and 1 MiB.
+func deltaBlockSize(size int64) int {
+	bs := int(math.Sqrt(float64(size))) &^ 1023
+	return min(max(bs, 8<<10), 1<<20)
+}
+
+// weakSum returns rsync's rolling checksum of b as its two halves.
+func weakSum(b []byte) (a, s uint32) {
+	for i, c := range b {
+		a += uint32(c)
+		s += uint32(len(b)-i) * uint32(c)
+	}
+	return a & 0xffff, s & 0xffff
+}
+
+// strongSum returns the truncated SHA-256 that confirms a weak match.
+func strongSum(b []byte) [16]byte {
+	sum := sha256.Sum256(b)
+	return [16]byte(sum[:16])
+}
+
+// signDelta reads the full blocks of f.
+func signDelta(f *os.File, blockSize int) (*deltaSignature, error) {
+	sig := &deltaSignature{blockSize: blockSize, weak: map[uint32][]int{}}
+	r := bufio.NewReaderSize(throttle(f), 1<<20)
+	block := make([]byte, blockSize)
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, block); errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return sig, nil
+		} else if err != nil {
+			return nil, err
+		}
+		a, s := weakSum(block)
+		sig.weak[a|s<<16] = append(sig.weak[a|s<<16], i)
+		sig.strong = append(sig.strong, strongSum(block))
+	}
+}
+
+// deltaCopy replaces dst, an older version of src, with a copy of src the
+// way rsync does: dst's blocks are signed, and src is scanned with a window
+// rolled a byte at a time, so unchanged data is found even where bytes were
+// inserted or removed before it. Matching runs are copied from the old
+// version and only the rest from src. The copy is built next to dst, so
+// copying from the old version stays on the destination, as a shared
+// extent on Btrfs and XFS. It then replaces dst. It returns how many bytes
+// were taken from src. useDelta keeps it off network file systems.
+func deltaCopy(src, dst string) (literal int64, err error) {
+	in, err := os.Open(longPath(src))
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	old, err := os.Open(longPath(dst))
+	if err != nil {
+		return 0, err
+	}
+	defer old.Close()
+	sig, err := signDelta(old, deltaBlockSize(info.Size()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %v", dst, err)
+	}
+
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".organizer-tmp")
+	os.Remove(longPath(tmp)) // Left over from an interrupted run.
+	out, err := os.OpenFile(longPath(tmp), os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if out != nil {
+			out.Close()
+		}
+		if err != nil {
+			os.Remove(longPath(tmp))
+		}
+	}()
+	t := startTransfer(filepath.Base(src), info.Size(), filePos(out))
+	defer t.finish()
+	if literal, err = sig.apply(out, old, in); err != nil {
+		return 0, err
+	}
+	if err = out.Sync(); err != nil {
+		return 0, err
+	}
+	err = out.Close()
+	out = nil
+	if err != nil {
+		return 0, err
+	}
+	if built, err := os.Stat(longPath(tmp)); err != nil {
+		return 0, err
+	} else if built.Size() != info.Size() {
+		return 0, fmt.Errorf("delta copy came out %s rather than %s", ByteSize(built.Size()), ByteSize(info.Size()))
+	}
+	if err = copyMetadata(src, info, tmp); err != nil {
+		return 0, err
+	}
+	return literal, os.Rename(longPath(tmp), longPath(dst))
+}
+
+// apply writes the new version read from in to out, copying the blocks it
+// shares with the signed old version from old. It returns how many bytes
+// were taken from in.
+func (sig *deltaSignature) apply(out, old *os.File, in io.Reader) (literal int64, err error) {
+	bs := sig.blockSize
+	r := bufio.NewReaderSize(throttle(in), 1<<20)
+	w := bufio.NewWriterSize(out, 1<<20)
+	// A pending run of matched old blocks, copied in one go.
+	var runOff, runLen int64
+	flushRun := func() error {
+		if runLen == 0 {
+			return nil
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if _, err := old.Seek(runOff, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.Copy(out, io.LimitReader(old, runLen))
+		runLen = 0
+		return err
+	}
+	writeLiteral := func(b []byte) error {
+		if err := flushRun(); err != nil {
+			return err
+		}
+		literal += int64(len(b))
+		_, err := w.Write(b)
+		return err
+	}
+
+	// The window is a ring over the last bs bytes read; head is its start.
+	ring, window := make([]byte, bs), make([]byte, bs)
+	head := 0
+	fill := func() (bool, error) {
+		n, err := io.ReadFull(r, ring)
+		head = 0
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, writeLiteral(ring[:n]) // Too short to match.
+		}
+		return err == nil, err
+	}
+	full, err := fill()
+	a, s := weakSum(ring)
+	for full && err == nil {
+		if blocks, ok := sig.weak[a|s<<16]; ok {
+			copy(window, ring[head:])
+			copy(window[bs-head:], ring[:head])
+			sum, match := strongSum(window), -1
+			for _, i := range blocks {
+				if sig.strong[i] == sum {
+					match = i
+					break
+				}
+			}
+			if match >= 0 {
+				if off := int64(match) * int64(bs); runLen > 0 && runOff+runLen == off {
+					runLen += int64(bs)
+				} else if err = flushRun(); err == nil {
+					runOff, runLen = off, int64(bs)
+				}
+				if err == nil {
+					full, err = fill()
+					a, s = weakSum(ring)
+				}
+				continue
+			}
+		}
+		// No match here: the window's first byte is new, and the window
+		// moves on by one.
+		c, rerr := r.ReadByte()
+		if rerr == io.EOF {
+			if err = writeLiteral(ring[head:]); err == nil {
+				err = writeLiteral(ring[:head])
+			}
+			break
+		} else if rerr != nil {
+			err = rerr
+			break
+		}
+		gone := ring[head]
+		if err = flushRun(); err != nil {
+			break
+		}
+		if err = w.WriteByte(gone); err != nil {
+			break
+		}
+		literal++
+		ring[head] = c
+		head = (head + 1) % bs
+		a = (a - uint32(gone) + uint32(c)) & 0xffff
+		s = (s - uint32(bs)*uint32(gone) + a) & 0xffff
+	}
+	if err == nil {
+		err = flushRun()
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	return literal, err
+}
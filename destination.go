@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// defaultDestination keeps the original behavior of one flat folder per category.
+const defaultDestination = "{{.Category}}"
+
+// Destination is the template that renders a file's destination directory,
+// relative to the directory being organized. Rules may override it.
+var Destination = defaultDestinationTemplate
+
+// NameTemplates holds the config's names section: per category, the
+// template renaming files moved, copied or compressed into it.
+var NameTemplates map[string]*template.Template
+
+// destRoot holds -dest: the absolute directory category folders are
+// created under, or "" to create them inside each directory organized.
+var destRoot string
+
+// defaultDestinationTemplate is the compiled defaultDestination.
+var defaultDestinationTemplate = template.Must(parseDestination(defaultDestination))
+
+// templateFuncs are the helper functions available in destination templates.
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"quote": shellQuote,
+	"slug":  slugify,
+}
+
+// slugify lower-cases s and turns every run of characters other than
+// letters, digits and dots into one hyphen, so "My Report (v2).PDF"
+// becomes "my-report-v2.pdf".
+func slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' {
+			if hyphen && b.Len() > 0 && r != '.' {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		hyphen = true
+	}
+	return b.String()
+}
+
+// parseDestination parses a destination template such as
+// "{{.Category}}/{{.ModTime.Year}}/{{.ModTime.Month}}".
+func parseDestination(text string) (*template.Template, error) {
+	return template.New("destination").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// renderDestination renders the destination directory for the file,
+// relative to the directory being organized.
+func renderDestination(f File) (string, error) {
+	tmpl := Destination
+	if f.Rule != nil && f.Rule.dest != nil {
+		tmpl = f.Rule.dest
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, f); err != nil {
+		return "", fmt.Errorf("failed to render destination: %v", err)
+	}
+	rel := filepath.Clean(filepath.FromSlash(strings.TrimSpace(b.String())))
+	if rel == "." || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("destination %q must be a relative path inside the directory", b.String())
+	}
+	return rel, nil
+}
+
+// movedName returns the name the file gets in its destination folder: its
+// rule's rename template rendered if it has one, else its category's names
+// template, else its own name. Folders moved as units keep their names.
+func movedName(f File) (string, error) {
+	if f.plan != nil {
+		// Planned with the name it goes by, plus .gz or .zst when
+		// compressed.
+		name := filepath.Base(f.plan.Dest)
+		if f.plan.Action == ActionCompress {
+			name = strings.TrimSuffix(name, compressedExt(compression(f)))
+		}
+		return name, nil
+	}
+	tmpl := NameTemplates[f.Category]
+	if tmpl == nil {
+		tmpl = NameTemplates[canonicalCategory(f.Category)]
+	}
+	if f.Rule != nil && f.Rule.rename != nil {
+		tmpl = f.Rule.rename
+	}
+	if tmpl == nil || f.unit {
+		return f.Name, nil
+	}
+	return renderName(tmpl, f)
+}
+
+// outputFolders returns the names of the top-level folders files can be
+// moved into: the first element of the destination for every category,
+// rule and alias. Recursive scans skip them so organized files are not
+// picked up again.
+func outputFolders() map[string]bool {
+	folders := map[string]bool{}
+	add := func(tmpl *template.Template, category string) {
+		f := sampleFile()
+		f.Category = category
+		var b strings.Builder
+		if err := tmpl.Execute(&b, f); err != nil {
+			return
+		}
+		rel := filepath.ToSlash(filepath.Clean(strings.TrimSpace(b.String())))
+		if top, _, _ := strings.Cut(rel, "/"); top != "" && top != "." && top != ".." {
+			folders[top] = true
+		}
+	}
+	folders[quarantineFolder] = true
+	folders[unsortedFolder] = true
+	categories := []string{"Other", categoryExecutables, categoryScripts}
+	for name := range Categories {
+		categories = append(categories, name)
+	}
+	for alias := range Aliases {
+		categories = append(categories, alias)
+	}
+	for _, category := range categories {
+		add(Destination, category)
+	}
+	for _, r := range Rules {
+		tmpl := Destination
+		if r.dest != nil {
+			tmpl = r.dest
+		}
+		add(tmpl, canonicalCategory(r.Category))
+	}
+	return folders
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// deviceID returns the ID of the device holding the file, if known. File
+// info on this platform carries no device, so file system boundaries are
+// not detected.
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// linkID returns the device and inode of a file with several hard links.
+// File info on this platform carries neither, so links are not recognized.
+func linkID(info os.FileInfo) ([2]uint64, bool) {
+	return [2]uint64{}, false
+}
+
+// fileOwner returns the user and group owning the file. This platform has
+// no numeric owners, so none is ever known.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
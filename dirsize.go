@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// walkParallel calls fn for every entry below root, reading up to workers
+// directories at once, so sizing a large folder on slow storage doesn't
+// take one round trip per directory in turn. fn is called from several
+// goroutines. Symbolic links are reported but not followed. The first
+// error, from reading a directory or from fn, stops the walk and is
+// returned.
+func walkParallel(root string, workers int, fn func(path string, d fs.DirEntry) error) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+	)
+	// The calling goroutine counts as one worker.
+	sem := make(chan struct{}, max(workers, 1)-1)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+		}
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return first != nil
+	}
+
+	var walk func(dir string)
+	walk = func(dir string) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fail(err)
+			return
+		}
+		for _, entry := range entries {
+			if failed() {
+				return
+			}
+			p := filepath.Join(dir, entry.Name())
+			if err := fn(p, entry); err != nil {
+				fail(err)
+				return
+			}
+			if !entry.IsDir() {
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					walk(p)
+				}()
+			default:
+				walk(p)
+			}
+		}
+	}
+	walk(root)
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultQuietPeriod is how long a file must go unmodified before it is
+// organized, so files still being written are left alone.
+const defaultQuietPeriod = 5 * time.Second
+
+// partialExts are the extensions browsers and download managers give files
+// that are still downloading.
+var partialExts = []string{".crdownload", ".part", ".partial", ".download", ".opdownload", ".tmp"}
+
+// inProgress reports why the file looks like an unfinished download, or ""
+// if it looks complete. siblings holds the names of the other entries in
+// the file's directory: Firefox, for example, keeps an empty "report.pdf"
+// next to "report.pdf.part" until the download finishes.
+func inProgress(f File, siblings map[string]bool, quiet time.Duration, now time.Time) string {
+	for _, ext := range partialExts {
+		if f.Extension == ext {
+			return "partial download"
+		}
+		if siblings[f.Name+ext] {
+			return fmt.Sprintf("%s is still downloading", f.Name+ext)
+		}
+	}
+	if quiet > 0 {
+		if age := now.Sub(f.ModTime); age < quiet && age > -time.Minute {
+			return fmt.Sprintf("modified %v ago, waiting for %v without writes", age.Round(time.Second), quiet)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix is prepended to a flag's upper-cased name to form its
+// environment variable, e.g. -dry-run becomes ORGANIZER_DRY_RUN.
+const envPrefix = "ORGANIZER_"
+
+// envName returns the environment variable that overrides the named flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// setFlags returns the names of the flags that have been set so far.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// applyEnv sets every flag that was not given on the command line from its
+// ORGANIZER_* environment variable, if present.
+func applyEnv(fs *flag.FlagSet) error {
+	set := setFlags(fs)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if e := fs.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("invalid %s=%q: %v", envName(f.Name), value, e)
+		}
+	})
+	return err
+}
+
+// applyOptions sets flags that were given neither on the command line nor
+// in the environment from the config file's options section.
+func applyOptions(fs *flag.FlagSet, options map[string]string) error {
+	set := setFlags(fs)
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "config" || name == "profile" || name == "version" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config options: unknown option %q", name)
+		}
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, options[name]); err != nil {
+			return fmt.Errorf("config options: invalid %s %q: %v", name, options[name], err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultExecTimeout bounds commands run by the exec action when the rule
+// sets no timeout.
+const defaultExecTimeout = time.Minute
+
+// shellQuote quotes s for a POSIX shell. It is available in templates as
+// "quote", e.g. "convert {{quote .Path}} out.png".
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(s, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// renderCommand renders a command template for the file, or for a hook's
+// hookData.
+func renderCommand(tmpl *template.Template, data any) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render command: %v", err)
+	}
+	command := strings.TrimSpace(b.String())
+	if command == "" {
+		return "", errors.New("rendered command is empty")
+	}
+	return command, nil
+}
+
+// shellCommand builds a command that runs command through the platform shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
+
+// runCommand runs command through the shell with a timeout and returns its
+// combined output.
+func runCommand(command string, timeout time.Duration) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := shellCommand(ctx, command)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.WaitDelay = time.Second // don't hang on children holding the pipes open
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return out.Bytes(), fmt.Errorf("command timed out after %v", timeout)
+	}
+	return out.Bytes(), err
+}
+
+// printCommandOutput prints captured command output indented under the
+// file it belongs to.
+func printCommandOutput(name string, output []byte) {
+	text := strings.TrimRight(string(output), "\n")
+	if text == "" {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Output of command for %q:\n", name)
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString("    " + line + "\n")
+	}
+	fmt.Print(b.String())
+}
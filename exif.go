@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exif is the EXIF metadata of a photo that templates can use as
+// {{.Exif.DateTimeOriginal}}. Fields the photo lacks are zero.
+type Exif struct {
+	DateTimeOriginal time.Time // when the photo was taken, in its own time zone if recorded, else local time
+	Make             string    // camera maker, e.g. "Canon"
+	Model            string    // camera model, e.g. "Canon EOS R6"
+	HasGPS           bool      // whether Latitude and Longitude were recorded
+	Latitude         float64   // in degrees, negative south of the equator
+	Longitude        float64   // in degrees, negative west of Greenwich
+}
+
+// EXIF tags read, by the IFD they are in.
+const (
+	tagMake               = 0x010F // IFD0
+	tagModel              = 0x0110 // IFD0
+	tagExifIFD            = 0x8769 // IFD0: offset of the Exif IFD
+	tagGPSIFD             = 0x8825 // IFD0: offset of the GPS IFD
+	tagGPSLatitudeRef     = 0x0001 // GPS IFD: "N" or "S"
+	tagGPSLatitude        = 0x0002 // GPS IFD: degrees, minutes and seconds
+	tagGPSLongitudeRef    = 0x0003 // GPS IFD: "E" or "W"
+	tagGPSLongitude       = 0x0004 // GPS IFD: degrees, minutes and seconds
+	tagDateTimeOriginal   = 0x9003 // Exif IFD
+	tagOffsetTimeOriginal = 0x9011 // Exif IFD: time zone of DateTimeOriginal, e.g. "+02:00"
+)
+
+// exifScanLen is how far into a HEIF, PNG or WebP file the EXIF block is
+// looked for.
+const exifScanLen = 1 << 20
+
+// errNoExif is returned for files without EXIF metadata.
+var errNoExif = errors.New("no EXIF metadata")
+
+// readExif reads the EXIF metadata of the photo at path: a JPEG, a TIFF or
+// a raw format built on TIFF, such as DNG, CR2, NEF or ARW, or a HEIF, PNG
+// or WebP file with an EXIF block near its start.
+func readExif(path string) (Exif, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return Exif{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Exif{}, err
+	}
+	start, err := findTIFF(f, info.Size())
+	if err != nil {
+		return Exif{}, err
+	}
+	t, err := newTIFFReader(io.NewSectionReader(f, start, info.Size()-start))
+	if err != nil {
+		return Exif{}, err
+	}
+	return t.exif()
+}
+
+// findTIFF returns the offset of the TIFF structure holding the EXIF
+// metadata in the file r of the size.
+func findTIFF(r io.ReaderAt, size int64) (int64, error) {
+	head := make([]byte, min(size, exifScanLen))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return 0, err
+	}
+	switch {
+	case isTIFFHeader(head):
+		return 0, nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		return jpegExif(r, size)
+	case bytes.HasPrefix(head, []byte("\x89PNG")),
+		len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP",
+		len(head) >= 8 && string(head[4:8]) == "ftyp":
+		// The EXIF block follows its name, possibly after a size.
+		for _, tag := range []string{"Exif\x00\x00", "eXIf", "EXIF"} {
+			for i := 0; ; {
+				at := bytes.Index(head[i:], []byte(tag))
+				if at < 0 {
+					break
+				}
+				at += i + len(tag)
+				for _, skip := range []int{0, 4} {
+					if at+skip < len(head) && isTIFFHeader(head[at+skip:]) {
+						return int64(at + skip), nil
+					}
+				}
+				i = at
+			}
+		}
+	}
+	return 0, errNoExif
+}
+
+// isTIFFHeader reports whether b starts with a TIFF header, in either byte
+// order, including the variants raw formats use.
+func isTIFFHeader(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	switch string(b[:4]) {
+	case "II*\x00", "MM\x00*", "IIRO", "IIRS", "IIU\x00":
+		return true
+	}
+	return false
+}
+
+// jpegExif returns the offset of the TIFF structure in the JPEG file's
+// APP1 Exif segment.
+func jpegExif(r io.ReaderAt, size int64) (int64, error) {
+	var seg [10]byte
+	for pos := int64(2); pos+4 <= size; {
+		if _, err := r.ReadAt(seg[:4], pos); err != nil {
+			return 0, err
+		}
+		if seg[0] != 0xFF {
+			return 0, errors.New("malformed JPEG")
+		}
+		marker, length := seg[1], int64(binary.BigEndian.Uint16(seg[2:4]))
+		if marker == 0xDA || marker == 0xD9 {
+			break // Image data: the metadata comes before it.
+		}
+		if marker == 0xE1 && length >= 8 {
+			if _, err := r.ReadAt(seg[4:10], pos+4); err == nil && string(seg[4:10]) == "Exif\x00\x00" {
+				return pos + 10, nil
+			}
+		}
+		pos += 2 + length
+	}
+	return 0, errNoExif
+}
+
+// tiffReader reads the IFDs of a TIFF structure.
+type tiffReader struct {
+	r     *io.SectionReader
+	order binary.ByteOrder
+}
+
+// tiffEntry is one field of an IFD, with its value's bytes.
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func newTIFFReader(r *io.SectionReader) (*tiffReader, error) {
+	var head [2]byte
+	if _, err := r.ReadAt(head[:], 0); err != nil {
+		return nil, err
+	}
+	t := &tiffReader{r: r, order: binary.LittleEndian}
+	if string(head[:]) == "MM" {
+		t.order = binary.BigEndian
+	}
+	return t, nil
+}
+
+// ifd reads the IFD at offset into its entries by tag.
+func (t *tiffReader) ifd(offset uint32) (map[uint16]tiffEntry, error) {
+	var n [2]byte
+	if _, err := t.r.ReadAt(n[:], int64(offset)); err != nil {
+		return nil, err
+	}
+	count := int(t.order.Uint16(n[:]))
+	if count > 1000 {
+		return nil, errors.New("malformed IFD")
+	}
+	raw := make([]byte, 12*count)
+	if _, err := t.r.ReadAt(raw, int64(offset)+2); err != nil {
+		return nil, err
+	}
+	entries := make(map[uint16]tiffEntry, count)
+	for i := 0; i < count; i++ {
+		e := raw[12*i : 12*i+12]
+		entry := tiffEntry{typ: t.order.Uint16(e[2:4]), count: t.order.Uint32(e[4:8])}
+		size := int64(tiffTypeSize(entry.typ)) * int64(entry.count)
+		if size == 0 || size > 1<<16 {
+			continue // Unknown type, or too big to be of use.
+		}
+		if size <= 4 {
+			entry.value = e[8 : 8+size]
+		} else {
+			entry.value = make([]byte, size)
+			if _, err := t.r.ReadAt(entry.value, int64(t.order.Uint32(e[8:12]))); err != nil {
+				continue
+			}
+		}
+		entries[t.order.Uint16(e[0:2])] = entry
+	}
+	return entries, nil
+}
+
+// tiffTypeSize returns the size of one value of the TIFF field type, or 0
+// for types not read.
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 7: // BYTE, ASCII, UNDEFINED
+		return 1
+	case 3: // SHORT
+		return 2
+	case 4, 9: // LONG, SLONG
+		return 4
+	case 5, 10: // RATIONAL, SRATIONAL
+		return 8
+	}
+	return 0
+}
+
+// string returns the field as text, without trailing NULs and spaces.
+func (e tiffEntry) string() string {
+	return strings.TrimRight(string(e.value), "\x00 ")
+}
+
+// uint returns the field's first value as an integer.
+func (t *tiffReader) uint(e tiffEntry) (uint32, bool) {
+	switch e.typ {
+	case 3:
+		return uint32(t.order.Uint16(e.value)), true
+	case 4:
+		return t.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+// exif collects the metadata in Exif from the IFDs.
+func (t *tiffReader) exif() (Exif, error) {
+	var first [4]byte
+	if _, err := t.r.ReadAt(first[:], 4); err != nil {
+		return Exif{}, err
+	}
+	ifd0, err := t.ifd(t.order.Uint32(first[:]))
+	if err != nil {
+		return Exif{}, err
+	}
+	exif := Exif{Make: metaText(ifd0[tagMake].string()), Model: metaText(ifd0[tagModel].string())}
+	if offset, ok := t.uint(ifd0[tagExifIFD]); ok {
+		if sub, err := t.ifd(offset); err == nil {
+			exif.DateTimeOriginal = exifTime(sub[tagDateTimeOriginal].string(), sub[tagOffsetTimeOriginal].string())
+		}
+	}
+	if offset, ok := t.uint(ifd0[tagGPSIFD]); ok {
+		if gps, err := t.ifd(offset); err == nil {
+			lat, latOK := t.degrees(gps[tagGPSLatitude], gps[tagGPSLatitudeRef].string(), "S")
+			lon, lonOK := t.degrees(gps[tagGPSLongitude], gps[tagGPSLongitudeRef].string(), "W")
+			if latOK && lonOK && math.Abs(lat) <= 90 && math.Abs(lon) <= 180 {
+				exif.HasGPS, exif.Latitude, exif.Longitude = true, lat, lon
+			}
+		}
+	}
+	return exif, nil
+}
+
+// degrees converts a GPS coordinate, three rationals for degrees, minutes
+// and seconds, to degrees, negated if ref is negative, "S" or "W".
+func (t *tiffReader) degrees(e tiffEntry, ref, negative string) (float64, bool) {
+	if e.typ != 5 || e.count < 3 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num, den := t.order.Uint32(e.value[8*i:]), t.order.Uint32(e.value[8*i+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	deg := parts[0] + parts[1]/60 + parts[2]/3600
+	if strings.EqualFold(ref, negative) {
+		deg = -deg
+	}
+	return deg, true
+}
+
+// exifTime parses an EXIF date such as "2024:05:17 14:03:22", in the zone
+// given as "+02:00", or local time without one. It returns the zero time
+// for dates that are missing or blanked out.
+func exifTime(date, zone string) time.Time {
+	loc := time.Local
+	if z, err := time.Parse("-07:00", zone); err == nil {
+		loc = z.Location()
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", date, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runExplain implements "organizer explain <file>": it shows how the file
+// would be categorized and where it would be moved, without moving it.
+func runExplain(args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(envName("config")), "Path to a YAML config file")
+	preset := fs.String("preset", os.Getenv(envName("preset")), "Comma-separated built-in presets to use under the config")
+	profile := fs.String("profile", os.Getenv(envName("profile")), "Named profile from the config file to use")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer explain [-config path] [-profile name] [-preset name] <file>")
+		return 2
+	}
+
+	path, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	cfg, err := loadGlobalConfig(*configPath)
+	if err == nil && *profile != "" {
+		cfg, err = cfg.selectProfile(*profile)
+	}
+	if err == nil {
+		err = prepareConfig(cfg, *preset, filepath.Dir(path))
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	if kind := specialKind(info.Mode()); kind != "" {
+		fmt.Printf("File:        %s\nResult:      a %s, never organized\n", path, kind)
+		return 0
+	}
+	file := newFile(path, info)
+	explainFile(&file)
+	return 0
+}
+
+// explainFile prints the categorization decision for the file.
+func explainFile(file *File) {
+	fmt.Printf("File:        %s (%s, modified %s)\n", file.Path, ByteSize(file.Size), file.ModTime.Format(time.DateTime))
+	if file.IsDir {
+		folder := *file
+		folder.root = filepath.Dir(file.Path)
+		folder.unit = true
+		if err := folder.categorizeFolder(file.Name, Exclude, nil, defaultScanWorkers); err != nil {
+			fmt.Printf("Result:      directories are only moved with -folders, and this one cannot be: %v\n", err)
+			return
+		}
+		if folder.Category == "" {
+			fmt.Println("Result:      directories are only moved with -folders, and this one is empty")
+			return
+		}
+		fmt.Printf("Result:      directories are only moved with -folders; with it this one (%s in total) goes to %s\n", ByteSize(folder.Size), folder.Category)
+		return
+	}
+	if Exclude.Excluded(file.Name, false) {
+		fmt.Println("Result:      excluded by an exclude pattern, never touched")
+		return
+	}
+
+	if len(Rules) > 0 {
+		fmt.Println("Rules:")
+	}
+	var matched *Rule
+	for i := range Rules {
+		r := &Rules[i]
+		if matched != nil {
+			fmt.Printf("  -  %s: not evaluated, rule %s matched first\n", r.label(), matched.label())
+			continue
+		}
+		if reason := r.mismatch(file); reason != "" {
+			fmt.Printf("  ✗  %s: %s\n", r.label(), reason)
+			continue
+		}
+		fmt.Printf("  ✓  %s: matched → %s\n", r.label(), r.Category)
+		matched = r
+	}
+
+	file.Categorize()
+	switch {
+	case matched != nil:
+		fmt.Printf("Category:    %s (rule %s)\n", file.Category, matched.label())
+	case categoryForExt(file.Extension) != "":
+		fmt.Printf("Category:    %s (extension %s)\n", file.Category, file.Extension)
+	case file.Extension == "" && file.ProgramCategory() != "":
+		fmt.Printf("Category:    %s (content is a program)\n", file.Category)
+	case file.Category != "Other":
+		fmt.Printf("Category:    %s (content looks like %s)\n", file.Category, file.DetectMIME())
+	default:
+		fmt.Printf("Category:    Other (no rule or category matched)\n")
+	}
+
+	file.Category = categoryFolder(file.baseDir(), file.Category)
+	rel, err := renderDestination(*file)
+	if err != nil {
+		fmt.Printf("Destination: ❌ %v\n", err)
+		return
+	}
+	switch action := fileAction(*file); action {
+	case ActionSkip, ActionDelete:
+		fmt.Printf("Action:      %s\n", action)
+	case ActionExec:
+		command, err := renderCommand(file.Rule.exec, *file)
+		if err != nil {
+			fmt.Printf("Action:      exec ❌ %v\n", err)
+		} else {
+			fmt.Printf("Action:      exec %s\n", command)
+		}
+	case ActionRename:
+		name, err := renderName(file.Rule.rename, *file)
+		if err != nil {
+			fmt.Printf("Action:      rename ❌ %v\n", err)
+		} else {
+			fmt.Printf("Action:      rename to %s\n", filepath.Join(filepath.Dir(file.Path), name))
+		}
+	case ActionArchive:
+		fmt.Printf("Action:      archive\nDestination: %s\n", filepath.Join(file.baseDir(), rel, archiveName(*file)))
+	default:
+		fmt.Printf("Action:      %s\n", action)
+		name, err := movedName(*file)
+		if err != nil {
+			fmt.Printf("Destination: ❌ %v\n", err)
+			break
+		}
+		if action == ActionCompress {
+			name += compressedExt(compression(*file))
+		}
+		fmt.Printf("Destination: %s\n", filepath.Join(file.baseDir(), rel, name))
+	}
+	if err := isFileValid(*file); err != nil {
+		fmt.Printf("Note:        the file would not be moved: %v\n", err)
+	} else if file.Size == 0 {
+		fmt.Println("Note:        the file is empty; -empty-files decides what happens (skipped by default)")
+	}
+}
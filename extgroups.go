@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// builtinExtensionGroups are extensions that name the same file type. The
+// first extension of each group is its canonical form.
+var builtinExtensionGroups = [][]string{
+	{".jpg", ".jpeg", ".jpe"},
+	{".tif", ".tiff"},
+	{".htm", ".html"},
+	{".mpg", ".mpeg"},
+	{".yml", ".yaml"},
+	{".md", ".markdown"},
+}
+
+// extCanonical maps every grouped extension to its canonical form. It is
+// replaced by setupConfig when the config adds extension_groups.
+var extCanonical = extensionGroups(builtinExtensionGroups, nil)
+
+// extensionGroups builds the canonical-form map from the built-in groups
+// and the config's. A config group takes its extensions out of any
+// built-in group, so it can also split one up.
+func extensionGroups(builtin, config [][]string) map[string]string {
+	canonical := map[string]string{}
+	for _, groups := range [][][]string{builtin, config} {
+		for _, group := range groups {
+			if len(group) == 0 {
+				continue
+			}
+			for _, ext := range group {
+				canonical[ext] = group[0]
+			}
+		}
+	}
+	return canonical
+}
+
+// canonicalExt returns the canonical form of ext, e.g. ".jpg" for ".jpeg".
+func canonicalExt(ext string) string {
+	if c, ok := extCanonical[ext]; ok {
+		return c
+	}
+	return ext
+}
+
+// sameExt reports whether a and b name the same file type.
+func sameExt(a, b string) bool {
+	return a == b || (a != "" && canonicalExt(a) == canonicalExt(b))
+}
+
+// containsExt reports whether exts holds ext or an equivalent extension.
+func containsExt(exts []string, ext string) bool {
+	return slices.ContainsFunc(exts, func(e string) bool { return sameExt(e, ext) })
+}
+
+// CanonicalExtension returns the file's extension in canonical form, so
+// templates can write "{{.CanonicalExtension}}" to turn .jpeg into .jpg.
+func (f File) CanonicalExtension() string {
+	return canonicalExt(f.Extension)
+}
+
+// validateExtensionGroups reports extensions listed in more than one of
+// the config's groups.
+func validateExtensionGroups(groups [][]string) []string {
+	var problems []string
+	seen := map[string]int{}
+	for i, group := range groups {
+		if len(group) < 2 {
+			problems = append(problems, fmt.Sprintf("extension group %d needs at least two extensions", i+1))
+		}
+		for _, ext := range group {
+			if j, ok := seen[ext]; ok && j != i {
+				problems = append(problems, fmt.Sprintf("extension %q is in extension groups %d and %d", ext, j+1, i+1))
+			}
+			seen[ext] = i
+		}
+	}
+	return problems
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultExtractLimit is how much an archive may unpack to unless
+// -extract-limit says otherwise.
+const defaultExtractLimit = 4 << 30
+
+// maxExtractEntries is the most entries an archive may unpack to.
+const maxExtractEntries = 100000
+
+// extractLimit holds -extract-limit: the extract action refuses archives
+// that unpack to more than this, however small they are themselves.
+var extractLimit ByteSize = defaultExtractLimit
+
+// extractedName returns the name of the folder the archive at name is
+// unpacked into, and false if the extract action can't unpack it.
+func extractedName(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)], true
+		}
+	}
+	return "", false
+}
+
+// extractFile carries out the extract action: the archive is unpacked
+// into a folder named after it, which is then organized as a unit into the
+// category holding most of its bytes, like a folder moved with -folders.
+// The contents are categorized together rather than file by file, so an
+// unpacked project isn't scattered over several categories. An archive
+// holding a single folder gives that folder's contents. The archive is
+// then removed, into the trash unless -trash=false.
+func extractFile(file File, dryRun bool) error {
+	name, ok := extractedName(file.Name)
+	if !ok {
+		return errors.New("only .zip, .tar, .tar.gz and .tgz archives can be extracted")
+	}
+	if remoteDest != nil {
+		return errors.New("the extract action needs a local destination")
+	}
+	if dryRun {
+		fmt.Printf("Would extract %q into %s/ and file it by its contents\n", file.Name, name)
+		return nil
+	}
+	unlock, err := lockForMove(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Unpacked out of sight, then moved into place whole.
+	base := file.baseDir()
+	if err := runJournal.mkdirAll(base); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	tmp, err := os.MkdirTemp(longPath(base), ".organizer-extract-")
+	if err != nil {
+		return err
+	}
+	tmp = shortPath(tmp)
+	defer os.RemoveAll(longPath(tmp))
+	skipped, err := unpackArchive(file.Path, tmp)
+	if err != nil {
+		return fmt.Errorf("failed to extract: %v", err)
+	}
+	if skipped > 0 {
+		fmt.Printf("⚠️ %q: left out %d link(s) and special file(s)\n", file.Name, skipped)
+	}
+	content := tmp
+	if entries, err := os.ReadDir(longPath(tmp)); err == nil && len(entries) == 1 && entries[0].IsDir() {
+		content = filepath.Join(tmp, entries[0].Name())
+	}
+
+	info, err := os.Stat(longPath(content))
+	if err != nil {
+		return err
+	}
+	folder := newFile(content, info)
+	folder.Name, folder.root, folder.unit = name, file.root, true
+	if err := folder.categorizeFolder(name, nil, nil, defaultScanWorkers); err != nil {
+		return err
+	}
+	if folder.Category == "" {
+		return errors.New("the archive is empty")
+	}
+	rel, err := destinationFor(&folder)
+	if err != nil {
+		return err
+	}
+	rel = existingDir(base, portablePath(rel))
+	destDir := filepath.Join(base, rel)
+	destPath, err := claimDestination(folder, filepath.Join(destDir, normalizeName(name, normalizeNames)), false)
+	if err != nil || destPath == "" {
+		return err
+	}
+	if err := runJournal.mkdirAll(destDir); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	markOutputFolder(base, rel)
+	if err := os.Rename(longPath(content), longPath(destPath)); err != nil {
+		return fmt.Errorf("failed to move the extracted folder: %v", err)
+	}
+	digest, err := folderDigest(destPath)
+	if err != nil {
+		fmt.Printf("⚠️ %q: undo won't check the extracted folder for changes: %v\n", file.Name, err)
+	}
+	runJournal.add(journalOp{Action: ActionExtract, Source: file.Path, Dest: destPath, SHA256: digest})
+	fmt.Printf("📂 Extracted %q (%s) to %s\n", file.Name, ByteSize(folder.Size), filepath.Join(rel, filepath.Base(destPath)))
+
+	if runMode != ModeMove {
+		return nil // The archive stays untouched.
+	}
+	unlock()
+	if runJournal.deferring() {
+		runJournal.remove(file.Path, ActionDelete)
+		return nil
+	}
+	trashed, err := deleteFile(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to remove the archive after extracting: %v", err)
+	}
+	runJournal.add(journalOp{Action: ActionDelete, Source: file.Path, Trash: trashed})
+	return nil
+}
+
+// folderDigest returns a checksum of what the folder holds: the names of
+// its entries, and the sizes and modification times of its files. Undo
+// compares it to leave alone an extracted folder changed since.
+func folderDigest(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(longPath(dir), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(longPath(dir), p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			fmt.Fprintf(h, "%s/\n", filepath.ToSlash(rel))
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %d %d\n", filepath.ToSlash(rel), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extraction unpacks one archive within -extract-limit.
+type extraction struct {
+	root    string
+	left    int64 // bytes still allowed
+	entries int
+	skipped int // links and special files left out
+}
+
+// unpackArchive unpacks the archive at src into the directory dst and
+// returns how many entries it left out. Entries are only ever written
+// below dst: an archive with a path leading out of it, as in zip slip, is
+// refused, and so is one unpacking to more than -extract-limit or
+// maxExtractEntries, as in a zip bomb. Links and special files are left
+// out, so nothing can point a later entry outside dst.
+func unpackArchive(src, dst string) (int, error) {
+	x := &extraction{root: dst, left: int64(extractLimit)}
+	lower := strings.ToLower(src)
+	if strings.HasSuffix(lower, ".zip") {
+		r, err := zip.OpenReader(longPath(src))
+		if err != nil {
+			return 0, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			mode := f.Mode()
+			if !mode.IsDir() && !mode.IsRegular() {
+				x.skipped++
+				continue
+			}
+			err := x.entry(f.Name, mode, f.Modified, func() (io.ReadCloser, error) { return f.Open() })
+			if err != nil {
+				return x.skipped, err
+			}
+		}
+		return x.skipped, nil
+	}
+
+	in, err := os.Open(longPath(src))
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	var r io.Reader = throttle(in)
+	if !strings.HasSuffix(lower, ".tar") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return x.skipped, nil
+		} else if err != nil {
+			return x.skipped, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+		case tar.TypeXGlobalHeader:
+			continue
+		default:
+			x.skipped++
+			continue
+		}
+		err = x.entry(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime, func() (io.ReadCloser, error) { return io.NopCloser(tr), nil })
+		if err != nil {
+			return x.skipped, err
+		}
+	}
+}
+
+// entry writes the archive entry called name, a directory or a regular
+// file whose content open returns.
+func (x *extraction) entry(name string, mode os.FileMode, modTime time.Time, open func() (io.ReadCloser, error)) error {
+	x.entries++
+	if x.entries > maxExtractEntries {
+		return fmt.Errorf("it holds more than %d entries", maxExtractEntries)
+	}
+	target, err := x.path(name)
+	if err != nil || target == x.root {
+		return err
+	}
+	if mode.IsDir() {
+		return os.MkdirAll(longPath(target), 0755)
+	}
+	if err := os.MkdirAll(longPath(filepath.Dir(target)), 0755); err != nil {
+		return err
+	}
+	rc, err := open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	out, err := os.OpenFile(longPath(target), os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	// Sizes in the archive's headers can lie; what is written counts.
+	n, err := io.Copy(out, io.LimitReader(rc, x.left+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if x.left -= n; x.left < 0 {
+		return fmt.Errorf("it unpacks to more than %s (see -extract-limit)", extractLimit)
+	}
+	return os.Chtimes(longPath(target), modTime, modTime)
+}
+
+// path returns where the entry called name goes, refusing names that lead
+// outside the root.
+func (x *extraction) path(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if clean == "." {
+		return x.root, nil
+	}
+	target := filepath.Join(x.root, filepath.FromSlash(clean))
+	// On Windows a colon names a drive or an alternate data stream; elsewhere
+	// it is an ordinary character, as in "12:30 notes.txt".
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || filepath.VolumeName(clean) != "" ||
+		runtime.GOOS == "windows" && strings.Contains(clean, ":") || !isWithin(target, x.root) {
+		return "", fmt.Errorf("it holds %q, which leads outside the folder", name)
+	}
+	return target, nil
+}
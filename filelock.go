@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// errFileLocked is returned for a file another process holds a lock on,
+// or on Windows has open for writing, when it is about to be moved.
+var errFileLocked = errors.New("locked by another process")
+
+// lockForMove locks the file for the duration of its move, copy or
+// compression so a process that honors the lock can't write to it
+// meanwhile, and returns the function releasing the lock, which may be
+// called more than once. It fails with errFileLocked if another process
+// holds the file. Folders and symbolic links are not locked.
+func lockForMove(file File) (unlock func(), err error) {
+	if file.IsDir || file.symlink {
+		return func() {}, nil
+	}
+	unlock, err = lockFile(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	return sync.OnceFunc(unlock), nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package main
+
+// lockFile does nothing: this platform has no file locks to take.
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import "syscall"
+
+// lockFile opens the file sharing it for reading and deletion only, so
+// nobody can open it for writing until the returned function closes it.
+// The move itself, a rename, is allowed by FILE_SHARE_DELETE. A file
+// another process already has open for writing fails with a sharing
+// violation.
+func lockFile(path string) (func(), error) {
+	name, err := syscall.UTF16PtrFromString(longPath(path))
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_DELETE, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errorSharingViolation {
+		return nil, errFileLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() { syscall.CloseHandle(h) }, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metadata read from inside files, such as when a photo was taken, is
+// exposed to templates through File methods. It is read on first use and
+// kept for the run, so however many templates and rules ask, each file is
+// read at most once per kind of metadata.
+
+// metaKey identifies a file's content well enough for the run: a file
+// changed in between is read again.
+type metaKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// fileMeta holds what has been read from one file, by kind.
+type fileMeta struct {
+	mu    sync.Mutex
+	kinds map[string]any
+}
+
+// metaCache maps metaKey to *fileMeta.
+var metaCache sync.Map
+
+// readMeta returns the kind of metadata read extracts from the file,
+// calling it only the first time the file is asked for that kind. Folders
+// get read's result for "".
+func readMeta(f File, kind string, read func(path string) any) any {
+	if f.IsDir || f.Path == "" {
+		return read("")
+	}
+	v, _ := metaCache.LoadOrStore(metaKey{f.Path, f.Size, f.ModTime}, &fileMeta{})
+	meta := v.(*fileMeta)
+	meta.mu.Lock()
+	defer meta.mu.Unlock()
+	if value, ok := meta.kinds[kind]; ok {
+		return value
+	}
+	value := read(f.Path)
+	if meta.kinds == nil {
+		meta.kinds = map[string]any{}
+	}
+	meta.kinds[kind] = value
+	return value
+}
+
+// metaText cleans up text read from a file's metadata for use in folder
+// and file names: surrounding space is dropped and characters some file
+// systems reject are replaced, see sanitizeName. Empty text stays empty.
+func metaText(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	return sanitizeName(s)
+}
+
+// resetMeta forgets the metadata read during the run, for the next.
+func resetMeta() {
+	metaCache.Range(func(key, _ any) bool {
+		metaCache.Delete(key)
+		return true
+	})
+}
+
+// Exif returns the file's EXIF metadata, all empty unless it is a photo
+// that has some.
+func (f File) Exif() Exif {
+	return readMeta(f, "exif", func(path string) any {
+		if path == "" {
+			return Exif{}
+		}
+		exif, _ := readExif(path)
+		return exif
+	}).(Exif)
+}
+
+// Taken returns when the photo was taken according to its EXIF metadata,
+// or the file's modification time if that doesn't say.
+func (f File) Taken() time.Time {
+	if taken := f.Exif().DateTimeOriginal; !taken.IsZero() {
+		return taken
+	}
+	return f.ModTime
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// runFlatten implements "organizer flatten": it moves every file out of
+// the category folders of an organized directory, whatever their depth,
+// into the directory itself or the folder given with -into, and removes
+// the folders left empty. The moves are journaled, so undo sorts the files
+// back.
+func runFlatten(args []string) int {
+	fs := flag.NewFlagSet("flatten", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(envName("config")), "Path to a YAML config file")
+	preset := fs.String("preset", os.Getenv(envName("preset")), "Comma-separated built-in presets to use under the config")
+	profile := fs.String("profile", os.Getenv(envName("profile")), "Named profile from the config file to use")
+	into := fs.String("into", "", "Folder to move the files into, relative to the directory or absolute (default: the directory itself)")
+	dryRun := fs.Bool("dry-run", false, "Show what would be moved without moving it")
+	conflict := fs.String("on-conflict", ConflictRename, "What to do when a file of the same name is already there: skip, overwrite, rename, newer-wins, ask or hash-suffix")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer flatten [-config path] [-profile name] [-preset name] [-into folder] [-on-conflict mode] [-dry-run] [dir]")
+		return 2
+	}
+	switch *conflict {
+	case ConflictSkip, ConflictOverwrite, ConflictRename, ConflictNewerWins, ConflictAsk, ConflictHash:
+		onConflict = *conflict
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -on-conflict %q (valid: skip, overwrite, rename, newer-wins, ask, hash-suffix)\n", *conflict)
+		return 2
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = expandHome(fs.Arg(0))
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	target := dir
+	if *into != "" {
+		target = expandHome(*into)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		target = filepath.Clean(target)
+	}
+
+	cfg, err := loadGlobalConfig(*configPath)
+	if err == nil && *profile != "" {
+		cfg, err = cfg.selectProfile(*profile)
+	}
+	if err == nil {
+		err = prepareConfig(cfg, *preset, dir)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	folders := outputFolders()
+	if rel, err := filepath.Rel(dir, target); err == nil && rel != "." && isWithin(target, dir) {
+		top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		if folders[top] || isMarkedFolder(filepath.Join(dir, top)) {
+			fmt.Printf("❌ -into %s is inside the category folder %s\n", target, top)
+			return 1
+		}
+	}
+
+	if !*dryRun {
+		release, err := lockDirs([]string{dir})
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		defer release()
+		runJournal = newJournal([]string{dir}, false)
+		defer func() {
+			runJournal.finish()
+			runJournal = nil
+		}()
+	}
+	var files []File
+	tops := map[string]bool{}
+	err = walkOrganized(dir, folders, func(path, rel string, info os.FileInfo) {
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			return
+		}
+		file := newFile(path, info)
+		file.root = dir
+		file.symlink = info.Mode()&os.ModeSymlink != 0
+		files = append(files, file)
+		top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		tops[filepath.Join(dir, top)] = true
+	})
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Printf("Nothing to flatten in %s\n", dir)
+		return 0
+	}
+	if !*dryRun {
+		if err := runJournal.mkdirAll(target); err != nil {
+			fmt.Printf("❌ failed to create directory: %v\n", err)
+			return 1
+		}
+	}
+
+	moved, failed := 0, 0
+	for _, file := range files {
+		err := flattenFile(file, target, *dryRun)
+		runJournal.outcome(file, err)
+		if err != nil {
+			fmt.Printf("❌ %q: %v\n", file.Name, err)
+			failed++
+			continue
+		}
+		moved++
+	}
+	if !*dryRun {
+		unmarkEmptied(tops)
+		pruneEmpty = true
+		runJournal.pruneEmptyDirs()
+	}
+	verb := "Moved"
+	if *dryRun {
+		verb = "Would move"
+	}
+	fmt.Printf("%s %d of %d file(s) out of %d category folder(s) into %s\n", verb, moved, len(files), len(tops), target)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// flattenFile moves the file into the folder into, under its own name
+// unless -on-conflict picks another.
+func flattenFile(file File, into string, dryRun bool) error {
+	destPath, err := claimDestination(file, filepath.Join(into, file.Name), dryRun)
+	if err != nil || destPath == "" {
+		return err
+	}
+	if dryRun {
+		fmt.Printf("Would move %s to %s\n", file.Path, destPath)
+		return nil
+	}
+	throttleOp()
+	unlock, err := lockForMove(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	turn, replace, err := land(file, destPath)
+	if errors.Is(err, errSuperseded) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to replace %s: %v", destPath, err)
+	}
+	defer turn.release()
+	if replace {
+		runJournal.add(journalOp{Action: opReplace, Dest: destPath})
+		if file.symlink {
+			if err := os.Remove(longPath(destPath)); err != nil {
+				return fmt.Errorf("failed to replace %s: %v", destPath, err)
+			}
+		}
+	}
+	if file.symlink {
+		err = moveSymlink(file.Path, destPath, false)
+	} else {
+		err = retryStale(func() error { return os.Rename(longPath(file.Path), longPath(destPath)) })
+		if errors.Is(err, syscall.EXDEV) {
+			err = moveAcross(file.Path, destPath)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move file: %v", err)
+	}
+	runJournal.add(journalOp{Action: ActionMove, Source: file.Path, Dest: destPath, Symlink: file.symlink})
+	turn.landed()
+	return nil
+}
+
+// unmarkEmptied removes the marker from each of the category folders that
+// holds no other file any more, however deep, so they can be pruned.
+func unmarkEmptied(folders map[string]bool) {
+	dirs := make([]string, 0, len(folders))
+	for dir := range folders {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		marker := filepath.Join(dir, folderMarkerName)
+		empty := true
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() && path != marker {
+				empty = false
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if !empty {
+			continue
+		}
+		if os.Remove(longPath(marker)) == nil {
+			runJournal.add(journalOp{Action: opUnmark, Source: marker})
+		}
+	}
+}
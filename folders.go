@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// categorizeFolder categorizes the directory f so it can be moved as a
+// unit. Its size is the total of every file below it, so size conditions
+// on rules apply to the whole folder, and a rule matching the folder
+// itself decides first; otherwise the folder takes the category holding
+// most of its bytes, so an album with a cover image still counts as Audio.
+// rel is the folder's path relative to the organized directory, workers how
+// many subdirectories are read at once, and cache, if set, saves reading
+// the content of unchanged files again. Folders containing excluded paths
+// are refused, as moving them would move the excluded files too, and empty
+// folders get no category.
+func (f *File) categorizeFolder(rel string, exclude *IgnoreList, cache *scanCache, workers int) error {
+	type tally struct {
+		bytes int64
+		files int
+	}
+	tallies := map[string]*tally{}
+	var total int64
+	var mu sync.Mutex // guards tallies and total
+	root := longPath(f.Path)
+	err := walkParallel(root, workers, func(p string, d fs.DirEntry) error {
+		sub, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(rel, filepath.ToSlash(sub))
+		if exclude.Excluded(name, d.IsDir()) {
+			return fmt.Errorf("contains excluded %s", name)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		inner := newFile(shortPath(p), info)
+		cache.fill(name, &inner)
+		inner.Categorize()
+		cache.store(name, inner)
+
+		mu.Lock()
+		defer mu.Unlock()
+		t := tallies[inner.Category]
+		if t == nil {
+			t = &tally{}
+			tallies[inner.Category] = t
+		}
+		t.bytes += inner.Size
+		t.files++
+		total += inner.Size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	f.Size = total
+
+	f.Rule = nil
+	if rule := matchRule(f); rule != nil {
+		f.Rule = rule
+		f.Category = canonicalCategory(rule.Category)
+		return nil
+	}
+
+	categories := make([]string, 0, len(tallies))
+	for category := range tallies {
+		if category != "Other" || len(tallies) == 1 {
+			categories = append(categories, category)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		a, b := tallies[categories[i]], tallies[categories[j]]
+		if a.bytes != b.bytes {
+			return a.bytes > b.bytes
+		}
+		if a.files != b.files {
+			return a.files > b.files
+		}
+		return categories[i] < categories[j]
+	})
+	f.Category = ""
+	if len(categories) > 0 {
+		f.Category = categories[0]
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || windows)
+
+package main
+
+// freeSpace reports the free space on the file system holding path. This
+// platform gives no portable way to tell.
+func freeSpace(path string) (uint64, bool) {
+	return 0, false
+}
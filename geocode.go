@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Geocoder is the config's geocoder section: how the GPS coordinates of a
+// photo are turned into the place it was taken, for .Location. Exactly one
+// of GeoNames and Command is set.
+type Geocoder struct {
+	GeoNames string `yaml:"geonames"` // GeoNames cities file, such as cities15000.txt, searched offline
+	Command  string `yaml:"command"`  // command template printing {"country": ..., "city": ...} for .Latitude and .Longitude
+	Timeout  Age    `yaml:"timeout"`  // time limit for Command, default 1m
+
+	command *template.Template // compiled Command
+
+	once   sync.Once
+	cities map[[2]int][]geoCity // GeoNames cities by whole degrees of latitude and longitude
+	err    error                // why the GeoNames file couldn't be read
+
+	mu     sync.Mutex
+	places map[[2]float64]Location // Command's answers by rounded coordinates
+}
+
+// activeGeocoder is the geocoder from the config, nil for none.
+var activeGeocoder *Geocoder
+
+// Location is the place a photo was taken, as .Location.Country and
+// .Location.City. Both are empty when the photo has no GPS coordinates, no
+// geocoder is set up or it doesn't know the place.
+type Location struct {
+	Country string
+	City    string
+}
+
+// geoCity is one place in a GeoNames file.
+type geoCity struct {
+	name, country string
+	lat, lon      float64
+}
+
+// maxCityDistance is how far, in kilometers, a photo may have been taken
+// from the nearest city in a GeoNames file for it to count as taken there.
+const maxCityDistance = 50
+
+// Location returns where the photo was taken, according to the geocoder.
+func (f File) Location() Location {
+	exif := f.Exif()
+	return readMeta(f, "location", func(path string) any {
+		if !exif.HasGPS || activeGeocoder == nil {
+			return Location{}
+		}
+		loc, err := activeGeocoder.locate(exif.Latitude, exif.Longitude)
+		if err != nil {
+			fmt.Printf("⚠️ %q: failed to look up where it was taken: %v\n", f.Name, err)
+		}
+		return loc
+	}).(Location)
+}
+
+// compile validates the geocoder and compiles its command.
+func (g *Geocoder) compile() error {
+	switch {
+	case (g.GeoNames == "") == (g.Command == ""):
+		return errors.New("geocoder: set either geonames or command")
+	case g.Command != "":
+		tmpl, err := parseDestination(g.Command)
+		if err != nil {
+			return fmt.Errorf("geocoder: invalid command template: %v", err)
+		}
+		g.command = tmpl
+	default:
+		g.GeoNames = expandHome(g.GeoNames)
+	}
+	return nil
+}
+
+// locate returns the place at the coordinates.
+func (g *Geocoder) locate(lat, lon float64) (Location, error) {
+	if g.command != nil {
+		return g.ask(lat, lon)
+	}
+	g.once.Do(func() { g.cities, g.err = loadGeoNames(g.GeoNames) })
+	if g.err != nil {
+		return Location{}, g.err
+	}
+	var best *geoCity
+	bestDist := float64(maxCityDistance)
+	cell := [2]int{int(math.Floor(lat)), int(math.Floor(lon))}
+	for dlat := -1; dlat <= 1; dlat++ {
+		for dlon := -1; dlon <= 1; dlon++ {
+			cities := g.cities[[2]int{cell[0] + dlat, cell[1] + dlon}]
+			for i := range cities {
+				if d := distance(lat, lon, cities[i].lat, cities[i].lon); d <= bestDist {
+					best, bestDist = &cities[i], d
+				}
+			}
+		}
+	}
+	if best == nil {
+		return Location{}, nil
+	}
+	return Location{Country: best.country, City: best.name}, nil
+}
+
+// ask runs the geocoder's command for the coordinates, once for each spot
+// about 10 m across.
+func (g *Geocoder) ask(lat, lon float64) (Location, error) {
+	key := [2]float64{math.Round(lat*1e4) / 1e4, math.Round(lon*1e4) / 1e4}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if loc, ok := g.places[key]; ok {
+		return loc, nil
+	}
+	command, err := renderCommand(g.command, struct{ Latitude, Longitude float64 }{lat, lon})
+	if err != nil {
+		return Location{}, err
+	}
+	timeout := time.Duration(g.Timeout)
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := shellCommand(ctx, command)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Location{}, fmt.Errorf("%v: %s", err, msg)
+		}
+		return Location{}, err
+	}
+	var answer struct {
+		Country string `json:"country"`
+		City    string `json:"city"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &answer); err != nil {
+		return Location{}, fmt.Errorf("the geocoder printed no JSON object: %v", err)
+	}
+	loc := Location{Country: metaText(answer.Country), City: metaText(answer.City)}
+	if g.places == nil {
+		g.places = map[[2]float64]Location{}
+	}
+	g.places[key] = loc
+	return loc, nil
+}
+
+// loadGeoNames reads a GeoNames cities file: tab-separated, with the name
+// in the second column, latitude and longitude in the fifth and sixth and
+// the country code in the ninth.
+func loadGeoNames(path string) (map[[2]int][]geoCity, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cities := map[[2]int][]geoCity{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20) // Alternate names make long lines.
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 9 {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(fields[4], 64)
+		lon, err2 := strconv.ParseFloat(fields[5], 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%s:%d: not a GeoNames cities file", path, line)
+		}
+		cell := [2]int{int(math.Floor(lat)), int(math.Floor(lon))}
+		cities[cell] = append(cities[cell], geoCity{name: metaText(fields[1]), country: metaText(fields[8]), lat: lat, lon: lon})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cities, nil
+}
+
+// distance returns the great-circle distance in kilometers between two
+// points given in degrees.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371
+	rad := math.Pi / 180
+	dlat, dlon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
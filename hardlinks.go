@@ -0,0 +1,29 @@
+package main
+
+import "sync"
+
+// linkGroup ties together the hard links to one file found in a run. They
+// are processed one at a time, and the file's data is copied, compressed or
+// handed to a command only once: later links to a copied or compressed
+// file become hard links to the first result, keeping the relationship.
+// Moves and renames keep it anyway, as they move the name, not the data.
+type linkGroup struct {
+	mu     sync.Mutex
+	first  string // the link processed first
+	output string // the copy or archive made for it, "" if none
+	ran    bool   // whether an exec command has run for the file
+}
+
+// linkGroups hands out the linkGroup for each file with several links.
+type linkGroups struct {
+	groups sync.Map // [2]uint64 -> *linkGroup
+}
+
+// group returns the file's linkGroup, or nil if it has no other links.
+func (g *linkGroups) group(f File) *linkGroup {
+	if !f.linked {
+		return nil
+	}
+	group, _ := g.groups.LoadOrStore(f.linkID, &linkGroup{})
+	return group.(*linkGroup)
+}
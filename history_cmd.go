@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runHistory implements "organizer history": it lists the journaled runs
+// or, with -run, shows what one of them did to each file.
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	runID := fs.String("run", "", "Show the files handled by this run")
+	asJSON := fs.Bool("json", false, "Print the journal entries as JSON lines instead")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer history [-run ID] [-json]")
+		return 2
+	}
+
+	runs, err := listRuns()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	if *runID == "" && !*asJSON {
+		printRuns(runs)
+		return 0
+	}
+	found := false
+	for _, run := range runs {
+		if *runID != "" && run.ID != *runID {
+			continue
+		}
+		found = true
+		if !*asJSON {
+			printRun(run)
+			continue
+		}
+		data, err := os.ReadFile(run.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		os.Stdout.Write(data)
+	}
+	if !found && *runID != "" {
+		fmt.Printf("❌ no journaled run %q; see history\n", *runID)
+		return 1
+	}
+	return 0
+}
+
+// runCounts tallies the outcomes of a run's files.
+type runCounts struct {
+	changes, done, failed, skipped, unfinished int
+}
+
+// counts tallies the run's outcomes. Files planned without an outcome were
+// still being handled when the run was interrupted.
+func (rec runRecord) counts() runCounts {
+	var c runCounts
+	for _, op := range rec.Ops {
+		if op.isChange() {
+			c.changes++
+		}
+	}
+	open := map[string]bool{}
+	for _, e := range rec.Events {
+		switch e.Event {
+		case eventPlan:
+			open[e.Source] = true
+		case eventDone:
+			c.done++
+			delete(open, e.Source)
+		case eventFailed:
+			c.failed++
+			delete(open, e.Source)
+		case eventSkipped:
+			c.skipped++
+		}
+	}
+	c.unfinished = len(open)
+	return c
+}
+
+// status describes how the run ended.
+func (rec runRecord) status() string {
+	switch {
+	case rec.Undone:
+		return "undone"
+	case !rec.Ended:
+		return "interrupted"
+	}
+	return "finished"
+}
+
+// printRuns lists the runs, oldest first, one per line.
+func printRuns(runs []runRecord) {
+	if len(runs) == 0 {
+		fmt.Println("No runs have been journaled")
+		return
+	}
+	for _, run := range runs {
+		c := run.counts()
+		line := fmt.Sprintf("%s  %s  %-11s %d change(s)", run.ID, run.started().Local().Format("2006-01-02 15:04:05"), run.status(), c.changes)
+		if c.failed > 0 {
+			line += fmt.Sprintf(", %d failed", c.failed)
+		}
+		if c.unfinished > 0 {
+			line += fmt.Sprintf(", %d unfinished", c.unfinished)
+		}
+		if len(run.Start.Dirs) > 0 {
+			line += "  " + strings.Join(run.Start.Dirs, ", ")
+		}
+		fmt.Println(line)
+	}
+}
+
+// printRun shows how the run began and what became of each file.
+func printRun(run runRecord) {
+	fmt.Printf("Run %s, %s, %s\n", run.ID, run.started().Local().Format("2006-01-02 15:04:05"), run.status())
+	if run.Start.Event != "" {
+		fmt.Printf("  organizer %s\n", strings.Join(run.Start.Args, " "))
+	}
+	plans := map[string]journalOp{}
+	for _, e := range run.Events {
+		switch e.Event {
+		case eventPlan:
+			plans[e.Source] = e
+		case eventDone:
+			p := plans[e.Source]
+			delete(plans, e.Source)
+			if p.Dest != "" {
+				fmt.Printf("✅ %s %s → %s\n", p.Action, e.Source, p.Dest)
+			} else {
+				fmt.Printf("✅ %s %s\n", p.Action, e.Source)
+			}
+		case eventFailed:
+			delete(plans, e.Source)
+			fmt.Printf("❌ %s: %s\n", e.Source, e.Error)
+		case eventSkipped:
+			fmt.Printf("⚠️ skipped %s: %s\n", e.Source, e.Error)
+		case eventResumed:
+			fmt.Printf("↪️ resumed %s\n", e.Time.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+	for _, e := range run.Events {
+		if p, ok := plans[e.Source]; ok && e.Event == eventPlan {
+			fmt.Printf("⏳ unfinished %s %s\n", p.Action, p.Source)
+		}
+	}
+	c := run.counts()
+	fmt.Printf("%d done, %d failed, %d skipped, %d unfinished\n", c.done, c.failed, c.skipped, c.unfinished)
+}
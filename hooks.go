@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Hook is a command the config runs after a file is moved, copied or
+// compressed into a category.
+type Hook struct {
+	Exec    string `yaml:"exec"`    // command template, e.g. "tesseract {{quote .Dest}} {{quote .Dest}}"
+	Timeout Age    `yaml:"timeout"` // time limit, default 1m
+
+	exec *template.Template // compiled Exec
+}
+
+// Hooks maps category names to the hooks run for files moved into them. It
+// is replaced by the hooks from the config file.
+var Hooks map[string][]Hook
+
+// hookData is what hook templates see: the file's fields as they were
+// before it moved, plus where it is now.
+type hookData struct {
+	File
+	Dest    string // the file's new path, or URL when uploaded
+	DestDir string // the folder it is now in
+}
+
+// compileHooks compiles the exec templates of every category's hooks.
+func compileHooks(hooks map[string][]Hook) error {
+	for category, list := range hooks {
+		for i := range list {
+			h := &list[i]
+			if h.Exec == "" {
+				return fmt.Errorf("hook %d for %s: exec is required", i+1, category)
+			}
+			tmpl, err := parseDestination(h.Exec)
+			if err != nil {
+				return fmt.Errorf("hook %d for %s: invalid exec template: %v", i+1, category, err)
+			}
+			h.exec = tmpl
+		}
+	}
+	return nil
+}
+
+// hooksFor returns the hooks for the file's category, or for the category
+// it is an alias of.
+func hooksFor(category string) []Hook {
+	if hooks, ok := Hooks[category]; ok {
+		return hooks
+	}
+	return Hooks[canonicalCategory(category)]
+}
+
+// runHooks runs the hooks of the file's category now that it is at dest.
+// A failing hook is reported but doesn't undo the move, and the hooks
+// after it still run.
+func runHooks(file File, dest string, dryRun bool) {
+	data := hookData{File: file, Dest: dest, DestDir: filepath.Dir(dest)}
+	if isRemoteURL(dest) {
+		// Uploaded; dest is its URL.
+		data.DestDir = dest[:strings.LastIndexByte(dest, '/')]
+	} else if abs, err := filepath.Abs(dest); err == nil {
+		data.Dest, data.DestDir = abs, filepath.Dir(abs)
+	}
+	for _, h := range hooksFor(file.Category) {
+		command, err := renderCommand(h.exec, data)
+		if err != nil {
+			fmt.Printf("❌ Hook for %q: %v\n", file.Name, err)
+			continue
+		}
+		if dryRun {
+			fmt.Printf("Would run hook for %q: %s\n", file.Name, command)
+			continue
+		}
+		output, err := runCommand(command, time.Duration(h.Timeout))
+		printCommandOutput(file.Name, output)
+		if err != nil {
+			fmt.Printf("❌ Hook %q failed for %q: %v\n", command, file.Name, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignorePattern is one compiled gitignore-style pattern.
+type ignorePattern struct {
+	text    string
+	re      *regexp.Regexp
+	negate  bool // "!pattern" re-includes a previously excluded path
+	dirOnly bool // "pattern/" only matches directories
+}
+
+// IgnoreList matches slash-separated paths, relative to the organized
+// directory, against gitignore-style patterns:
+//
+//	*.iso          any .iso file at any depth
+//	node_modules/  any directory named node_modules (and its contents)
+//	/build         only build at the top level
+//	important/**   everything below important
+//	!keep.iso      re-include a path excluded by an earlier pattern
+//
+// As in git, the last matching pattern decides, and a path inside an
+// excluded directory cannot be re-included.
+type IgnoreList struct {
+	patterns []ignorePattern
+}
+
+// parseIgnorePatterns compiles patterns. Blank lines and lines starting
+// with # are ignored so the lines of an ignore file can be passed directly.
+func parseIgnorePatterns(patterns []string) (*IgnoreList, error) {
+	l := &IgnoreList{}
+	for _, p := range patterns {
+		if err := l.add(p); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// add compiles a single pattern and appends it to the list.
+func (l *IgnoreList) add(pattern string) error {
+	text := strings.TrimRight(pattern, " \r")
+	if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+		return nil
+	}
+	p := ignorePattern{text: text}
+	if strings.HasPrefix(text, "!") {
+		p.negate = true
+		text = text[1:]
+	} else if strings.HasPrefix(text, `\`) {
+		text = text[1:] // "\!name" or "\#name" match literally
+	}
+	if strings.HasSuffix(text, "/") {
+		p.dirOnly = true
+		text = strings.TrimRight(text, "/")
+	}
+	// A slash at the start or in the middle anchors the pattern to the root.
+	anchored := strings.Contains(text, "/")
+	text = strings.TrimPrefix(text, "/")
+	if text == "" {
+		return fmt.Errorf("invalid exclude pattern %q", pattern)
+	}
+
+	expr, err := ignoreRegexp(text)
+	if err != nil {
+		return fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+	}
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid exclude pattern %q: %v", pattern, err)
+	}
+	p.re = re
+	l.patterns = append(l.patterns, p)
+	return nil
+}
+
+// ignoreRegexp translates a glob with ** support into a regular expression.
+func ignoreRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// Len returns the number of patterns in the list.
+func (l *IgnoreList) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.patterns)
+}
+
+// match reports whether the last pattern matching rel excludes it.
+func (l *IgnoreList) match(rel string, isDir bool) bool {
+	excluded := false
+	for _, p := range l.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// Excluded reports whether the slash-separated path rel, relative to the
+// organized directory, is excluded either directly or through one of its
+// parent directories. A nil list excludes nothing.
+func (l *IgnoreList) Excluded(rel string, isDir bool) bool {
+	if l.Len() == 0 {
+		return false
+	}
+	rel = strings.TrimPrefix(path.Clean(rel), "./")
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if l.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return l.match(rel, isDir)
+}
+
+// loadIgnoreFile parses a gitignore-style file. A missing file yields an
+// empty list.
+func loadIgnoreFile(filename string) (*IgnoreList, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return &IgnoreList{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIgnorePatterns(strings.Split(string(data), "\n"))
+}
+
+// merge returns a list that applies l's patterns followed by other's.
+func (l *IgnoreList) merge(other *IgnoreList) *IgnoreList {
+	merged := &IgnoreList{}
+	if l != nil {
+		merged.patterns = append(merged.patterns, l.patterns...)
+	}
+	if other != nil {
+		merged.patterns = append(merged.patterns, other.patterns...)
+	}
+	return merged
+}
+
+// excludeFor compiles command-line exclude patterns for the organized
+// directory dir. Besides gitignore-style patterns they may name a path,
+// such as ~/Downloads/keep/, which only applies when it lies inside dir.
+func excludeFor(patterns []string, dir string) (*IgnoreList, error) {
+	l := &IgnoreList{}
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		p := expandHome(strings.TrimPrefix(pattern, "!"))
+		if filepath.IsAbs(p) {
+			root, err := filepath.Abs(dir)
+			if err != nil {
+				return nil, err
+			}
+			rel, err := filepath.Rel(root, filepath.Clean(p))
+			if err != nil || rel == "." || !isWithin(filepath.Clean(p), root) {
+				continue // Outside this directory.
+			}
+			p = "/" + filepath.ToSlash(rel)
+			if strings.HasSuffix(pattern, "/") || strings.HasSuffix(pattern, string(filepath.Separator)) {
+				p += "/"
+			}
+		}
+		if negate {
+			p = "!" + p
+		}
+		if err := l.add(p); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
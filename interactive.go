@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// interactive holds -interactive: each file's action is confirmed before
+// it is carried out.
+var interactive bool
+
+// confirmation is where an -interactive run stands: answering "a" accepts
+// every file after, "q" declines them.
+var confirmation struct {
+	mu        sync.Mutex
+	all, quit bool
+}
+
+// confirmFile asks whether to carry out the planned file's action, and
+// reports whether to go ahead. For files moved into a folder, "e" asks for
+// another destination folder, relative to the organized directory, and
+// updates p.rel. Without an answer, such as at the end of input, the rest
+// of the run is declined.
+func confirmFile(p *plannedFile) bool {
+	confirmation.mu.Lock()
+	defer confirmation.mu.Unlock()
+	if confirmation.quit {
+		return false
+	}
+	if confirmation.all {
+		return true
+	}
+	f := p.file
+	action := fileAction(f)
+	var question string
+	switch action {
+	case ActionSkip:
+		return true
+	case ActionMove, ActionCopy, ActionCompress, ActionArchive:
+		question = fmt.Sprintf("%s %s → %s?", action, f.Name, filepath.ToSlash(p.rel))
+	case ActionRename:
+		name, err := renderName(f.Rule.rename, f)
+		if err != nil {
+			return true // Fails when processed.
+		}
+		question = fmt.Sprintf("rename %s → %s?", f.Name, name)
+	case ActionExec:
+		command, err := renderCommand(f.Rule.exec, f)
+		if err != nil {
+			return true
+		}
+		question = fmt.Sprintf("run %s for %s?", command, f.Name)
+	default:
+		question = fmt.Sprintf("%s %s?", action, f.Name)
+	}
+	movable := action == ActionMove || action == ActionCopy || action == ActionCompress
+	for {
+		if movable {
+			fmt.Printf("❓ %s [y/n/a/q/e(dit)] ", question)
+		} else {
+			fmt.Printf("❓ %s [y/n/a/q] ", question)
+		}
+		line, err := stdin.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		case "a", "all":
+			confirmation.all = true
+			return true
+		case "q", "quit":
+			confirmation.quit = true
+			return false
+		case "e", "edit":
+			if !movable {
+				continue
+			}
+			fmt.Print("   Destination folder: ")
+			line, err = stdin.ReadString('\n')
+			rel := strings.TrimSpace(line)
+			if rel == "" {
+				continue
+			}
+			if err := checkCategoryName(rel); err != nil {
+				fmt.Printf("⚠️ %v\n", err)
+				continue
+			}
+			p.rel = filepath.Clean(filepath.FromSlash(rel))
+			question = fmt.Sprintf("%s %s → %s?", action, f.Name, filepath.ToSlash(p.rel))
+			continue
+		}
+		if err != nil {
+			fmt.Println()
+			confirmation.quit = true
+			return false
+		}
+	}
+}
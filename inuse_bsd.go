@@ -0,0 +1,26 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// openFileChecker returns a function reporting whether a file is locked by
+// another process, by trying to take an exclusive lock without waiting.
+// Files that are merely open, without a lock, are not detected.
+func openFileChecker() func(File) bool {
+	return func(f File) bool {
+		fh, err := os.Open(f.Path)
+		if err != nil {
+			return false
+		}
+		defer fh.Close()
+		if err := syscall.Flock(int(fh.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			return err == syscall.EWOULDBLOCK
+		}
+		syscall.Flock(int(fh.Fd()), syscall.LOCK_UN)
+		return false
+	}
+}
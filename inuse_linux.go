@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// fileID identifies a file independently of the path used to reach it.
+type fileID struct {
+	dev, ino uint64
+}
+
+// openFileChecker returns a function reporting whether a file is open or
+// locked by another process. Open files are found through /proc/*/fd (for
+// the processes we may inspect) and locks through /proc/locks, both read
+// once so checking many files stays cheap.
+func openFileChecker() func(File) bool {
+	open := map[fileID]bool{}
+	self := strconv.Itoa(os.Getpid())
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if strings.HasPrefix(fd, "/proc/"+self+"/") {
+			continue
+		}
+		info, err := os.Stat(fd)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			open[fileID{uint64(st.Dev), st.Ino}] = true
+		}
+	}
+	locked := readLocks("/proc/locks")
+
+	return func(f File) bool {
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			return false
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return false
+		}
+		dev := uint64(st.Dev)
+		major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+		minor := dev&0xff | (dev>>12)&^0xff
+		return open[fileID{dev, st.Ino}] || locked[lockKey(major, minor, st.Ino)]
+	}
+}
+
+// lockKey formats a device and inode the way /proc/locks does.
+func lockKey(major, minor, ino uint64) string {
+	return strconv.FormatUint(major, 16) + ":" + strconv.FormatUint(minor, 16) + ":" + strconv.FormatUint(ino, 10)
+}
+
+// readLocks returns the files with advisory locks held by other processes.
+// Lines look like "1: POSIX  ADVISORY  WRITE 1234 08:01:5678 0 EOF".
+func readLocks(path string) map[string]bool {
+	locked := map[string]bool{}
+	f, err := os.Open(path)
+	if err != nil {
+		return locked
+	}
+	defer f.Close()
+	pid := strconv.Itoa(os.Getpid())
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] == "->" || fields[4] == pid {
+			continue // "->" marks a waiter, not a holder
+		}
+		parts := strings.Split(fields[5], ":")
+		if len(parts) != 3 {
+			continue
+		}
+		major, err1 := strconv.ParseUint(parts[0], 16, 64)
+		minor, err2 := strconv.ParseUint(parts[1], 16, 64)
+		ino, err3 := strconv.ParseUint(parts[2], 10, 64)
+		if err1 == nil && err2 == nil && err3 == nil {
+			locked[lockKey(major, minor, ino)] = true
+		}
+	}
+	return locked
+}
@@ -0,0 +1,24 @@
+package main
+
+import "syscall"
+
+// errorSharingViolation is ERROR_SHARING_VIOLATION: another process has the
+// file open without allowing others to share it.
+const errorSharingViolation syscall.Errno = 32
+
+// openFileChecker returns a function reporting whether a file is open in
+// another process, by trying to open it without sharing.
+func openFileChecker() func(File) bool {
+	return func(f File) bool {
+		name, err := syscall.UTF16PtrFromString(longPath(f.Path))
+		if err != nil {
+			return false
+		}
+		h, err := syscall.CreateFile(name, syscall.GENERIC_READ, 0, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+		if err != nil {
+			return err == errorSharingViolation
+		}
+		syscall.CloseHandle(h)
+		return false
+	}
+}
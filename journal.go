@@ -0,0 +1,738 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// atomicRun holds -atomic: a run either organizes everything or, when
+// anything fails, puts back what it had already done.
+var atomicRun bool
+
+// runJournal journals the current run; it is nil for dry runs, and its
+// methods then do nothing.
+var runJournal *journal
+
+// journalOp is one line of a run's journal file: a completed step, with
+// what is needed to reverse it, or with Event set, something else that
+// happened during the run.
+type journalOp struct {
+	Run      string    `json:"run,omitempty"`
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event,omitempty"` // one of the event* constants, "" for a step
+	Action   Action    `json:"action,omitempty"`
+	Source   string    `json:"source,omitempty"`   // where the file was
+	Dest     string    `json:"dest,omitempty"`     // where it went; a created folder for opMkdir
+	Symlink  bool      `json:"symlink,omitempty"`  // the file was a symbolic link, moved as a link
+	Backup   string    `json:"backup,omitempty"`   // for opReplace, where the replaced file was set aside
+	Error    string    `json:"error,omitempty"`    // for eventFailed and eventSkipped, what happened
+	Original string    `json:"original,omitempty"` // with -sanitize-names, the name before it was sanitized
+	Trash    string    `json:"trash,omitempty"`    // for ActionDelete, where the trash keeps the file
+	Member   string    `json:"member,omitempty"`   // for ActionArchive, the file's name in the archive
+	SHA256   string    `json:"sha256,omitempty"`   // for ActionCompress, the checksum of the original; for ActionExtract, see folderDigest
+
+	// For eventPlan, what resume needs to carry out the plan as decided.
+	Root    string        `json:"root,omitempty"`    // the directory destinations are relative to
+	Unit    bool          `json:"unit,omitempty"`    // a folder moved as a unit
+	Command string        `json:"command,omitempty"` // for exec, the rendered command
+	Timeout time.Duration `json:"timeout,omitempty"` // for exec, its time limit
+
+	// For eventStart.
+	Args     []string          `json:"args,omitempty"`     // the command line
+	Dirs     []string          `json:"dirs,omitempty"`     // the directories organized
+	Settings map[string]string `json:"settings,omitempty"` // flags that shape the plan's execution
+	Atomic   bool              `json:"atomic,omitempty"`   // -atomic
+}
+
+// Steps journaled besides the actions themselves.
+const (
+	opMkdir      Action = "mkdir"       // a folder the run created
+	opMarker     Action = "marker"      // a folder marker the run wrote
+	opReplace    Action = "replace"     // an existing file was replaced
+	opRmdir      Action = "rmdir"       // a folder the run emptied and removed, see -prune-empty
+	opUnmark     Action = "unmark"      // a folder marker the run removed, see runFlatten
+	opNewArchive Action = "new-archive" // an archive the run created, see ActionArchive
+	opLink       Action = "link"        // a duplicate replaced with a link, see runDedup
+)
+
+// Events journaled besides the steps.
+const (
+	eventStart   = "start"   // the run began
+	eventResumed = "resumed" // "organizer resume" took the run up again
+	eventPlan    = "plan"    // a file's action and destination were decided
+	eventDone    = "done"    // the file was handled
+	eventFailed  = "failed"  // the file, or a whole directory, failed
+	eventSkipped = "skipped" // the file was left alone, see Skip
+	eventEnd     = "end"     // the run finished; without it, it was interrupted
+	eventUndone  = "undone"  // the run was rolled back or undone
+)
+
+// journal records what a run has done, in memory so -atomic can roll it
+// back and on disk so "organizer undo" can later. With -atomic, deletions,
+// including the originals of compressed files, wait until the run commits,
+// so rolling back never has to recreate a file's contents.
+type journal struct {
+	mu      sync.Mutex
+	run     string // the run ID, also the journal file's name
+	atomic  bool
+	start   journalOp // written ahead of the first entry
+	ops     []journalOp
+	planned map[string]bool // sources with a plan entry
+	removes []journalOp     // with atomic, deletions to carry out on commit
+	failed  bool
+	file    *os.File // opened with the first entry, so idle runs leave none
+	fileErr error
+}
+
+// journalDir returns where run journals are kept:
+// $XDG_STATE_HOME/go-file-organizer/journal, by default under
+// ~/.local/state, or "" if there is no home directory.
+func journalDir() string {
+	if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" && filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, configDirName, "journal")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "state", configDirName, "journal")
+}
+
+// newJournal starts the journal of a run over dirs. Run IDs sort by start
+// time.
+func newJournal(dirs []string, atomic bool) *journal {
+	now := time.Now()
+	j := &journal{
+		run:     fmt.Sprintf("%s-%d", now.Format("20060102-150405"), os.Getpid()),
+		atomic:  atomic,
+		planned: map[string]bool{},
+	}
+	j.start = journalOp{Run: j.run, Time: now.UTC(), Event: eventStart, Args: os.Args[1:], Atomic: atomic, Settings: currentSettings()}
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		j.start.Dirs = append(j.start.Dirs, dir)
+	}
+	return j
+}
+
+// currentSettings returns the flags that shape how a plan is carried out,
+// for resume and apply to restore with applySettings.
+func currentSettings() map[string]string {
+	s := map[string]string{
+		"mode":             runMode,
+		"on-conflict":      onConflict,
+		"conflict-suffix":  conflictSuffix,
+		"normalize-names":  normalizeNames,
+		"sanitize-names":   strconv.FormatBool(sanitizeNames),
+		"trash":            strconv.FormatBool(useTrash),
+		"trash-duplicates": strconv.FormatBool(trashDuplicates),
+		"prune-empty":      strconv.FormatBool(pruneEmpty),
+		"extract-limit":    strconv.FormatInt(int64(extractLimit), 10),
+		"shard-limit":      strconv.Itoa(shardLimit),
+	}
+	if remoteDest != nil {
+		s["remote-dest"] = remoteDest.url(remoteRoot)
+	}
+	return s
+}
+
+// applySettings puts back the flags currentSettings returned.
+func applySettings(s map[string]string) error {
+	runMode, onConflict, conflictSuffix, normalizeNames = s["mode"], s["on-conflict"], s["conflict-suffix"], s["normalize-names"]
+	sanitizeNames = s["sanitize-names"] == "true"
+	useTrash, trashDuplicates = s["trash"] != "false", s["trash-duplicates"] == "true"
+	pruneEmpty = s["prune-empty"] == "true"
+	if runMode == "" {
+		runMode = ModeMove
+	}
+	if onConflict == "" {
+		onConflict = ConflictRename
+	}
+	if conflictSuffix == "" {
+		conflictSuffix = SuffixCounter
+	}
+	shardLimit = defaultShardLimit
+	if limit, err := strconv.Atoi(s["shard-limit"]); err == nil {
+		shardLimit = limit
+	}
+	extractLimit = defaultExtractLimit
+	if limit := s["extract-limit"]; limit != "" {
+		if err := extractLimit.Set(limit); err != nil {
+			return err
+		}
+	}
+	if dest := s["remote-dest"]; dest != "" {
+		if err := setRemoteDest(dest); err != nil {
+			return fmt.Errorf("cannot reach %s: %v", dest, err)
+		}
+	}
+	return nil
+}
+
+// resumeJournal takes up the interrupted run rec again, appending to its
+// journal file. A line cut short when the run was killed is dropped first
+// so the entries that follow can be read back.
+func resumeJournal(rec runRecord) (*journal, error) {
+	data, err := os.ReadFile(rec.Path)
+	if err != nil {
+		return nil, err
+	}
+	if n := bytes.LastIndexByte(data, '\n') + 1; n < len(data) {
+		if err := os.Truncate(rec.Path, int64(n)); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(rec.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{run: rec.ID, start: rec.Start, ops: rec.Ops, planned: map[string]bool{}, file: f}
+	for _, e := range rec.Events {
+		if e.Event == eventPlan {
+			j.planned[e.Source] = true
+		}
+	}
+	j.add(journalOp{Event: eventResumed})
+	return j, nil
+}
+
+// deferring reports whether deletions and replaced files wait for the run
+// to commit.
+func (j *journal) deferring() bool {
+	return j != nil && j.atomic
+}
+
+// add records a completed step, or an event, and appends it to the
+// journal file.
+func (j *journal) add(op journalOp) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	op.Run, op.Time = j.run, time.Now().UTC()
+	// Undo may run from anywhere.
+	op.absolutize()
+	if op.Event == "" {
+		j.ops = append(j.ops, op)
+	}
+	j.write(op)
+}
+
+// absolutize makes the op's paths absolute. URLs of uploads are left as
+// they are.
+func (op *journalOp) absolutize() {
+	for _, p := range []*string{&op.Source, &op.Dest, &op.Backup, &op.Root} {
+		if isRemoteURL(*p) {
+			continue
+		}
+		if abs, err := filepath.Abs(*p); *p != "" && err == nil {
+			*p = abs
+		}
+	}
+}
+
+// planAll journals what is to be done with each file, before anything is,
+// with rename targets and commands rendered so a resumed run doesn't
+// decide again. Directories, skipped files and files that can't be
+// organized have no plan.
+func (j *journal) planAll(plans []plannedFile) {
+	for _, p := range plans {
+		if op, ok := planOp(p); ok {
+			j.addPlan(op)
+		}
+	}
+}
+
+// addPlan journals a plan planOp returned.
+func (j *journal) addPlan(op journalOp) {
+	if j == nil {
+		return
+	}
+	j.add(op)
+	j.mu.Lock()
+	j.planned[op.Source] = true
+	j.mu.Unlock()
+}
+
+// planOp returns the plan event for the planned file, and false if there
+// is nothing to plan.
+func planOp(p plannedFile) (journalOp, bool) {
+	f := p.file
+	action := fileAction(f)
+	if p.err != nil || p.rel == "" || action == ActionSkip {
+		return journalOp{}, false
+	}
+	op := journalOp{Event: eventPlan, Action: action, Source: f.Path, Root: f.baseDir(), Unit: f.unit, Symlink: f.symlink && action != ActionCompress}
+	switch action {
+	case ActionMove, ActionCopy, ActionCompress:
+		name, err := movedName(f)
+		if err != nil {
+			return journalOp{}, false // Fails when processed.
+		}
+		if action == ActionCompress {
+			name += compressedExt(compression(f))
+		}
+		op.Dest = filepath.Join(f.baseDir(), p.rel, name)
+	case ActionArchive:
+		op.Dest = filepath.Join(f.baseDir(), p.rel, archiveName(f))
+	case ActionRename:
+		if name, err := renderName(f.Rule.rename, f); err == nil {
+			op.Dest = filepath.Join(filepath.Dir(f.Path), name)
+		}
+	case ActionExec:
+		op.Command, _ = renderCommand(f.Rule.exec, f)
+		op.Timeout = time.Duration(f.Rule.Timeout)
+	}
+	return op, true
+}
+
+// outcome records how handling the file ended. Files that failed are
+// always recorded, and fail the run, the rest only once something was
+// planned for them.
+func (j *journal) outcome(f File, err error) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	planned := j.planned[f.Path]
+	j.mu.Unlock()
+	switch {
+	case err != nil:
+		j.add(journalOp{Event: eventFailed, Source: f.Path, Error: err.Error()})
+		j.fail()
+	case planned:
+		j.add(journalOp{Event: eventDone, Source: f.Path})
+	}
+}
+
+// dirFailed records that the directory couldn't be organized.
+func (j *journal) dirFailed(dir string, err error) {
+	j.add(journalOp{Event: eventFailed, Source: dir, Error: err.Error()})
+	j.fail()
+}
+
+// skipped records the entries the run left alone. They are journaled only
+// for runs that did something.
+func (j *journal) skipped(skips []Skip) {
+	if j == nil || j.file == nil {
+		return
+	}
+	for _, s := range skips {
+		j.add(journalOp{Event: eventSkipped, Source: filepath.Join(s.Dir, filepath.FromSlash(s.Path)), Error: s.Reason + ": " + s.Detail})
+	}
+}
+
+// write appends op to the journal file, creating it on first use. A
+// journal that can't be written is reported once and the run goes on.
+// j.mu must be held.
+func (j *journal) write(op journalOp) {
+	if j.file == nil && j.fileErr == nil {
+		dir := journalDir()
+		if dir == "" {
+			j.fileErr = errors.New("no home directory")
+		} else if j.fileErr = os.MkdirAll(dir, 0755); j.fileErr == nil {
+			j.file, j.fileErr = os.OpenFile(filepath.Join(dir, j.run+".jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		}
+		if j.fileErr != nil {
+			fmt.Printf("⚠️ Not journaling this run, it can't be undone later: %v\n", j.fileErr)
+		} else {
+			j.writeLine(j.start)
+		}
+	}
+	if j.file != nil {
+		j.writeLine(op)
+	}
+}
+
+// writeLine appends op to the open journal file. j.mu must be held.
+func (j *journal) writeLine(op journalOp) {
+	data, err := json.Marshal(op)
+	if err == nil {
+		_, err = j.file.Write(append(data, '\n'))
+	}
+	if err != nil && j.fileErr == nil {
+		j.fileErr = err
+		fmt.Printf("⚠️ Failed to write the journal: %v\n", err)
+	}
+}
+
+// remove schedules path to be deleted when the run commits. Deletions
+// by the delete action are journaled; the originals of compressed files
+// are restored from the archive.
+func (j *journal) remove(path string, action Action) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.removes = append(j.removes, journalOp{Action: action, Source: path})
+}
+
+// fail marks the run as failed; with -atomic no further files are
+// processed.
+func (j *journal) fail() {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.failed = true
+}
+
+// stopped reports whether an -atomic run has failed and is going to be
+// rolled back.
+func (j *journal) stopped() bool {
+	if !j.deferring() {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.failed
+}
+
+// mkdirAll creates dir like os.MkdirAll, journaling each folder it creates.
+func (j *journal) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; j != nil; d = filepath.Dir(d) {
+		if _, err := os.Lstat(longPath(d)); !errors.Is(err, fs.ErrNotExist) || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := retryStale(func() error { return os.MkdirAll(longPath(dir), 0755) }); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		j.add(journalOp{Action: opMkdir, Dest: missing[i]})
+	}
+	return nil
+}
+
+// setAside moves the file at destPath, about to be replaced, out of the
+// way so a rollback can restore it. Commit deletes it. A path replaced
+// more than once in the run gets a backup for each time.
+func (j *journal) setAside(destPath string) error {
+	backup := filepath.Join(filepath.Dir(destPath), "."+filepath.Base(destPath)+".organizer-backup")
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(longPath(backup)); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		backup = filepath.Join(filepath.Dir(destPath), fmt.Sprintf(".%s.organizer-backup-%d", filepath.Base(destPath), i))
+	}
+	if err := os.Rename(longPath(destPath), longPath(backup)); err != nil {
+		return err
+	}
+	j.add(journalOp{Action: opReplace, Dest: destPath, Backup: backup})
+	return nil
+}
+
+// finish ends the run: an -atomic run that failed is rolled back,
+// otherwise the deletions it put off are carried out and the backups of
+// replaced files dropped.
+func (j *journal) finish() {
+	if j == nil {
+		return
+	}
+	defer func() {
+		if j.file != nil {
+			j.add(journalOp{Event: eventEnd})
+			j.file.Close()
+		}
+	}()
+	if !j.atomic {
+		return
+	}
+	if j.failed {
+		undone, errs := undoOps(j.ops)
+		j.add(journalOp{Event: eventUndone})
+		fmt.Printf("↩️ Something failed, so the run was rolled back: %d change(s) undone\n", undone)
+		for _, err := range errs {
+			fmt.Printf("❌ Rollback: %v\n", err)
+		}
+		return
+	}
+	for _, op := range j.removes {
+		var err error
+		if op.Action == ActionDelete {
+			op.Trash, err = deleteFile(op.Source)
+		} else {
+			err = retryStale(func() error { return os.Remove(longPath(op.Source)) })
+		}
+		if err != nil {
+			fmt.Printf("❌ failed to delete %s: %v\n", op.Source, err)
+			continue
+		}
+		if op.Action == ActionDelete {
+			j.add(op)
+		}
+	}
+	for _, op := range j.ops {
+		if op.Action == opReplace && op.Backup != "" {
+			if err := os.Remove(longPath(op.Backup)); err != nil {
+				fmt.Printf("❌ failed to remove the replaced %s: %v\n", op.Dest, err)
+			}
+		}
+	}
+}
+
+// undoOps reverses the steps, newest first, and returns how many changes
+// were undone. It carries on past failures and returns them all.
+func undoOps(ops []journalOp) (int, []error) {
+	var errs []error
+	undone := 0
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		if err := op.undo(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if op.isChange() {
+			undone++
+		}
+	}
+	return undone, errs
+}
+
+// isChange reports whether the step changed a file, rather than making a
+// folder or marker along the way.
+func (op journalOp) isChange() bool {
+	return op.Action != opMkdir && op.Action != opMarker && op.Action != opReplace && op.Action != opRmdir && op.Action != opUnmark && op.Action != opNewArchive
+}
+
+// undo reverses the step. Nothing is overwritten: a file that has since
+// appeared where another is to go back stops that step.
+func (op journalOp) undo() error {
+	gone := func(p string) bool {
+		_, err := os.Lstat(longPath(p))
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	if isRemoteURL(op.Dest) {
+		return op.undoRemote()
+	}
+	switch op.Action {
+	case opMkdir:
+		// Only folders left empty go.
+		if err := os.Remove(longPath(op.Dest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove folder %s: %v", op.Dest, err)
+		}
+		return nil
+	case opRmdir:
+		if err := os.Mkdir(longPath(op.Source), 0755); err != nil && !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("failed to recreate folder %s: %v", op.Source, err)
+		}
+		return nil
+	case opLink:
+		// Made a copy of the kept file again, unless it was changed since.
+		if dest, err := os.Lstat(longPath(op.Dest)); err == nil {
+			if op.Symlink && dest.Mode()&os.ModeSymlink == 0 {
+				return fmt.Errorf("%s is no longer a link", op.Dest)
+			} else if src, err := os.Stat(longPath(op.Source)); !op.Symlink && (err != nil || !os.SameFile(src, dest)) {
+				return fmt.Errorf("%s is no longer a link to %s", op.Dest, op.Source)
+			}
+		}
+		tmp := filepath.Join(filepath.Dir(op.Dest), "."+filepath.Base(op.Dest)+".organizer-tmp")
+		if err := copyFile(op.Source, tmp); err != nil {
+			return fmt.Errorf("failed to restore %s from %s: %v", op.Dest, op.Source, err)
+		}
+		if err := os.Rename(longPath(tmp), longPath(op.Dest)); err != nil {
+			os.Remove(longPath(tmp))
+			return fmt.Errorf("failed to restore %s: %v", op.Dest, err)
+		}
+		return nil
+	case opUnmark:
+		if err := os.WriteFile(longPath(op.Source), []byte(folderMarkerText), 0644); err != nil {
+			return fmt.Errorf("failed to restore the marker %s: %v", op.Source, err)
+		}
+		return nil
+	case opMarker:
+		markedFolders.Delete(filepath.Dir(op.Dest))
+	case opReplace:
+		if op.Backup == "" || gone(op.Backup) {
+			return fmt.Errorf("the file replaced at %s cannot be restored", op.Dest)
+		}
+		// Whatever the run left in its place, if anything, goes first.
+		if err := os.Remove(longPath(op.Dest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to restore the replaced %s: %v", op.Dest, err)
+		}
+		if err := os.Rename(longPath(op.Backup), longPath(op.Dest)); err != nil {
+			return fmt.Errorf("failed to restore the replaced %s: %v", op.Dest, err)
+		}
+		return nil
+	case ActionDelete:
+		if op.Trash == "" {
+			return fmt.Errorf("the deleted %s cannot be restored", op.Source)
+		}
+		if !gone(op.Source) {
+			return fmt.Errorf("cannot take %s out of the trash: %s already exists", op.Trash, op.Source)
+		}
+		if err := systemTrash.restore(op.Trash, op.Source); err != nil {
+			return fmt.Errorf("failed to take %s out of the trash: %v", op.Source, err)
+		}
+		return nil
+	case ActionExec:
+		return fmt.Errorf("the command run for %s cannot be undone", op.Source)
+	case ActionMove, ActionRename:
+		if !gone(op.Source) {
+			return fmt.Errorf("cannot move %s back: %s already exists", op.Dest, op.Source)
+		}
+		var err error
+		switch {
+		case op.Symlink:
+			err = moveSymlink(op.Dest, op.Source, false)
+		default:
+			err = retryStale(func() error { return os.Rename(longPath(op.Dest), longPath(op.Source)) })
+			if errors.Is(err, syscall.EXDEV) {
+				err = moveAcross(op.Dest, op.Source)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move %s back to %s: %v", op.Dest, op.Source, err)
+		}
+		return nil
+	case ActionExtract:
+		// The archive comes back with the delete journaled after this, and
+		// until it has, the folder is the only copy of its contents.
+		if gone(op.Source) {
+			return fmt.Errorf("cannot remove %s: the archive %s it was extracted from is gone", op.Dest, op.Source)
+		}
+		if op.SHA256 != "" {
+			if digest, err := folderDigest(op.Dest); err == nil && digest != op.SHA256 {
+				return fmt.Errorf("cannot remove %s: it has changed since it was extracted from %s", op.Dest, op.Source)
+			}
+		}
+		if err := os.RemoveAll(longPath(op.Dest)); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", op.Dest, err)
+		}
+		return nil
+	case ActionArchive:
+		// The archive stays; it may hold other files.
+		if gone(op.Source) {
+			if err := extractMember(op.Dest, op.Member, op.Source); err != nil {
+				return fmt.Errorf("failed to restore %s from %s: %v", op.Source, op.Dest, err)
+			}
+		}
+		return nil
+	case ActionCompress:
+		if gone(op.Source) {
+			// The original was removed after compressing; unpack it again.
+			if err := decompressFile(op.Dest, op.Source); err != nil {
+				return fmt.Errorf("failed to restore %s from %s: %v", op.Source, op.Dest, err)
+			}
+		}
+	}
+	// Copies, links, clones, archives and markers are simply removed.
+	if err := os.Remove(longPath(op.Dest)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %v", op.Dest, err)
+	}
+	return nil
+}
+
+// runRecord is a journaled run as read back from its file.
+type runRecord struct {
+	ID     string
+	Path   string
+	Start  journalOp   // zero if the start wasn't journaled
+	Ops    []journalOp // completed steps, oldest first
+	Events []journalOp // plans, outcomes and errors, oldest first
+	Ended  bool
+	Undone bool
+}
+
+// readRun reads the journal file at path.
+func readRun(path string) (runRecord, error) {
+	rec := runRecord{ID: strings.TrimSuffix(filepath.Base(path), ".jsonl"), Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var op journalOp
+		if err := json.Unmarshal(sc.Bytes(), &op); err != nil {
+			// A run killed mid-write may leave a partial last line.
+			return rec, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		switch op.Event {
+		case "":
+			rec.Ops = append(rec.Ops, op)
+		case eventStart:
+			rec.Start = op
+		case eventEnd:
+			rec.Ended = true
+		case eventUndone:
+			rec.Undone = true
+		default:
+			rec.Events = append(rec.Events, op)
+		}
+	}
+	return rec, sc.Err()
+}
+
+// started returns when the run began.
+func (rec runRecord) started() time.Time {
+	switch {
+	case !rec.Start.Time.IsZero():
+		return rec.Start.Time
+	case len(rec.Ops) > 0:
+		return rec.Ops[0].Time
+	case len(rec.Events) > 0:
+		return rec.Events[0].Time
+	}
+	return time.Time{}
+}
+
+// markUndone appends to the run's journal that it has been undone.
+func (rec runRecord) markUndone() error {
+	f, err := os.OpenFile(rec.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(journalOp{Run: rec.ID, Time: time.Now().UTC(), Event: eventUndone})
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// listRuns returns the journaled runs, oldest first.
+func listRuns() ([]runRecord, error) {
+	dir := journalDir()
+	if dir == "" {
+		return nil, errors.New("no home directory for the journal")
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var runs []runRecord
+	for _, path := range paths {
+		rec, err := readRun(path)
+		if err != nil && rec.Start.Event == "" && len(rec.Ops) == 0 {
+			fmt.Printf("⚠️ Ignoring journal %s: %v\n", path, err)
+			continue
+		}
+		runs = append(runs, rec)
+	}
+	return runs, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// runLimit holds -limit: a run handles at most this many files, oldest
+// first, 0 for no limit. limitLeft is what the directories organized so
+// far in the run have left of it, and limitDeferred counts the files held
+// back.
+var (
+	runLimit      int
+	limitLeft     int
+	limitDeferred int
+)
+
+// limitPlans returns the plans with the files that have something to do
+// cut down to what is left of -limit, keeping the least recently modified.
+// Plans that fail or do nothing are kept; they don't count.
+func limitPlans(plans []plannedFile) []plannedFile {
+	var counted []int
+	for i, p := range plans {
+		if _, ok := planOp(p); ok {
+			counted = append(counted, i)
+		}
+	}
+	if len(counted) <= limitLeft {
+		limitLeft -= len(counted)
+		return plans
+	}
+	sort.SliceStable(counted, func(a, b int) bool {
+		return plans[counted[a]].file.ModTime.Before(plans[counted[b]].file.ModTime)
+	})
+	drop := make(map[int]bool, len(counted)-limitLeft)
+	for _, i := range counted[limitLeft:] {
+		drop[i] = true
+	}
+	limitDeferred += len(drop)
+	limitLeft = 0
+	kept := plans[:0:0]
+	for i, p := range plans {
+		if !drop[i] {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// reportLimit says how many files -limit held back for later runs.
+func reportLimit() {
+	if limitDeferred > 0 {
+		fmt.Printf("⏸️ Reached -limit %d: %d more file(s) left for later runs\n", runLimit, limitDeferred)
+	}
+}
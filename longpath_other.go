@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// longPath returns p unchanged; only Windows limits path lengths.
+func longPath(p string) string { return p }
+
+// shortPath returns p unchanged; only Windows limits path lengths.
+func shortPath(p string) string { return p }
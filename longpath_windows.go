@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the longest path Windows APIs accept without the \\?\
+// prefix; directories are limited to MAX_PATH minus room for an 8.3 name.
+const maxShortPath = 248
+
+// longPath returns p in the \\?\ form Windows needs for paths longer than
+// MAX_PATH. The prefixed form disables the usual normalization, so the
+// path is made absolute and clean first. Short paths are returned as is.
+func longPath(p string) string {
+	if strings.HasPrefix(p, `\\?\`) {
+		return p
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil || len(abs) < maxShortPath {
+		return p
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:] // \\server\share\... becomes \\?\UNC\server\share\...
+	}
+	return `\\?\` + abs
+}
+
+// shortPath strips the \\?\ prefix added by longPath, for display and for
+// joining with relative paths.
+func shortPath(p string) string {
+	if rest, ok := strings.CutPrefix(p, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(p, `\\?\`)
+}
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,36 +25,102 @@ type File struct {
 	IsDir     bool      // true if it's a directory
 	Category  string    // e.g., "Docs", "Images"
 	Extension string    // e.g., ".pdf"
+	MIME      string    // sniffed content type, filled in on demand
+	Rule      *Rule     // rule that set Category, nil for extension matches
+
+	root    string // directory being organized; destinations are relative to it
+	symlink bool   // Path is a symbolic link
+
+	contentExt     string // extension the content suggests, see ContentExt
+	contentProgram string // program category of the content, see ProgramCategory
+	contentSniffed bool   // whether contentExt and contentProgram have been determined
+
+	unit       bool // a directory organized as a whole, see ScanOptions.Folders
+	quarantine bool // move to quarantineFolder instead of carrying out the action
+	unmatched  bool // no rule or category matched, so it is in Other
+
+	linkID [2]uint64  // device and inode if the file has other hard links
+	linked bool       // whether linkID is set
+	link   *linkGroup // shared with the file's other links in this run
+
+	plan *journalOp // the journaled plan a resumed run carries out, see runResume
+}
+
+// baseDir returns the directory the file's destination is relative to:
+// -dest if given, otherwise the directory being organized.
+func (f File) baseDir() string {
+	if destRoot != "" {
+		return destRoot
+	}
+	if f.root != "" {
+		return f.root
+	}
+	return filepath.Dir(f.Path)
 }
 
-// Categories maps file types to their valid extensions.
+// Categories maps file types to their valid extensions. It is replaced by the
+// categories from the config file when one is present.
 var Categories = map[string][]string{
-	"Images": {".jpg", ".jpeg", ".png", ".gif"},
-	"Docs":   {".pdf", ".docx", ".txt", ".md"},
-	"Videos": {".mp4", ".mov", ".avi", ".mkv"},
-	"Audio":  {".mp3", ".wav", ".ogg"},
+	"Images":   {".jpg", ".jpeg", ".png", ".gif"},
+	"Docs":     {".pdf", ".docx", ".txt", ".md"},
+	"Videos":   {".mp4", ".mov", ".avi", ".mkv"},
+	"Audio":    {".mp3", ".wav", ".ogg"},
+	"Archives": {".zip", ".tar", ".gz", ".7z", ".rar"},
 	// Add more categories as needed.
 }
 
-// Categorize assigns a category to the File based on its extension.
+// Categorize assigns a category to the File, using the first matching rule
+// and falling back to its extension. Files without an extension are
+// categorized by the extension their content suggests, and extensionless
+// programs go to Executables or Scripts.
 func (f *File) Categorize() {
 	if f.IsDir {
 		f.Category = "Folder"
 		return
 	}
-	ext := f.Extension
-	for category, exts := range Categories {
-		for _, e := range exts {
-			if ext == e {
-				f.Category = category
-				return
-			}
+	f.Rule = nil
+	f.unmatched = false
+	if rule := matchRule(f); rule != nil {
+		f.Rule = rule
+		f.Category = canonicalCategory(rule.Category)
+		return
+	}
+	if category := categoryForExt(f.Extension); category != "" {
+		f.Category = category
+		return
+	}
+	if f.Extension == "" {
+		// Scripts are text, so check for programs before the content type.
+		if category := f.ProgramCategory(); category != "" {
+			f.Category = canonicalCategory(category)
+			return
+		}
+		if category := categoryForExt(f.ContentExt()); category != "" {
+			f.Category = category
+			return
 		}
 	}
 	f.Category = "Other" // Default category if no match is found.
+	f.unmatched = true
+}
+
+// categoryForExt returns the category claiming ext, or "" if none does.
+// Categories are checked in categoryOrder so an extension listed under
+// several categories always resolves the same way.
+func categoryForExt(ext string) string {
+	if ext == "" {
+		return ""
+	}
+	for _, name := range categoryOrder(Categories) {
+		if containsExt(Categories[name], ext) {
+			return name
+		}
+	}
+	return ""
 }
 
-// isFileValid checks if the File has a valid name and positive size.
+// isFileValid checks if the File has a valid name and size. Empty files
+// are valid; ScanOptions.EmptyFiles decides what happens to them.
 func isFileValid(file File) error {
 	if file.IsDir {
 		return nil // Directories don't need size/name validation here
@@ -58,105 +128,1046 @@ func isFileValid(file File) error {
 	if strings.TrimSpace(file.Name) == "" {
 		return errors.New("filename cannot be empty")
 	}
-	if file.Size <= 0 {
-		return errors.New("file size must be positive")
+	if file.Size < 0 {
+		return errors.New("file size cannot be negative")
 	}
 	return nil
 }
 
-// scanDir scans the directory at dirPath and returns a slice of File structs.
-func scanDir(dirPath string) ([]File, error) {
-	entries, err := os.ReadDir(dirPath)
+// Policies for empty files, see -empty-files.
+const (
+	EmptySkip       = "skip"       // leave empty files alone (default)
+	EmptyOrganize   = "organize"   // organize them like any other file
+	EmptyQuarantine = "quarantine" // move them to quarantineFolder for review
+)
+
+// quarantineFolder is where files needing review are moved, relative to
+// the organized directory.
+const quarantineFolder = "Quarantine"
+
+// unsortedFolder is where -quarantine moves files no rule or category
+// matched, for "organizer review", relative to the organized directory.
+const unsortedFolder = "_Unsorted"
+
+// quarantineUnmatched holds -quarantine.
+var quarantineUnmatched bool
+
+// Exclude holds the exclude patterns from the config; matching entries are
+// skipped by scanDir before categorization.
+var Exclude *IgnoreList
+
+// Symlink policies for -symlinks.
+const (
+	SymlinksSkip   = "skip"   // leave symbolic links alone (default)
+	SymlinksFollow = "follow" // treat links as their targets, descending into linked directories
+	SymlinksMove   = "move"   // organize links by their own name, keeping their targets valid
+)
+
+// ScanOptions controls which entries scanDir returns.
+type ScanOptions struct {
+	Recursive bool   // descend into subdirectories
+	MaxDepth  int    // with Recursive, how many levels to descend; 0 means no limit
+	Symlinks  string // one of the Symlinks* policies; "" means skip
+
+	// EmptyFiles is the policy for empty files, one of the Empty*
+	// constants; "" means skip.
+	EmptyFiles string
+
+	// Folders moves the directories directly inside -dir intact, into the
+	// category of their dominant content, instead of leaving them alone.
+	Folders bool
+
+	// OneFileSystem keeps recursive scans on the file system -dir is on,
+	// so mounted drives and network shares below it are not descended.
+	OneFileSystem bool
+
+	// QuietPeriod skips files modified more recently than this, as they
+	// may still be downloading; 0 disables the check.
+	QuietPeriod time.Duration
+
+	// Exclude holds -exclude patterns, applied on top of the config's.
+	Exclude []string
+
+	// MinSize and MaxSize limit the run to files within the size range;
+	// 0 means no limit.
+	MinSize, MaxSize ByteSize
+
+	// OlderThan and NewerThan limit the run to files last modified within
+	// the age range; 0 means no limit.
+	OlderThan, NewerThan Age
+
+	// Workers is how many directories a recursive scan reads at once;
+	// values below 1 mean 1. Parallel reads hide the latency of network
+	// file systems.
+	Workers int
+
+	// Ordered makes runs reproducible: the scan reads one directory at a
+	// time and organize processes files one by one, sorted by path,
+	// without timings in the output. Files start moving only once the whole
+	// scan is done.
+	Ordered bool
+
+	// Cache reuses what earlier runs learned from the content of files
+	// that have not changed since; see scanCache.
+	Cache bool
+
+	// Progress is how often a scan that is still running reports how far
+	// it got; 0 disables the reports.
+	Progress time.Duration
+
+	// Include, when set, limits the run to files matching one of these
+	// globs. Globs are matched case-insensitively against the file name, or
+	// against the path relative to the directory if they contain a slash.
+	Include []string
+}
+
+// included reports whether the file at the slash-separated path rel passes
+// the run's include globs.
+func (opts ScanOptions) included(rel string) bool {
+	if len(opts.Include) == 0 {
+		return true
+	}
+	rel = strings.ToLower(rel)
+	base := path.Base(rel)
+	for _, glob := range opts.Include {
+		name := base
+		if strings.Contains(glob, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(strings.ToLower(strings.TrimPrefix(glob, "/")), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filtered reports whether the file falls outside the run's filters.
+func (opts ScanOptions) filtered(f File, now time.Time) bool {
+	age := now.Sub(f.ModTime)
+	if opts.OlderThan > 0 && age < time.Duration(opts.OlderThan) {
+		return true
+	}
+	if opts.NewerThan > 0 && age > time.Duration(opts.NewerThan) {
+		return true
+	}
+	if opts.MinSize > 0 && f.Size < int64(opts.MinSize) {
+		return true
+	}
+	if opts.MaxSize > 0 && f.Size > int64(opts.MaxSize) {
+		return true
+	}
+	return false
+}
+
+// scanner holds the state of one scanDir call.
+type scanner struct {
+	root    string
+	opts    ScanOptions
+	exclude *IgnoreList     // config and -exclude patterns
+	skip    map[string]bool // top-level folders the organizer moves files into
+	real    string          // root with symlinks resolved
+	dev     uint64          // device of the root, for OneFileSystem
+	devOK   bool            // whether dev could be determined
+	visited map[string]bool // resolved directories already scanned, to stop link loops
+	cache   *scanCache      // nil unless ScanOptions.Cache is set
+	report  *SkipReport     // collects what the scan leaves alone
+	workers chan struct{}   // bounds the goroutines scanning subdirectories
+	wg      sync.WaitGroup  // tracks those goroutines
+	out     chan File       // where found files are sent
+
+	// entries and dirs count what has been read so far, for progress reports.
+	entries, dirs atomic.Int64
+
+	mu sync.Mutex // guards visited
+}
+
+// scanDir scans the directory at dirPath and sends each categorized File to
+// the returned channel as soon as it is found, closing the channel when the
+// scan is done. With opts.Recursive, files in subdirectories are sent too,
+// except in the folders the organizer itself moves files into. Only a
+// failure to read dirPath itself is returned; entries that can't be read
+// later are skipped and recorded in report.
+func scanDir(dirPath string, opts ScanOptions, report *SkipReport) (<-chan File, error) {
+	exclude, err := excludeFor(opts.Exclude, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &scanner{root: dirPath, opts: opts, exclude: Exclude.merge(exclude), visited: map[string]bool{}, report: report}
+	// The calling goroutine counts as one worker.
+	workers := max(opts.Workers, 1)
+	if opts.Ordered {
+		workers = 1
+	}
+	s.workers = make(chan struct{}, workers-1)
+	if real, err := resolvePath(dirPath); err == nil {
+		s.real = real
+		s.visited[real] = true
+	}
+	// Category folders are among the directory's own unless -dest puts
+	// them elsewhere; a -dest inside the directory is never scanned.
+	inPlace := destRoot == ""
+	if real, err := resolvePath(destRoot); !inPlace && err == nil {
+		inPlace = real == s.real
+		s.visited[real] = true
+	}
+	if (opts.Recursive || opts.Folders) && inPlace {
+		s.skip = outputFolders()
+	}
+	if info, err := os.Stat(longPath(dirPath)); err == nil {
+		s.dev, s.devOK = deviceID(info)
+	}
+	entries, err := os.ReadDir(longPath(dirPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read directory: %v", err)
 	}
+	if opts.Cache {
+		s.cache = loadScanCache(dirPath)
+	}
+
+	// A small buffer keeps the scanner ahead of the movers while memory
+	// stays flat however many files there are.
+	s.out = make(chan File, 256)
+	go func() {
+		defer close(s.out)
+		done := make(chan struct{})
+		reported := make(chan struct{})
+		go func() {
+			s.reportProgress(done)
+			close(reported)
+		}()
+		s.scanEntries("", 0, entries)
+		s.wg.Wait()
+		close(done)
+		<-reported
+		if err := s.cache.save(); err != nil {
+			fmt.Printf("⚠️ Failed to save the scan cache: %v\n", err)
+		}
+	}()
+	return s.out, nil
+}
+
+// scan scans root/rel, which is depth levels below the root.
+func (s *scanner) scan(rel string, depth int) error {
+	entries, err := os.ReadDir(longPath(filepath.Join(s.root, rel)))
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == folderMarkerName {
+			return nil // Organized by an earlier run.
+		}
+	}
+	s.scanEntries(rel, depth, entries)
+	return nil
+}
+
+// scanEntries sends the files among the entries of root/rel to s.out and
+// scans the subdirectories, in parallel when a worker is free.
+func (s *scanner) scanEntries(rel string, depth int, entries []os.DirEntry) {
+	s.dirs.Add(1)
+	s.entries.Add(int64(len(entries)))
+	siblings := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		siblings[entry.Name()] = true
+	}
+	now := time.Now()
 
-	var files []File
 	for _, entry := range entries {
-		info, err := entry.Info()
+		if entry.Name() == localConfigName || entry.Name() == ignoreFileName || entry.Name() == folderMarkerName || entry.Name() == runLockName {
+			continue // The directory's own overrides, and our lock, stay in place.
+		}
+		name := path.Join(rel, entry.Name())
+		fullPath := filepath.Join(s.root, filepath.FromSlash(name))
+		symlink := entry.Type()&os.ModeSymlink != 0
+		if symlink && (s.opts.Symlinks == "" || s.opts.Symlinks == SymlinksSkip) {
+			continue
+		}
+
+		var info os.FileInfo
+		var err error
+		if symlink {
+			// Links are classified by their target: linked directories are
+			// never moved, and with "follow" linked files are categorized
+			// by the target's size and content.
+			info, err = os.Stat(longPath(fullPath))
+			if err == nil && s.opts.Symlinks == SymlinksMove && !info.IsDir() {
+				info, err = entry.Info()
+			}
+		} else {
+			info, err = entry.Info()
+		}
 		if err != nil {
-			// For example: permission denied.
-			fmt.Printf("⚠️ Skipping %s: %v\n", entry.Name(), err)
+			// For example: permission denied or a dangling link.
+			s.report.add(s.root, name, SkipUnreadable, err)
+			continue
+		}
+		if s.exclude.Excluded(name, info.IsDir()) {
+			continue
+		}
+		if kind := specialKind(info.Mode()); kind != "" {
+			// Moving a FIFO or device node would disturb whatever uses it.
+			s.report.add(s.root, name, SkipSpecial, kind+", never organized")
+			continue
+		}
+
+		if info.IsDir() && depth == 0 && s.opts.Folders {
+			if !symlink && !s.skip[entry.Name()] && !isMarkedFolder(fullPath) {
+				s.sendFolder(name, fullPath, info, now)
+			}
+			continue
+		}
+		if info.IsDir() && s.descend(entry.Name(), fullPath, info, depth, symlink) {
+			if s.acquire() {
+				s.wg.Add(1)
+				go func(name string) {
+					defer s.wg.Done()
+					defer s.release()
+					s.scanSubdir(name, depth+1)
+				}(name)
+			} else {
+				s.scanSubdir(name, depth+1)
+			}
 			continue
 		}
 
-		file := File{
-			Name:      entry.Name(),
-			Path:      filepath.Join(dirPath, entry.Name()),
-			Size:      info.Size(),
-			ModTime:   info.ModTime(),
-			IsDir:     entry.IsDir(),
-			Extension: strings.ToLower(filepath.Ext(entry.Name())),
+		if !s.opts.included(name) {
+			continue
+		}
+		file := newFile(fullPath, info)
+		file.root = s.root
+		file.symlink = symlink
+		if s.opts.filtered(file, now) {
+			continue
+		}
+		if file.Size == 0 {
+			switch s.opts.EmptyFiles {
+			case EmptyOrganize:
+			case EmptyQuarantine:
+				file.quarantine = true
+			default:
+				continue
+			}
+		}
+		if reason := inProgress(file, siblings, s.opts.QuietPeriod, now); reason != "" {
+			s.report.add(s.root, name, SkipInProgress, reason)
+			continue
 		}
 
 		// Categorize the file based on its extension.
+		s.cache.fill(name, &file)
 		file.Categorize()
-		files = append(files, file)
+		s.cache.store(name, file)
+		s.out <- file
 	}
-	return files, nil
 }
 
-// processFile processes a single file: validates it and, if in dry-run mode, prints the intended action.
-func processFile(file File, dryRun bool) error {
-	start := time.Now()
-	defer func() {
-		fmt.Printf("Processed %q in %v\n", file.Name, time.Since(start))
-	}()
-	if file.IsDir {
-		return nil // Skip directories
+// sendFolder categorizes the directory at fullPath as a unit and sends it
+// to s.out if it passes the run's filters.
+func (s *scanner) sendFolder(name, fullPath string, info os.FileInfo, now time.Time) {
+	if !s.opts.included(name) {
+		return
+	}
+	folder := newFile(fullPath, info)
+	folder.root = s.root
+	folder.unit = true
+	if err := folder.categorizeFolder(name, s.exclude, s.cache, s.opts.Workers); err != nil {
+		s.report.add(s.root, name, SkipUnreadable, err)
+		return
 	}
+	if folder.Category == "" || s.opts.filtered(folder, now) {
+		return // Empty, or outside the size and age filters.
+	}
+	s.out <- folder
+}
 
-	if err := isFileValid(file); err != nil {
-		return err
+// scanSubdir scans a subdirectory, reporting rather than returning errors
+// so one unreadable folder doesn't stop the scan.
+func (s *scanner) scanSubdir(rel string, depth int) {
+	if err := s.scan(rel, depth); err != nil {
+		s.report.add(s.root, rel, SkipUnreadable, err)
+	}
+}
+
+// acquire reserves a worker for scanning a subdirectory in parallel. It
+// never blocks: when every worker is busy the caller scans inline.
+func (s *scanner) acquire() bool {
+	select {
+	case s.workers <- struct{}{}:
+		return true
+	default:
+		return false
 	}
+}
 
-	if dryRun {
-		fmt.Printf("Would move %q to %s\n", file.Name, file.Category)
-	} else {
-		// TODO: Implement actual file moving logic (e.g., using os.Rename)
-		destDir := filepath.Join(filepath.Dir(file.Path), file.Category)
-		if err := os.MkdirAll(destDir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory: %v", err)
+// release returns a worker reserved by acquire.
+func (s *scanner) release() {
+	<-s.workers
+}
+
+// descend reports whether the directory name at fullPath, depth levels
+// below the root, should be scanned. Each resolved directory is scanned at
+// most once so links pointing back up the tree cannot loop.
+func (s *scanner) descend(name, fullPath string, info os.FileInfo, depth int, symlink bool) bool {
+	if !s.opts.Recursive || (s.opts.MaxDepth > 0 && depth >= s.opts.MaxDepth) {
+		return false
+	}
+	if depth == 0 && s.skip[name] {
+		return false // Already organized; rescanning it would loop.
+	}
+	if symlink && s.opts.Symlinks != SymlinksFollow {
+		return false
+	}
+	if s.opts.OneFileSystem && s.devOK {
+		if dev, ok := deviceID(info); ok && dev != s.dev {
+			return false // A mount point.
 		}
+	}
+	real, err := resolvePath(fullPath)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.visited[real] || isWithin(s.real, real) {
+		return false // a link to the root or one of its parents would loop
+	}
+	s.visited[real] = true
+	return true
+}
+
+// resolvePath returns the absolute path with all symlinks resolved.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// newFile builds an uncategorized File from the entry at path.
+func newFile(path string, info os.FileInfo) File {
+	f := File{
+		Name:      info.Name(),
+		Path:      path,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		IsDir:     info.IsDir(),
+		Extension: strings.ToLower(filepath.Ext(info.Name())),
+	}
+	f.linkID, f.linked = linkID(info)
+	return f
+}
+
+// plannedFile is a file with its destination decided, see planFile.
+type plannedFile struct {
+	file    File
+	rel     string // destination directory, relative to file.baseDir()
+	err     error  // why the file can't be organized
+	planned bool   // rel and err are set; otherwise processFile plans it
+}
+
+// planFile validates the file and works out its destination directory,
+// relative to its base directory. An empty rel means there is nothing to
+// do, as for directories not moved as units.
+func planFile(file *File) (string, error) {
+	if file.IsDir && !file.unit {
+		return "", nil // Skip directories
+	}
+	if action := fileAction(*file); file.unit && action != ActionMove && action != ActionSkip {
+		return "", fmt.Errorf("the %s action is not supported for folders", action)
+	}
 
-		destPath := filepath.Join(destDir, file.Name)
-		if err := os.Rename(file.Path, destPath); err != nil {
-			return fmt.Errorf("failed to move file: %v", err)
+	if err := isFileValid(*file); err != nil {
+		return "", err
+	}
+
+	return destinationFor(file)
+}
+
+// processFile processes a single file: plans it unless that was done
+// already and carries out its action or, in dry-run mode, prints the
+// intended action.
+func processFile(p plannedFile, dryRun bool) error {
+	start := time.Now()
+	defer func() {
+		if printTimings {
+			fmt.Printf("Processed %q in %v\n", p.file.Name, time.Since(start))
 		}
+	}()
+	if !p.planned {
+		p.rel, p.err = planFile(&p.file)
 	}
-	return nil
+	if p.err != nil || p.rel == "" {
+		return p.err
+	}
+	if interactive && !dryRun && !confirmFile(&p) {
+		return nil
+	}
+	if err := validate(p.file, p.rel); err != nil {
+		return err
+	}
+	return executeAction(p.file, p.rel, dryRun)
+}
+
+// destinationFor returns the file's destination directory, relative to the
+// organized directory.
+func destinationFor(file *File) (string, error) {
+	if file.quarantine {
+		file.Rule = nil // Always moved, whatever a rule says.
+		return quarantineFolder, nil
+	}
+	if file.unmatched && quarantineUnmatched {
+		return unsortedFolder, nil
+	}
+
+	// Reuse an existing folder named after an alias of the category.
+	file.Category = categoryFolder(file.baseDir(), file.Category)
+	return renderDestination(*file)
 }
 
 func main() {
+	// Dispatch subcommands before parsing the organize flags.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:]))
+		case "explain":
+			os.Exit(runExplain(os.Args[2:]))
+		case "rules":
+			os.Exit(runRulesCommand(os.Args[2:]))
+		case "scan":
+			os.Exit(runScan(os.Args[2:]))
+		case "undo":
+			os.Exit(runUndo(os.Args[2:]))
+		case "history":
+			os.Exit(runHistory(os.Args[2:]))
+		case "resume":
+			os.Exit(runResume(os.Args[2:]))
+		case "review":
+			os.Exit(runReview(os.Args[2:]))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:]))
+		case "reorganize":
+			os.Exit(runReorganize(os.Args[2:]))
+		case "flatten":
+			os.Exit(runFlatten(os.Args[2:]))
+		case "dedup":
+			os.Exit(runDedup(os.Args[2:]))
+		case "apply":
+			os.Exit(runApply(os.Args[2:]))
+		case "plan":
+			// The organize flags plus -o; the run is planned, not carried out.
+			flag.StringVar(&planOutput, "o", "plan.json", "Where \"plan\" writes the plan, for \"apply\"")
+			planning = true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "stage":
+			// Planned like "plan", into the staged plan.
+			if planOutput = stagedPlanPath(); planOutput == "" {
+				log.Fatal("no home directory to keep a staged plan in")
+			}
+			planning, staging = true, true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "status":
+			os.Exit(runStatus(os.Args[2:]))
+		case "commit":
+			os.Exit(runCommit(os.Args[2:]))
+		}
+	}
+
 	// Define command-line flags.
 	version := flag.Bool("version", false, "Show version")
-	dirPath := flag.String("dir", ".", "Directory to organize")
+	var dirs, excludes, includes listFlag
+	flag.Var(&dirs, "dir", "Directory to organize; repeat or separate with commas for several (default: the current directory)")
 	dryRun := flag.Bool("dry-run", false, "Preview changes without moving files")
+	dest := flag.String("dest", "", "Root to create the category folders under, e.g. ~/Documents, sftp://user@nas/organized, s3://bucket/prefix or davs://host/path (default: inside each directory organized)")
+	configPath := flag.String("config", "", "Path to a YAML config file (default: $XDG_CONFIG_HOME/go-file-organizer/config.yaml, then ~/.config/go-file-organizer/config.yaml)")
+	profile := flag.String("profile", "", "Named profile from the config file to use")
+	preset := flag.String("preset", "", "Comma-separated built-in presets to use under the config ("+strings.Join(presetNames(), ", ")+")")
+	watch := flag.Bool("watch", false, "Keep running and organize the directory every -interval")
+	interval := flag.Duration("interval", time.Minute, "How often to rescan in -watch mode")
+	flag.Var(&excludes, "exclude", "Gitignore-style pattern or path to leave untouched; repeat for several")
+	flag.Var(&includes, "include", "Only organize files matching this glob, e.g. '*.pdf'; repeat for several")
+	var minSize, maxSize ByteSize
+	flag.Var(&minSize, "min-size", "Only organize files of at least this size, e.g. 10MB")
+	flag.Var(&maxSize, "max-size", "Only organize files of at most this size, e.g. 2GB")
+	var olderThan, newerThan Age
+	flag.Var(&olderThan, "older-than", "Only organize files last modified longer ago than this, e.g. 30d")
+	flag.Var(&newerThan, "newer-than", "Only organize files modified within this long, e.g. 2h")
+	recursive := flag.Bool("recursive", false, "Also organize files in subdirectories")
+	maxDepth := flag.Int("max-depth", 0, "With -recursive, how many levels of subdirectories to descend (0 = no limit)")
+	scanWorkers := flag.Int("scan-workers", defaultScanWorkers, "With -recursive, how many directories to read in parallel")
+	scanCache := flag.Bool("scan-cache", true, "Remember file content detection between runs so unchanged files are not read again")
+	skipReport := flag.String("skip-report", "", "Also write the entries a run skips, with the reasons, to this JSON file")
+	progress := flag.Duration("progress", 2*time.Second, "How often a long scan reports how many entries it has read, and large copies how far they are when stderr isn't a terminal (0 = never)")
+	ordered := flag.Bool("ordered", false, "Process files one at a time in sorted order, for reproducible output")
+	emptyFiles := flag.String("empty-files", EmptySkip, "What to do with empty files: skip, organize or quarantine (move to "+quarantineFolder+"/)")
+	folders := flag.Bool("folders", false, "Move folders inside -dir intact, into the category of their dominant content")
+	oneFileSystem := flag.Bool("one-file-system", false, "With -recursive, don't descend into directories on other file systems (mounts, network shares)")
+	mode := flag.String("mode", ModeMove, "move: carry out each file's action; copy, hardlink or reflink: copy, hard link or clone files into the category folders and leave the originals untouched")
+	conflict := flag.String("on-conflict", ConflictRename, "What to do when the destination exists: skip, overwrite, rename, newer-wins, ask or hash-suffix")
+	suffix := flag.String("conflict-suffix", SuffixCounter, "How -on-conflict rename picks a free name: counter (\"name (1).ext\") or timestamp (the file's mtime)")
+	normalize := flag.String("normalize-names", "", "Convert moved file and folder names to this Unicode normalization form: nfc or nfd (default: keep them)")
+	sanitize := flag.Bool("sanitize-names", false, "Make moved file and folder names safe for Windows, exFAT and SMB shares: replace <>:\"|?*, drop trailing dots and spaces, avoid names like CON")
+	symlinks := flag.String("symlinks", SymlinksSkip, "How to treat symbolic links: skip, follow or move")
+	interactiveFlag := flag.Bool("interactive", false, "Confirm each file's action before it is carried out: [y]es, [n]o, [a]ll the rest, [q]uit, or [e]dit the destination")
+	limit := flag.Int("limit", 0, "Handle at most this many files, the least recently modified first (0 for no limit)")
+	quarantine := flag.Bool("quarantine", false, "Move files no rule or category matches to "+unsortedFolder+"/ instead of Other, to sort with \"organizer review\"")
+	prune := flag.Bool("prune-empty", false, "After the run, remove the folders it left empty (never the organized directory itself)")
+	trash := flag.Bool("trash", true, "Move files removed by delete rules to the trash (XDG Trash, macOS Trash, Recycle Bin) instead of deleting them for good")
+	trashDups := flag.Bool("trash-duplicates", false, "Move a file to the trash instead of renaming it when an identical file is already at its destination")
+	atomic := flag.Bool("atomic", false, "Treat the run as one batch: if any file fails, undo everything already done")
+	flag.IntVar(&shardLimit, "shard-limit", defaultShardLimit, "Split a folder of a category with a shard scheme into subfolders once it holds more than this many entries")
+	flag.Var(&extractLimit, "extract-limit", "Refuse to extract archives that unpack to more than this, e.g. 10GB")
+	var bwLimit byteRate
+	flag.Var(&bwLimit, "bwlimit", "Read and upload at most this many bytes a second, e.g. 20MB/s, so a background run doesn't starve other programs (0 = no limit)")
+	iopsLimit := flag.Int("iops", 0, "Make at most this many I/O operations a second, each a rename or a read of up to 256KB (0 = no limit)")
+	quietPeriod := flag.Duration("quiet-period", defaultQuietPeriod, "Skip files modified more recently than this, as they may still be downloading (0 = off)")
 	flag.Parse()
 
 	if *version {
 		fmt.Println("v1.0.0")
 		os.Exit(0)
 	}
-	// Scan the directory for files.
-	files, err := scanDir(*dirPath)
+
+	// Flags not given on the command line fall back to ORGANIZER_* variables,
+	// then to the config file's options.
+	if err := applyEnv(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	cfg, err := loadGlobalConfig(*configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *profile != "" {
+		if cfg, err = cfg.selectProfile(*profile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := applyOptions(flag.CommandLine, cfg.Options); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Profile != "" {
+		fmt.Printf("📄 Using config %s (profile %s)\n", cfg.Source, cfg.Profile)
+	} else if cfg.Source != "" {
+		fmt.Printf("📄 Using config %s\n", cfg.Source)
+	} else {
+		fmt.Println("📄 No config file found, using built-in categories")
+	}
+
+	// Load categories from the config files, keeping the built-in map if
+	// there are none. Every directory's overrides are checked up front so a
+	// broken one stops the run before anything moves.
+	dirPaths := dirList(dirs)
+	for _, dir := range dirPaths {
+		if err := prepareConfig(cfg, *preset, dir); err != nil {
+			log.Fatal(err)
+		}
+		if _, err := excludeFor(excludes, dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *maxDepth < 0 {
+		log.Fatal("-max-depth cannot be negative")
+	}
+	if *limit < 0 {
+		log.Fatal("-limit cannot be negative")
+	}
+	runLimit = *limit
+	transferEvery = *progress
+	if *iopsLimit < 0 {
+		log.Fatal("-iops cannot be negative")
+	}
+	bandwidth.setRate(float64(bwLimit))
+	iops.setRate(float64(*iopsLimit))
+	if strings.Contains(*dest, "://") {
+		if err := setRemoteDest(*dest); err != nil {
+			log.Fatalf("invalid -dest %q: %v", *dest, err)
+		}
+	} else if *dest != "" {
+		abs, err := filepath.Abs(expandHome(*dest))
+		if err != nil {
+			log.Fatalf("invalid -dest %q: %v", *dest, err)
+		}
+		if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+			log.Fatalf("-dest %s is not a directory", *dest)
+		}
+		destRoot = abs
+	}
+	switch *symlinks {
+	case SymlinksSkip, SymlinksFollow, SymlinksMove:
+	default:
+		log.Fatalf("invalid -symlinks %q (valid: skip, follow, move)", *symlinks)
+	}
+	for _, glob := range includes {
+		if _, err := path.Match(glob, ""); err != nil {
+			log.Fatalf("invalid -include %q: %v", glob, err)
+		}
+	}
+	if maxSize > 0 && minSize > maxSize {
+		log.Fatalf("-min-size %v is larger than -max-size %v", minSize, maxSize)
+	}
+	if newerThan > 0 && olderThan > newerThan {
+		log.Fatalf("-older-than %v and -newer-than %v leave no files", olderThan, newerThan)
+	}
+	if *ordered {
+		printTimings = false
+	}
+	if interactive = *interactiveFlag; interactive {
+		if *watch {
+			log.Fatal("-interactive cannot be combined with -watch")
+		}
+		printTimings = false
+	}
+	if planning {
+		if *watch {
+			log.Fatal("plan cannot be combined with -watch")
+		}
+		if *atomic {
+			log.Fatal("plan cannot be combined with -atomic")
+		}
+		*dryRun = true
+		printTimings = false
+	}
+	skipReportPath = *skipReport
+	atomicRun = *atomic
+	switch *mode {
+	case ModeMove, ModeCopy, ModeHardlink, ModeReflink:
+		runMode = *mode
+	default:
+		log.Fatalf("invalid -mode %q (valid: move, copy, hardlink, reflink)", *mode)
+	}
+	if runMode != ModeMove && *folders {
+		log.Fatalf("-folders moves folders and cannot be combined with -mode %s", runMode)
+	}
+	switch *conflict {
+	case ConflictSkip, ConflictOverwrite, ConflictRename, ConflictNewerWins, ConflictAsk, ConflictHash:
+		onConflict = *conflict
+	default:
+		log.Fatalf("invalid -on-conflict %q (valid: skip, overwrite, rename, newer-wins, ask, hash-suffix)", *conflict)
+	}
+	if remoteDest != nil && onConflict == ConflictAsk {
+		log.Fatal("-on-conflict ask cannot be used with a remote -dest")
+	}
+	if remoteDest != nil && atomicRun && (onConflict == ConflictOverwrite || onConflict == ConflictNewerWins) {
+		log.Fatalf("-on-conflict %s cannot be combined with -atomic and a remote -dest: replaced files can't be restored there", onConflict)
+	}
+	if remoteDest != nil && *folders {
+		log.Fatal("-folders cannot be used with a remote -dest")
+	}
+	switch *suffix {
+	case SuffixCounter, SuffixTimestamp:
+		conflictSuffix = *suffix
+	default:
+		log.Fatalf("invalid -conflict-suffix %q (valid: counter, timestamp)", *suffix)
+	}
+	switch *normalize {
+	case "", FormNFC, FormNFD:
+		normalizeNames = *normalize
+	default:
+		log.Fatalf("invalid -normalize-names %q (valid: nfc, nfd)", *normalize)
+	}
+	sanitizeNames = *sanitize
+	useTrash, trashDuplicates = *trash, *trashDups
+	pruneEmpty = *prune
+	quarantineUnmatched = *quarantine
+	switch *emptyFiles {
+	case EmptySkip, EmptyOrganize, EmptyQuarantine:
+	default:
+		log.Fatalf("invalid -empty-files %q (valid: skip, organize, quarantine)", *emptyFiles)
+	}
+	if *folders && *recursive {
+		log.Fatal("-folders and -recursive cannot be combined")
+	}
+	opts := ScanOptions{
+		Recursive:     *recursive,
+		Folders:       *folders,
+		EmptyFiles:    *emptyFiles,
+		MaxDepth:      *maxDepth,
+		Symlinks:      *symlinks,
+		OneFileSystem: *oneFileSystem,
+		QuietPeriod:   *quietPeriod,
+		Exclude:       excludes,
+		MinSize:       minSize,
+		MaxSize:       maxSize,
+		OlderThan:     olderThan,
+		NewerThan:     newerThan,
+		Include:       includes,
+		Cache:         *scanCache,
+		Ordered:       *ordered,
+		Workers:       *scanWorkers,
+		Progress:      *progress,
+	}
+
+	if *watch {
+		reload := func() (*Config, error) {
+			cfg, err := loadGlobalConfig(*configPath)
+			if err == nil && *profile != "" {
+				cfg, err = cfg.selectProfile(*profile)
+			}
+			for _, dir := range dirPaths {
+				if err == nil {
+					err = prepareConfig(cfg, *preset, dir)
+				}
+			}
+			return cfg, err
+		}
+		runWatch(dirPaths, *preset, opts, *dryRun, *interval, cfg, reload)
+		return
+	}
+
+	organizeDirs(cfg, *preset, dirPaths, opts, *dryRun)
+	if planning {
+		if err := pendingPlan.write(planOutput, dirPaths); err != nil {
+			log.Fatalf("failed to write the plan: %v", err)
+		}
+		if staging {
+			fmt.Printf("✅ Staged %d step(s); review them with status and carry them out with commit\n", len(pendingPlan.Steps))
+		} else {
+			fmt.Printf("✅ Wrote a plan of %d step(s) to %s; carry it out with apply %s\n", len(pendingPlan.Steps), planOutput, planOutput)
+		}
+		return
+	}
+	fmt.Println("Processing complete!")
+}
+
+// listFlag is the value of a repeatable flag such as -dir. Each use may
+// also hold a comma-separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// dirList returns the directories to organize, without duplicates,
+// defaulting to the current directory.
+func dirList(dirs []string) []string {
+	var paths []string
+	for _, dir := range dirs {
+		dir = filepath.Clean(expandHome(dir))
+		if !slices.Contains(paths, dir) {
+			paths = append(paths, dir)
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	return paths
+}
+
+// organizeDirs organizes each directory in turn, first installing cfg
+// combined with that directory's own overrides. Everything skipped is
+// reported once all of them are done. With -atomic the directories form one
+// batch: the first failure stops the run and rolls all of them back.
+func organizeDirs(cfg *Config, presets string, dirs []string, opts ScanOptions, dryRun bool) {
+	report := &SkipReport{}
+	defer report.finish(len(dirs) > 1)
+	resetClaims()
+	limitLeft, limitDeferred = runLimit, 0
+	defer reportLimit()
+	if !dryRun {
+		release, err := lockDirs(dirs)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		defer release()
+		runJournal = newJournal(dirs, atomicRun)
+		defer func() {
+			runJournal.skipped(report.Skips)
+			runJournal.pruneEmptyDirs()
+			runJournal.finish()
+			runJournal = nil
+		}()
+	}
+	for _, dir := range dirs {
+		if runJournal.stopped() {
+			break
+		}
+		if len(dirs) > 1 {
+			fmt.Printf("📂 %s\n", dir)
+		}
+		err := prepareConfig(cfg, presets, dir)
+		if err == nil {
+			err = organize(dir, opts, dryRun, report)
+		}
+		if err != nil {
+			fmt.Printf("❌ Skipping %s: %v\n", dir, err)
+			runJournal.dirFailed(dir, err)
+		}
+	}
+}
 
+// defaultScanWorkers is how many directories a scan reads at once unless
+// -scan-workers says otherwise.
+const defaultScanWorkers = 8
+
+// processWorkers is how many files organize processes at once.
+const processWorkers = 16
+
+// printTimings reports how long each file took; -ordered turns it off so
+// the output is the same from run to run.
+var printTimings = true
+
+// sortedFiles collects every file from the scan and sends them on, sorted
+// by path.
+func sortedFiles(files <-chan File) <-chan File {
+	var all []File
+	for f := range files {
+		all = append(all, f)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Path < all[j].Path })
+	sorted := make(chan File)
+	go func() {
+		defer close(sorted)
+		for _, f := range all {
+			sorted <- f
+		}
+	}()
+	return sorted
+}
+
+// organize scans dirPath and processes its files concurrently, printing any
+// errors. It fails only if the directory cannot be scanned. Dry runs
+// process files as the scan finds them; journaled runs first plan every
+// file and journal the plan, so an interrupted run can be resumed, and
+// "organizer plan" only adds it to the plan file. With -limit every file
+// is planned first too, to find the oldest.
+func organize(dirPath string, opts ScanOptions, dryRun bool, report *SkipReport) error {
+	// Scan the directory for files.
+	opts = networkOptions(dirPath, opts)
+	files, err := scanDir(dirPath, opts, report)
+	if err != nil {
+		return err
+	}
+
+	workers := processWorkers
+	if opts.Ordered || interactive {
+		files = sortedFiles(files)
+		workers = 1
+	}
+	if runJournal == nil && !planning && runLimit == 0 {
+		plans := make(chan plannedFile)
+		go func() {
+			defer close(plans)
+			for f := range files {
+				plans <- plannedFile{file: f}
+			}
+		}()
+		processPlans(plans, workers, dryRun, report)
+		return nil
+	}
+	plans := planAll(files, workers)
+	if runLimit > 0 {
+		plans = limitPlans(plans)
+	}
+	if planning {
+		for _, p := range plans {
+			if p.err != nil {
+				fmt.Printf("❌ Error processing file: file %q: %v\n", p.file.Name, p.err)
+			}
+		}
+		pendingPlan.add(plans)
+		return nil
+	}
+	runJournal.planAll(plans)
+	processPlans(feedPlans(plans), workers, dryRun, report)
+	return nil
+}
+
+// planAll plans every file from the scan on workers goroutines and returns
+// the plans sorted by path.
+func planAll(files <-chan File, workers int) []plannedFile {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		plans []plannedFile
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				p := plannedFile{file: f, planned: true}
+				p.rel, p.err = planFile(&p.file)
+				mu.Lock()
+				plans = append(plans, p)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Slice(plans, func(i, j int) bool { return plans[i].file.Path < plans[j].file.Path })
+	return plans
+}
+
+// feedPlans sends the plans, in order, on a channel.
+func feedPlans(plans []plannedFile) <-chan plannedFile {
+	ch := make(chan plannedFile)
+	go func() {
+		defer close(ch)
+		for _, p := range plans {
+			ch <- p
+		}
+	}()
+	return ch
+}
+
+// processPlans processes the planned files on workers goroutines,
+// printing any errors.
+func processPlans(plans <-chan plannedFile, workers int, dryRun bool, report *SkipReport) {
 	// Create a WaitGroup and an error channel for concurrent processing.
 	var wg sync.WaitGroup
 	errorChan := make(chan error)
 
-	// Process files concurrently.
-	for _, file := range files {
+	// Files other processes have open are deferred to a later run rather
+	// than moved out from under them.
+	inUse := openFileChecker()
+
+	// Hard links to the same file are processed one at a time.
+	links := &linkGroups{}
+
+	// Process files concurrently as they arrive.
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(f File) {
+		go func() {
 			defer wg.Done()
-			if err := processFile(f, *dryRun); err != nil {
-				errorChan <- fmt.Errorf("file %q: %v", f.Name, err)
+			for p := range plans {
+				if runJournal.stopped() {
+					continue // Rolled back anyway; drain the rest.
+				}
+				f := p.file
+				if !f.IsDir && fileAction(f) != ActionSkip && inUse(f) {
+					report.addFile(f, SkipInUse, "open in another process, left for the next run")
+					continue
+				}
+				p.file.link = links.group(f)
+				err := processFile(p, dryRun)
+				if errors.Is(err, errFileLocked) {
+					// Taken since the check above.
+					report.addFile(f, SkipInUse, "locked by another process, left for the next run")
+					continue
+				}
+				var veto *vetoError
+				if errors.As(err, &veto) {
+					report.addFile(f, SkipVetoed, veto)
+					continue
+				}
+				runJournal.outcome(f, err)
+				if err != nil {
+					errorChan <- fmt.Errorf("file %q: %v", f.Name, err)
+				}
 			}
-		}(file)
+		}()
 	}
 
 	// Close the error channel after all goroutines complete.
@@ -169,6 +1180,7 @@ func main() {
 	for err := range errorChan {
 		fmt.Printf("❌ Error processing file: %v\n", err)
 	}
-
-	fmt.Println("Processing complete!")
+	closeArchives()
+	resetShards()
+	resetMeta()
 }
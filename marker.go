@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// folderMarkerName is the file the organizer leaves in the top-level
+// folders it moves files into. Scans skip any folder holding one, so a
+// second run, a recursive run or a changed config never reprocesses what
+// was already organized.
+const folderMarkerName = ".organized"
+
+const folderMarkerText = `This folder was created by go-file-organizer, which does not rescan it.
+Delete this file to have the folder organized again.
+`
+
+// markedFolders remembers the folders marked during this run.
+var markedFolders sync.Map
+
+// markOutputFolder leaves the marker in the top-level folder of the
+// destination rel below base. It is best effort: an unmarked folder is
+// still recognized while it is named after a configured category.
+func markOutputFolder(base, rel string) {
+	top, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	dir := filepath.Join(base, top)
+	if _, done := markedFolders.LoadOrStore(dir, true); done {
+		return
+	}
+	marker := filepath.Join(dir, folderMarkerName)
+	if _, err := os.Lstat(longPath(marker)); err == nil {
+		return
+	}
+	if os.WriteFile(longPath(marker), []byte(folderMarkerText), 0644) == nil {
+		runJournal.add(journalOp{Action: opMarker, Dest: marker})
+	}
+}
+
+// isMarkedFolder reports whether dir holds the organizer's marker.
+func isMarkedFolder(dir string) bool {
+	_, err := os.Lstat(longPath(filepath.Join(dir, folderMarkerName)))
+	return err == nil
+}
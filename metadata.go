@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+)
+
+// copyMetadata gives dst, a fresh copy of src described by info, the
+// original's metadata so organizing doesn't subtly alter files: owner and
+// group (when permitted, which usually means running as root), mode bits
+// including setuid, setgid and sticky, extended attributes where the
+// platform supports them, and access and modification times. Only
+// failures to set the mode and times are returned; the rest is best effort.
+func copyMetadata(src string, info os.FileInfo, dst string) error {
+	if uid, gid, ok := fileOwner(info); ok {
+		os.Lchown(longPath(dst), uid, gid) // Needs privileges unless unchanged.
+	}
+	// After chown, which clears setuid and setgid.
+	mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if err := os.Chmod(longPath(dst), mode); err != nil {
+		return err
+	}
+	copyXattrs(src, dst)
+	return os.Chtimes(longPath(dst), accessTime(info), info.ModTime())
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns when the file was last read.
+func accessTime(info os.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+}
+
+// copyXattrs copies the extended attributes of src to dst, skipping any
+// that can't be read or set, such as security labels without privileges.
+func copyXattrs(src, dst string) {
+	size, err := syscall.Listxattr(longPath(src), nil)
+	if err != nil || size == 0 {
+		return
+	}
+	list := make([]byte, size)
+	if size, err = syscall.Listxattr(longPath(src), list); err != nil {
+		return
+	}
+	for _, name := range bytes.Split(list[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		n, err := syscall.Getxattr(longPath(src), attr, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(longPath(src), attr, value); err != nil {
+			continue
+		}
+		syscall.Setxattr(longPath(dst), attr, value[:n], 0)
+	}
+}
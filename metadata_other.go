@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns when the file was last read. File info on this
+// platform doesn't say, so the modification time stands in for it.
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// copyXattrs would copy extended attributes; this platform doesn't have
+// them, or offers no access to them.
+func copyXattrs(src, dst string) {}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// networkQuietPeriod is the shortest quiet period used on network file
+// systems, where modification times come from the server's clock and a
+// file may still be arriving from another machine.
+const networkQuietPeriod = 30 * time.Second
+
+// staleRetries is how many times an operation failing with ESTALE is
+// retried, and networkStaleRetries how many once the source or destination
+// is known to be on a network file system. NFS clients return ESTALE when
+// the server replaced a file handle they had cached, and a fresh lookup
+// usually succeeds, though a busy server may take a few seconds.
+const (
+	staleRetries        = 3
+	networkStaleRetries = 6
+)
+
+// onNetwork is set once a directory of the run turns out to be on a
+// network file system.
+var onNetwork atomic.Bool
+
+// retryStale runs op, retrying it with a growing backoff while it fails
+// with ESTALE.
+func retryStale(op func() error) error {
+	retries := staleRetries
+	if onNetwork.Load() {
+		retries = networkStaleRetries
+	}
+	err := op()
+	for i := 0; i < retries && errors.Is(err, syscall.ESTALE); i++ {
+		time.Sleep(time.Duration(100<<i) * time.Millisecond)
+		err = op()
+	}
+	return err
+}
+
+// networkWarned records the directories warned about, so watch mode warns
+// once rather than on every pass.
+var networkWarned sync.Map
+
+// networkOptions adjusts the scan options for a directory on a network
+// file system and warns about what works differently there. Other
+// directories get opts back unchanged. The -dest root, when set, is
+// checked too, since everything organized goes there.
+func networkOptions(dir string, opts ScanOptions) ScanOptions {
+	if destRoot != "" {
+		networkDest(destRoot)
+	}
+	fsType, ok := networkFS(dir)
+	if !ok {
+		return opts
+	}
+	onNetwork.Store(true)
+	_, warned := networkWarned.LoadOrStore(dir, true)
+	if !warned {
+		fmt.Printf("⚠️ %s is on a network file system (%s): files other machines have open can't be detected, and stale handles are retried\n", dir, fsType)
+	}
+	if opts.QuietPeriod > 0 && opts.QuietPeriod < networkQuietPeriod {
+		if !warned {
+			fmt.Printf("⚠️ Using a quiet period of %v instead of %v for %s\n", networkQuietPeriod, opts.QuietPeriod, dir)
+		}
+		opts.QuietPeriod = networkQuietPeriod
+	}
+	return opts
+}
+
+// networkDest warns, once, when the destination root is on a network file
+// system. It may not exist yet, so the nearest folder that does is
+// checked.
+func networkDest(root string) {
+	dir := root
+	for {
+		if _, err := os.Stat(longPath(dir)); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+	fsType, ok := networkFS(dir)
+	if !ok {
+		return
+	}
+	onNetwork.Store(true)
+	if _, warned := networkWarned.LoadOrStore(root, true); !warned {
+		fmt.Printf("⚠️ The destination %s is on a network file system (%s): moves into it are copied and then removed, and stale handles are retried\n", root, fsType)
+	}
+}
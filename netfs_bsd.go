@@ -0,0 +1,30 @@
+//go:build darwin || dragonfly || freebsd
+
+package main
+
+import "syscall"
+
+// networkTypes are the names of network file systems as statfs reports them.
+var networkTypes = map[string]bool{
+	"nfs":    true,
+	"smbfs":  true,
+	"afpfs":  true,
+	"webdav": true,
+	"cifs":   true,
+}
+
+// networkFS reports whether path is on a network file system, and which.
+func networkFS(path string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	var name []byte
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), networkTypes[string(name)]
+}
@@ -0,0 +1,25 @@
+package main
+
+import "syscall"
+
+// networkMagic maps the statfs f_type of network file systems to a name.
+var networkMagic = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+	0x00c36400: "ceph",
+	0x5346414f: "afs",
+	0x73757245: "coda",
+}
+
+// networkFS reports whether path is on a network file system, and which.
+func networkFS(path string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	name, ok := networkMagic[uint32(st.Type)]
+	return name, ok
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || windows)
+
+package main
+
+// networkFS reports whether path is on a network file system. This platform
+// gives no way to tell, so it never is.
+func networkFS(path string) (string, bool) {
+	return "", false
+}
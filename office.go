@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"time"
+)
+
+// OfficeProps are the document properties of a Word, Excel or PowerPoint
+// file (docx, xlsx, pptx and the other Office Open XML formats) that
+// templates can use as {{.Office.Author}}. Fields the document lacks are
+// empty, and all of them are for other files.
+type OfficeProps struct {
+	Title          string
+	Subject        string
+	Author         string
+	Keywords       string
+	Category       string
+	LastModifiedBy string
+	Company        string
+	Manager        string
+	Application    string    // e.g. "Microsoft Office Word"
+	Created        time.Time // when the document was created
+	Modified       time.Time // when it was last saved
+
+	isOffice bool
+}
+
+// officeFields are the OfficeProps fields a rule's office condition can
+// match, by their name there. The dates match as 2006-01-02.
+var officeFields = []string{"application", "author", "category", "company", "created", "keywords", "last_modified_by", "manager", "modified", "subject", "title"}
+
+// field returns the field named name in officeFields.
+func (o OfficeProps) field(name string) string {
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02")
+	}
+	switch name {
+	case "application":
+		return o.Application
+	case "author":
+		return o.Author
+	case "category":
+		return o.Category
+	case "company":
+		return o.Company
+	case "created":
+		return date(o.Created)
+	case "keywords":
+		return o.Keywords
+	case "last_modified_by":
+		return o.LastModifiedBy
+	case "manager":
+		return o.Manager
+	case "modified":
+		return date(o.Modified)
+	case "subject":
+		return o.Subject
+	case "title":
+		return o.Title
+	}
+	return ""
+}
+
+// Office returns the document properties of the Office file.
+func (f File) Office() OfficeProps {
+	return readMeta(f, "office", func(path string) any {
+		if path == "" {
+			return OfficeProps{}
+		}
+		props, _ := readOfficeProps(path)
+		return props
+	}).(OfficeProps)
+}
+
+// maxOfficeProps is how big a properties part may be.
+const maxOfficeProps = 1 << 20
+
+// errNotOffice is returned for files that are not Office documents.
+var errNotOffice = errors.New("not an Office document")
+
+// readOfficeProps reads the core and extended properties of the Office
+// document at path.
+func readOfficeProps(path string) (OfficeProps, error) {
+	r, err := zip.OpenReader(longPath(path))
+	if err != nil {
+		return OfficeProps{}, errNotOffice
+	}
+	defer r.Close()
+	var core struct {
+		Title          string `xml:"title"`
+		Subject        string `xml:"subject"`
+		Creator        string `xml:"creator"`
+		Keywords       string `xml:"keywords"`
+		Category       string `xml:"category"`
+		LastModifiedBy string `xml:"lastModifiedBy"`
+		Created        string `xml:"created"`
+		Modified       string `xml:"modified"`
+	}
+	var app struct {
+		Company     string `xml:"Company"`
+		Manager     string `xml:"Manager"`
+		Application string `xml:"Application"`
+	}
+	found := false
+	for _, part := range r.File {
+		var v any
+		switch part.Name {
+		case "docProps/core.xml":
+			v, found = &core, true
+		case "docProps/app.xml":
+			v = &app
+		default:
+			continue
+		}
+		rc, err := part.Open()
+		if err != nil {
+			return OfficeProps{}, err
+		}
+		err = xml.NewDecoder(io.LimitReader(rc, maxOfficeProps)).Decode(v)
+		rc.Close()
+		if err != nil {
+			return OfficeProps{}, err
+		}
+	}
+	if !found {
+		return OfficeProps{}, errNotOffice
+	}
+	return OfficeProps{
+		Title:          metaText(core.Title),
+		Subject:        metaText(core.Subject),
+		Author:         metaText(core.Creator),
+		Keywords:       metaText(core.Keywords),
+		Category:       metaText(core.Category),
+		LastModifiedBy: metaText(core.LastModifiedBy),
+		Company:        metaText(app.Company),
+		Manager:        metaText(app.Manager),
+		Application:    metaText(app.Application),
+		Created:        officeDate(core.Created),
+		Modified:       officeDate(core.Modified),
+		isOffice:       true,
+	}, nil
+}
+
+// officeDate parses a W3C date such as "2024-05-17T14:03:22Z", or just
+// "2024-05-17" in local time. It returns the zero time for dates that are
+// missing or malformed.
+func officeDate(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t
+	}
+	return time.Time{}
+}
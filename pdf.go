@@ -0,0 +1,923 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PDFInfo is the document information of a PDF file that templates can use
+// as {{.PDF.Title}}. Fields the document lacks are empty, and all of them
+// are for other files and encrypted PDFs.
+type PDFInfo struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	Creator  string    // application the document was made in, e.g. "Microsoft Word"
+	Producer string    // application that wrote the PDF, e.g. "ScanSnap Manager"
+	Created  time.Time // when the document was created, in its own time zone if recorded, else local time
+	Modified time.Time // when it was last changed, likewise
+
+	isPDF bool
+}
+
+// pdfFields are the PDFInfo fields a rule's pdf condition can match, by
+// their name there.
+var pdfFields = []string{"author", "creator", "keywords", "producer", "subject", "title"}
+
+// field returns the field named name in pdfFields.
+func (p PDFInfo) field(name string) string {
+	switch name {
+	case "author":
+		return p.Author
+	case "creator":
+		return p.Creator
+	case "keywords":
+		return p.Keywords
+	case "producer":
+		return p.Producer
+	case "subject":
+		return p.Subject
+	case "title":
+		return p.Title
+	}
+	return ""
+}
+
+// PDF returns the document information of the PDF file.
+func (f File) PDF() PDFInfo {
+	return readMeta(f, "pdf", func(path string) any {
+		if path == "" {
+			return PDFInfo{}
+		}
+		info, _ := readPDFInfo(path)
+		return info
+	}).(PDFInfo)
+}
+
+// Limits on what is read of a PDF file.
+const (
+	pdfWindow     = 64 << 10 // bytes read for one object
+	pdfXrefWindow = 8 << 20  // bytes read for a cross-reference table
+	pdfMaxStream  = 32 << 20 // decoded size of a cross-reference or object stream
+	pdfMaxDepth   = 64       // nesting of arrays and dictionaries
+	pdfMaxUpdates = 100      // incremental updates followed back
+)
+
+// errNotPDF is returned for files that are not PDFs.
+var errNotPDF = errors.New("not a PDF")
+
+// readPDFInfo reads the document information dictionary of the PDF at path.
+func readPDFInfo(path string) (PDFInfo, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return PDFInfo{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return PDFInfo{}, err
+	}
+	head := make([]byte, min(stat.Size(), 1024))
+	if _, err := f.ReadAt(head, 0); err != nil || !bytes.Contains(head, []byte("%PDF-")) {
+		return PDFInfo{}, errNotPDF
+	}
+	p := &pdfReader{r: f, size: stat.Size(), xref: map[int]pdfXref{}, streams: map[int]*pdfObjStream{}}
+	info := PDFInfo{isPDF: true}
+	var ref any
+	if trailer, err := p.loadXref(); err == nil {
+		if trailer["Encrypt"] != nil {
+			return info, nil // Its strings are encrypted.
+		}
+		ref = trailer["Info"]
+	} else {
+		var encrypted bool
+		if ref, encrypted = p.findInfo(); encrypted {
+			return info, nil
+		}
+	}
+	dict, ok := p.resolve(ref, 0).(pdfDict)
+	if !ok {
+		return info, nil
+	}
+	text := func(key pdfName) string {
+		s, _ := p.resolve(dict[key], 0).(string)
+		return pdfText(s)
+	}
+	info.Title = metaText(text("Title"))
+	info.Author = metaText(text("Author"))
+	info.Subject = metaText(text("Subject"))
+	info.Keywords = metaText(text("Keywords"))
+	info.Creator = metaText(text("Creator"))
+	info.Producer = metaText(text("Producer"))
+	info.Created = pdfDate(text("CreationDate"))
+	info.Modified = pdfDate(text("ModDate"))
+	return info, nil
+}
+
+// PDF objects are parsed into these types, besides float64 for numbers,
+// string for strings, bool, nil for null and []any for arrays.
+type (
+	pdfName    string
+	pdfKeyword string // obj, stream, R, n, f, trailer, ...
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict   pdfDict
+		offset int64 // of its data in the file
+	}
+)
+
+// pdfXref is where an object is: at offset in the file, or at index in the
+// object stream numbered stream.
+type pdfXref struct {
+	offset int64
+	stream int
+	index  int
+}
+
+// pdfObjStream is a decoded object stream with the offsets of the objects
+// in it, in order.
+type pdfObjStream struct {
+	data    []byte
+	nums    []int
+	offsets []int
+}
+
+// pdfReader reads objects from a PDF file through its cross-reference
+// tables.
+type pdfReader struct {
+	r       io.ReaderAt
+	size    int64
+	xref    map[int]pdfXref       // latest entry for each object
+	streams map[int]*pdfObjStream // object streams read so far
+	scanned map[int]int64         // offsets of objects found by scanning the file
+}
+
+// window reads up to n bytes at offset.
+func (p *pdfReader) window(offset int64, n int64) ([]byte, error) {
+	if offset < 0 || offset >= p.size {
+		return nil, errors.New("offset outside the file")
+	}
+	b := make([]byte, min(n, p.size-offset))
+	if _, err := p.r.ReadAt(b, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return b, nil
+}
+
+// loadXref reads the cross-reference tables, newest first, and returns the
+// newest trailer.
+func (p *pdfReader) loadXref() (pdfDict, error) {
+	tail, err := p.window(max(p.size-2048, 0), 2048)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return nil, errors.New("no startxref")
+	}
+	parser := &pdfParser{b: tail, pos: i + len("startxref")}
+	v, err := parser.value(0)
+	start, ok := v.(float64)
+	if err != nil || !ok {
+		return nil, errors.New("malformed startxref")
+	}
+	var trailer pdfDict
+	seen := map[int64]bool{}
+	for offset := int64(start); !seen[offset] && len(seen) < pdfMaxUpdates; {
+		seen[offset] = true
+		t, err := p.readXref(offset)
+		if err != nil {
+			if trailer == nil {
+				return nil, err
+			}
+			break
+		}
+		if trailer == nil {
+			trailer = t
+		}
+		if stm, ok := t["XRefStm"].(float64); ok {
+			p.readXref(int64(stm)) // A hybrid file's compressed objects.
+		}
+		prev, ok := t["Prev"].(float64)
+		if !ok {
+			break
+		}
+		offset = int64(prev)
+	}
+	return trailer, nil
+}
+
+// readXref reads the cross-reference table or stream at offset into
+// p.xref, keeping newer entries, and returns its trailer.
+func (p *pdfReader) readXref(offset int64) (pdfDict, error) {
+	b, err := p.window(offset, pdfWindow)
+	if err != nil {
+		return nil, err
+	}
+	parser := &pdfParser{b: b}
+	parser.skipSpace()
+	if !bytes.HasPrefix(b[parser.pos:], []byte("xref")) {
+		v, _, err := p.objectAt(offset)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := v.(pdfStream)
+		if !ok || s.dict["Type"] != pdfName("XRef") {
+			return nil, errors.New("no cross-reference table at startxref")
+		}
+		return s.dict, p.readXrefStream(s)
+	}
+	if b, err = p.window(offset, pdfXrefWindow); err != nil {
+		return nil, err
+	}
+	parser.b = b
+	parser.pos += len("xref")
+	for {
+		v, err := parser.value(0)
+		if err != nil {
+			return nil, err
+		}
+		if v == pdfKeyword("trailer") {
+			v, err := parser.value(0)
+			dict, ok := v.(pdfDict)
+			if err != nil || !ok {
+				return nil, errors.New("malformed trailer")
+			}
+			return dict, nil
+		}
+		first, ok1 := v.(float64)
+		count, err := parser.value(0)
+		n, ok2 := count.(float64)
+		if err != nil || !ok1 || !ok2 {
+			return nil, errors.New("malformed cross-reference table")
+		}
+		for num := int(first); num < int(first)+int(n); num++ {
+			offset, err1 := parser.value(0)
+			_, err2 := parser.value(0)
+			kind, err3 := parser.value(0)
+			if err := errors.Join(err1, err2, err3); err != nil {
+				return nil, err
+			}
+			if at, ok := offset.(float64); ok && kind == pdfKeyword("n") {
+				p.setXref(num, pdfXref{offset: int64(at)})
+			}
+		}
+	}
+}
+
+// readXrefStream reads the entries of a cross-reference stream.
+func (p *pdfReader) readXrefStream(s pdfStream) error {
+	data, err := p.streamData(s)
+	if err != nil {
+		return err
+	}
+	w := pdfInts(s.dict["W"])
+	if len(w) != 3 || w[0] < 0 || w[1] < 0 || w[2] < 0 || w[0] > 8 || w[1] > 8 || w[2] > 8 || w[0]+w[1]+w[2] == 0 {
+		return errors.New("malformed cross-reference stream")
+	}
+	index := pdfInts(s.dict["Index"])
+	if index == nil {
+		size, _ := s.dict["Size"].(float64)
+		index = []int{0, int(size)}
+	}
+	field := func(b []byte) int64 {
+		var v int64
+		for _, c := range b {
+			v = v<<8 | int64(c)
+		}
+		return v
+	}
+	entry, pos := w[0]+w[1]+w[2], 0
+	for i := 0; i+1 < len(index); i += 2 {
+		for num := index[i]; num < index[i]+index[i+1] && pos+entry <= len(data); num++ {
+			e := data[pos : pos+entry]
+			pos += entry
+			typ := int64(1)
+			if w[0] > 0 {
+				typ = field(e[:w[0]])
+			}
+			f2, f3 := field(e[w[0]:w[0]+w[1]]), field(e[w[0]+w[1]:])
+			switch typ {
+			case 1:
+				p.setXref(num, pdfXref{offset: f2})
+			case 2:
+				p.setXref(num, pdfXref{stream: int(f2), index: int(f3)})
+			}
+		}
+	}
+	return nil
+}
+
+// setXref records where an object is unless a newer table already has.
+func (p *pdfReader) setXref(num int, x pdfXref) {
+	if _, ok := p.xref[num]; !ok {
+		p.xref[num] = x
+	}
+}
+
+// infoPattern matches a reference to the document information dictionary.
+var infoPattern = regexp.MustCompile(`/Info\s*(\d+)\s+(\d+)\s+R`)
+
+// findInfo looks for the document information dictionary's reference in
+// the end and start of a file whose cross-reference tables are broken,
+// and reports whether the file is encrypted.
+func (p *pdfReader) findInfo() (any, bool) {
+	for _, offset := range []int64{max(p.size-pdfWindow, 0), 0} {
+		b, err := p.window(offset, pdfWindow)
+		if err != nil {
+			continue
+		}
+		if m := infoPattern.FindAllSubmatch(b, -1); m != nil {
+			last := m[len(m)-1]
+			num, _ := strconv.Atoi(string(last[1]))
+			gen, _ := strconv.Atoi(string(last[2]))
+			return pdfRef{num, gen}, bytes.Contains(b, []byte("/Encrypt"))
+		}
+	}
+	return nil, false
+}
+
+// resolve follows v if it is a reference, returning nil for objects that
+// can't be read.
+func (p *pdfReader) resolve(v any, depth int) any {
+	ref, ok := v.(pdfRef)
+	if !ok {
+		return v
+	}
+	if depth > pdfMaxDepth {
+		return nil
+	}
+	obj, err := p.object(ref.num)
+	if err != nil {
+		return nil
+	}
+	return p.resolve(obj, depth+1)
+}
+
+// object reads the object numbered num.
+func (p *pdfReader) object(num int) (any, error) {
+	x, ok := p.xref[num]
+	if ok && x.stream != 0 {
+		return p.streamObject(x.stream, x.index, num)
+	}
+	if ok {
+		if v, n, err := p.objectAt(x.offset); err == nil && n == num {
+			return v, nil
+		}
+	}
+	// The table is missing or wrong: look for the object itself.
+	at, err := p.scan(num)
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := p.objectAt(at)
+	return v, err
+}
+
+// objectAt reads the object whose "num gen obj" header is at offset,
+// returning it and its number. Streams are returned as pdfStream.
+func (p *pdfReader) objectAt(offset int64) (any, int, error) {
+	b, err := p.window(offset, pdfWindow)
+	if err != nil {
+		return nil, 0, err
+	}
+	parser := &pdfParser{b: b}
+	num, err1 := parser.value(0)
+	_, err2 := parser.value(0)
+	kw, err3 := parser.value(0)
+	n, ok := num.(float64)
+	if errors.Join(err1, err2, err3) != nil || !ok || kw != pdfKeyword("obj") {
+		return nil, 0, fmt.Errorf("no object at offset %d", offset)
+	}
+	v, err := parser.value(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	if dict, ok := v.(pdfDict); ok {
+		parser.skipSpace()
+		if bytes.HasPrefix(b[parser.pos:], []byte("stream")) {
+			parser.pos += len("stream")
+			if bytes.HasPrefix(b[parser.pos:], []byte("\r\n")) {
+				parser.pos += 2
+			} else if parser.pos < len(b) && (b[parser.pos] == '\n' || b[parser.pos] == '\r') {
+				parser.pos++
+			}
+			return pdfStream{dict: dict, offset: offset + int64(parser.pos)}, int(n), nil
+		}
+	}
+	return v, int(n), nil
+}
+
+// scan looks through the whole file for the header of the object numbered
+// num, returning its offset.
+func (p *pdfReader) scan(num int) (int64, error) {
+	if at, ok := p.scanned[num]; ok {
+		return at, nil
+	}
+	pattern := regexp.MustCompile(fmt.Sprintf(`(?:^|[^0-9])(%d\s+\d+\s+obj)`, num))
+	const chunk, overlap = 1 << 20, 64
+	var found int64 = -1
+	for offset := int64(0); offset < p.size; offset += chunk - overlap {
+		b, err := p.window(offset, chunk)
+		if err != nil {
+			return 0, err
+		}
+		// Later definitions win, as with incremental updates.
+		for _, m := range pattern.FindAllSubmatchIndex(b, -1) {
+			found = offset + int64(m[2])
+		}
+		if offset+chunk >= p.size {
+			break
+		}
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("object %d not found", num)
+	}
+	if p.scanned == nil {
+		p.scanned = map[int]int64{}
+	}
+	p.scanned[num] = found
+	return found, nil
+}
+
+// streamObject reads the object numbered num at index in the object stream
+// numbered stream.
+func (p *pdfReader) streamObject(stream, index, num int) (any, error) {
+	s, ok := p.streams[stream]
+	if !ok {
+		x, ok := p.xref[stream]
+		if !ok || x.stream != 0 {
+			return nil, fmt.Errorf("object stream %d not found", stream)
+		}
+		v, _, err := p.objectAt(x.offset)
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := v.(pdfStream)
+		if !ok {
+			return nil, fmt.Errorf("object %d is not a stream", stream)
+		}
+		data, err := p.streamData(obj)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := obj.dict["N"].(float64)
+		first, _ := obj.dict["First"].(float64)
+		if first < 0 || int(first) > len(data) {
+			return nil, fmt.Errorf("malformed object stream %d", stream)
+		}
+		s = &pdfObjStream{data: data}
+		parser := &pdfParser{b: data[:int(first)]}
+		for i := 0; i < int(n); i++ {
+			num, err1 := parser.value(0)
+			at, err2 := parser.value(0)
+			numF, ok1 := num.(float64)
+			atF, ok2 := at.(float64)
+			if errors.Join(err1, err2) != nil || !ok1 || !ok2 || int(first)+int(atF) > len(data) {
+				break
+			}
+			s.nums = append(s.nums, int(numF))
+			s.offsets = append(s.offsets, int(first)+int(atF))
+		}
+		p.streams[stream] = s
+	}
+	if index < 0 || index >= len(s.offsets) || s.nums[index] != num {
+		return nil, fmt.Errorf("object %d not in object stream %d", num, stream)
+	}
+	parser := &pdfParser{b: s.data, pos: s.offsets[index]}
+	return parser.value(0)
+}
+
+// streamData reads and decodes the data of a stream.
+func (p *pdfReader) streamData(s pdfStream) ([]byte, error) {
+	length, ok := p.resolve(s.dict["Length"], 0).(float64)
+	if !ok || length < 0 || length > pdfMaxStream || s.offset+int64(length) > p.size {
+		return nil, errors.New("bad stream length")
+	}
+	data := make([]byte, int(length))
+	if _, err := p.r.ReadAt(data, s.offset); err != nil {
+		return nil, err
+	}
+	filters := []any{s.dict["Filter"]}
+	if list, ok := s.dict["Filter"].([]any); ok {
+		filters = list
+	}
+	for _, filter := range filters {
+		switch filter {
+		case nil:
+		case pdfName("FlateDecode"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			data, err = io.ReadAll(io.LimitReader(zr, pdfMaxStream))
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+	}
+	if params, ok := p.resolve(s.dict["DecodeParms"], 0).(pdfDict); ok {
+		if predictor, _ := params["Predictor"].(float64); predictor >= 10 {
+			columns, ok := params["Columns"].(float64)
+			if !ok {
+				columns = 1
+			}
+			return pngUnpredict(data, int(columns))
+		}
+	}
+	return data, nil
+}
+
+// pngUnpredict reverses the PNG prediction of rows of columns bytes, each
+// preceded by its filter type, as used by cross-reference streams.
+func pngUnpredict(data []byte, columns int) ([]byte, error) {
+	if columns <= 0 || len(data)%(columns+1) != 0 {
+		return nil, errors.New("malformed predicted stream")
+	}
+	out := make([]byte, 0, len(data)/(columns+1)*columns)
+	prev := make([]byte, columns)
+	for i := 0; i < len(data); i += columns + 1 {
+		filter, row := data[i], data[i+1:i+1+columns]
+		cur := make([]byte, columns)
+		for j, c := range row {
+			var left, upLeft byte
+			if j > 0 {
+				left, upLeft = cur[j-1], prev[j-1]
+			}
+			up := prev[j]
+			switch filter {
+			case 0:
+			case 1:
+				c += left
+			case 2:
+				c += up
+			case 3:
+				c += byte((int(left) + int(up)) / 2)
+			case 4:
+				c += paeth(left, up, upLeft)
+			default:
+				return nil, errors.New("malformed predicted stream")
+			}
+			cur[j] = c
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+// paeth is the PNG Paeth predictor.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// pdfInts returns an array of numbers as ints, or nil if v is not one.
+func pdfInts(v any) []int {
+	list, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	ints := make([]int, 0, len(list))
+	for _, item := range list {
+		n, ok := item.(float64)
+		if !ok || n != math.Trunc(n) {
+			return nil
+		}
+		ints = append(ints, int(n))
+	}
+	return ints
+}
+
+// pdfParser parses PDF objects from b, starting at pos.
+type pdfParser struct {
+	b   []byte
+	pos int
+}
+
+// isPDFSpace reports whether c is PDF white space.
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+// isPDFDelim reports whether c ends a PDF token.
+func isPDFDelim(c byte) bool {
+	return isPDFSpace(c) || strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// skipSpace skips white space and comments.
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.b) {
+		switch c := p.b[p.pos]; {
+		case isPDFSpace(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.b) && p.b[p.pos] != '\n' && p.b[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token returns the regular characters at pos.
+func (p *pdfParser) token() string {
+	start := p.pos
+	for p.pos < len(p.b) && !isPDFDelim(p.b[p.pos]) {
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
+
+// value parses the next object; depth is how deeply it is nested.
+func (p *pdfParser) value(depth int) (any, error) {
+	if depth > pdfMaxDepth {
+		return nil, errors.New("PDF objects nested too deeply")
+	}
+	p.skipSpace()
+	if p.pos >= len(p.b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch c := p.b[p.pos]; {
+	case c == '/':
+		p.pos++
+		return pdfName(pdfUnescapeName(p.token())), nil
+	case c == '(':
+		return p.literal()
+	case c == '<' && p.pos+1 < len(p.b) && p.b[p.pos+1] == '<':
+		p.pos += 2
+		dict := pdfDict{}
+		for {
+			p.skipSpace()
+			if bytes.HasPrefix(p.b[p.pos:], []byte(">>")) {
+				p.pos += 2
+				return dict, nil
+			}
+			key, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, errors.New("malformed PDF dictionary")
+			}
+			if dict[name], err = p.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+	case c == '<':
+		return p.hex()
+	case c == '[':
+		p.pos++
+		var list []any
+		for {
+			p.skipSpace()
+			if p.pos < len(p.b) && p.b[p.pos] == ']' {
+				p.pos++
+				return list, nil
+			}
+			v, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case c == '+' || c == '-' || c == '.' || c >= '0' && c <= '9':
+		return p.number()
+	case isPDFDelim(c):
+		p.pos++
+		return nil, fmt.Errorf("unexpected %q in PDF", c)
+	}
+	switch word := p.token(); word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKeyword(word), nil
+	}
+}
+
+// number parses a number, or a "num gen R" reference.
+func (p *pdfParser) number() (any, error) {
+	word := p.token()
+	n, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed PDF number %q", word)
+	}
+	if strings.IndexAny(word, "+-.") >= 0 {
+		return n, nil
+	}
+	save := p.pos
+	p.skipSpace()
+	if gen, err := strconv.Atoi(p.token()); err == nil && gen >= 0 {
+		p.skipSpace()
+		if p.pos < len(p.b) && p.b[p.pos] == 'R' && (p.pos+1 == len(p.b) || isPDFDelim(p.b[p.pos+1])) {
+			p.pos++
+			return pdfRef{int(n), gen}, nil
+		}
+	}
+	p.pos = save
+	return n, nil
+}
+
+// literal parses a (string), with its escapes and balanced parentheses.
+func (p *pdfParser) literal() (any, error) {
+	p.pos++
+	var s []byte
+	for depth := 1; p.pos < len(p.b); {
+		c := p.b[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return string(s), nil
+			}
+		case '\\':
+			if p.pos >= len(p.b) {
+				break
+			}
+			c = p.b[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+					p.pos++
+				}
+				continue // A line continuation.
+			case '\n':
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v := int(c - '0')
+				for i := 0; i < 2 && p.pos < len(p.b) && p.b[p.pos] >= '0' && p.b[p.pos] <= '7'; i++ {
+					v = v*8 + int(p.b[p.pos]-'0')
+					p.pos++
+				}
+				c = byte(v)
+			}
+		}
+		s = append(s, c)
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// hex parses a <hex string>.
+func (p *pdfParser) hex() (any, error) {
+	p.pos++
+	var digits []byte
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		p.pos++
+		switch {
+		case c == '>':
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			s := make([]byte, len(digits)/2)
+			for i := range s {
+				v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+				if err != nil {
+					return nil, errors.New("malformed PDF hex string")
+				}
+				s[i] = byte(v)
+			}
+			return string(s), nil
+		case !isPDFSpace(c):
+			digits = append(digits, c)
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// pdfUnescapeName decodes the #xx escapes of a name.
+func pdfUnescapeName(s string) string {
+	if !strings.Contains(s, "#") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// pdfDocEncoding maps the bytes of PDFDocEncoding that differ from Latin-1.
+var pdfDocEncoding = map[byte]rune{
+	0x80: '•', 0x81: '†', 0x82: '‡', 0x83: '…', 0x84: '—', 0x85: '–', 0x86: 'ƒ', 0x87: '⁄',
+	0x88: '‹', 0x89: '›', 0x8A: '−', 0x8B: '‰', 0x8C: '„', 0x8D: '“', 0x8E: '”', 0x8F: '‘',
+	0x90: '’', 0x91: '‚', 0x92: '™', 0x93: 'ﬁ', 0x94: 'ﬂ', 0x95: 'Ł', 0x96: 'Œ', 0x97: 'Š',
+	0x98: 'Ÿ', 0x99: 'Ž', 0x9A: 'ı', 0x9B: 'ł', 0x9C: 'œ', 0x9D: 'š', 0x9E: 'ž', 0xA0: '€',
+}
+
+// pdfText decodes a PDF text string: UTF-16BE or UTF-8 after a byte order
+// mark, else PDFDocEncoding.
+func pdfText(s string) string {
+	switch {
+	case strings.HasPrefix(s, "\xFE\xFF"):
+		units := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case strings.HasPrefix(s, "\xEF\xBB\xBF"):
+		return strings.ToValidUTF8(s[3:], "�")
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if r, ok := pdfDocEncoding[s[i]]; ok {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(rune(s[i]))
+		}
+	}
+	return b.String()
+}
+
+// pdfDate parses a PDF date such as "D:20240517140322+02'00'", in its time
+// zone, or local time without one. Anything after the year is optional. It
+// returns the zero time for dates that are missing or malformed.
+func pdfDate(s string) time.Time {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	n := 0
+	for n < len(s) && n < 14 && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	if n -= n % 2; n < 4 {
+		return time.Time{}
+	}
+	loc := time.Local
+	if zone := strings.ReplaceAll(s[n:], "'", ""); zone != "" {
+		switch zone[0] {
+		case 'Z':
+			loc = time.UTC
+		case '+', '-':
+			hours, err1 := strconv.Atoi(zone[1:min(3, len(zone))])
+			minutes, err2 := 0, error(nil)
+			if len(zone) >= 5 {
+				minutes, err2 = strconv.Atoi(zone[3:5])
+			}
+			if err1 == nil && err2 == nil {
+				offset := (hours*60 + minutes) * 60
+				if zone[0] == '-' {
+					offset = -offset
+				}
+				loc = time.FixedZone("", offset)
+			}
+		}
+	}
+	t, err := time.ParseInLocation("20060102150405"[:n], s[:n], loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
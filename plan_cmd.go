@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// planVersion is the version of the plan file format.
+const planVersion = 1
+
+// runPlan is what "organizer plan" writes and "organizer apply" carries
+// out: every step of a run as it was decided, and the flags that shape how
+// the steps are carried out.
+type runPlan struct {
+	Version  int               `json:"version"`
+	Created  time.Time         `json:"created"`
+	Dirs     []string          `json:"dirs"`     // the directories planned
+	Settings map[string]string `json:"settings"` // see currentSettings
+	Steps    []planStep        `json:"steps"`
+
+	mu sync.Mutex
+}
+
+// planStep is one file's plan, with the size and modification time it had
+// when planned, and what was at its destination then.
+type planStep struct {
+	journalOp
+	Size     int64      `json:"size"`
+	ModTime  time.Time  `json:"mod_time"`
+	Existing *planEntry `json:"existing,omitempty"` // nil if the destination was free
+}
+
+// planEntry is what was at a step's destination when it was planned.
+type planEntry struct {
+	Dir     bool      `json:"dir,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// planning is set by "organizer plan": the run is planned, and the plan
+// written to planOutput, instead of carried out.
+var (
+	planning    bool
+	planOutput  string
+	pendingPlan = &runPlan{Version: planVersion}
+)
+
+// add records the plans of files that have something to do.
+func (rp *runPlan) add(plans []plannedFile) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	for _, p := range plans {
+		op, ok := planOp(p)
+		if !ok {
+			continue
+		}
+		op.absolutize()
+		op.Time = time.Now().UTC()
+		step := planStep{journalOp: op, Size: p.file.Size, ModTime: p.file.ModTime.UTC()}
+		if op.Dest != "" && !isRemoteURL(op.Dest) {
+			if info, err := os.Lstat(longPath(op.Dest)); err == nil {
+				step.Existing = &planEntry{Dir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime().UTC()}
+			}
+		}
+		rp.Steps = append(rp.Steps, step)
+	}
+}
+
+// write saves the plan of a run over dirs to path.
+func (rp *runPlan) write(path string, dirs []string) error {
+	rp.Created = time.Now().UTC()
+	rp.Settings = currentSettings()
+	rp.Dirs = nil
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		rp.Dirs = append(rp.Dirs, dir)
+	}
+	data, err := json.MarshalIndent(rp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// readPlan reads a plan file.
+func readPlan(path string) (*runPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rp := &runPlan{}
+	if err := json.Unmarshal(data, rp); err != nil {
+		return nil, fmt.Errorf("%s is not a plan: %v", path, err)
+	}
+	if rp.Version != planVersion {
+		return nil, fmt.Errorf("%s is a version %d plan; this version reads version %d", path, rp.Version, planVersion)
+	}
+	if rp.Settings == nil {
+		return nil, fmt.Errorf("%s has no settings", path)
+	}
+	return rp, nil
+}
+
+// changed reports how the step's file, or what is at its destination,
+// differs from when it was planned, or "" if neither does. Folders are
+// compared by modification time only. A destination that has become free
+// since is fine.
+func (s planStep) changed() string {
+	if why := s.sourceChanged(); why != "" {
+		return why
+	}
+	if s.Dest == "" || isRemoteURL(s.Dest) {
+		return ""
+	}
+	info, err := os.Lstat(longPath(s.Dest))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return ""
+	case err != nil:
+		return err.Error()
+	case s.Existing == nil:
+		return fmt.Sprintf("its destination %s was taken", s.Dest)
+	case info.IsDir() != s.Existing.Dir || !info.IsDir() && info.Size() != s.Existing.Size || !info.ModTime().Equal(s.Existing.ModTime):
+		return fmt.Sprintf("its destination %s was changed", s.Dest)
+	}
+	return ""
+}
+
+// sourceChanged reports how the step's file differs from when it was
+// planned, or "" if it doesn't.
+func (s planStep) sourceChanged() string {
+	stat := os.Stat
+	if s.Symlink {
+		stat = os.Lstat
+	}
+	info, err := stat(longPath(s.Source))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return "no longer exists"
+	case err != nil:
+		return err.Error()
+	case info.IsDir() != s.Unit:
+		return "is no longer the same kind of file"
+	case !s.Unit && info.Size() != s.Size:
+		return fmt.Sprintf("size changed from %s to %s", ByteSize(s.Size), ByteSize(info.Size()))
+	case !info.ModTime().Equal(s.ModTime):
+		return fmt.Sprintf("modified %s", info.ModTime().Format(time.DateTime))
+	}
+	return ""
+}
+
+// runApply implements "organizer apply <plan>": it carries out exactly
+// the steps of a plan written by "organizer plan", and refuses to start if
+// any file they touch, or any of their destinations, changed since.
+func runApply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Check the plan and show what it would do without changing anything")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer apply [-dry-run] <plan.json>")
+		return 2
+	}
+	rp, err := readPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	return applyPlan(rp, *dryRun)
+}
+
+// applyPlan carries out the plan, unless any of its files or destinations
+// changed, and returns the process exit code. The run locks are taken
+// first, so nothing can change between the check and the steps.
+func applyPlan(rp *runPlan, dryRun bool) int {
+	if !dryRun {
+		release, err := lockDirs(rp.Dirs)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		defer release()
+	}
+	stale := 0
+	for _, step := range rp.Steps {
+		if why := step.changed(); why != "" {
+			fmt.Printf("❌ %s: %s since the plan was made\n", step.Source, why)
+			stale++
+		}
+	}
+	if stale > 0 {
+		fmt.Printf("%d step(s) changed since %s; make a new plan\n", stale, rp.Created.Local().Format(time.DateTime))
+		return 1
+	}
+
+	if err := applySettings(rp.Settings); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("Applying %d step(s) planned %s\n", len(rp.Steps), rp.Created.Local().Format(time.DateTime))
+	report := &SkipReport{}
+	defer report.finish(false)
+	resetClaims()
+	if !dryRun {
+		runJournal = newJournal(rp.Dirs, false)
+		defer func() {
+			runJournal.skipped(report.Skips)
+			runJournal.pruneEmptyDirs()
+			runJournal.finish()
+			runJournal = nil
+		}()
+	}
+	plans := make([]plannedFile, len(rp.Steps))
+	for i, step := range rp.Steps {
+		runJournal.addPlan(step.journalOp)
+		plans[i] = step.plannedFile()
+	}
+	processPlans(feedPlans(plans), processWorkers, dryRun, report)
+	fmt.Println("Processing complete!")
+	return 0
+}
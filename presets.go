@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Presets are built-in rule sets that can be selected with -preset or
+// pulled into a config file with "include". They use the config file format.
+var Presets = map[string]string{
+	"downloads": `
+categories:
+  Images: [.jpg, .jpeg, .png, .gif, .webp, .svg, .heic]
+  Docs: [.pdf, .doc, .docx, .odt, .rtf, .txt, .md, .epub]
+  Spreadsheets: [.xls, .xlsx, .ods, .csv]
+  Presentations: [.ppt, .pptx, .odp, .key]
+  Videos: [.mp4, .mov, .avi, .mkv, .webm]
+  Audio: [.mp3, .wav, .ogg, .flac, .m4a]
+  Archives: [.zip, .tar, .gz, .tgz, .bz2, .xz, .7z, .rar]
+  Installers: [.dmg, .pkg, .exe, .msi, .deb, .rpm, .appimage, .iso]
+rules:
+  - name: screenshots
+    regex: '^(Screenshot|Screen Shot)'
+    category: Screenshots
+  - name: invoices
+    glob: "*invoice*"
+    extensions: [.pdf]
+    category: Finance
+exclude:
+  - "*.crdownload"
+  - "*.part"
+  - "*.download"
+`,
+	"photos": `
+categories:
+  Photos: [.jpg, .jpeg, .png, .heic, .heif, .webp, .tif, .tiff]
+  Raw: [.cr2, .cr3, .nef, .arw, .dng, .raf, .orf, .rw2]
+  Videos: [.mp4, .mov, .avi, .mts, .m2ts]
+  Sidecars: [.xmp, .aae]
+destination: "{{.Category}}/{{.Taken.Year}}/{{.Taken.Format \"01\"}}"
+`,
+	"dev-machine": `
+categories:
+  Code: [.go, .py, .js, .ts, .rs, .c, .h, .cpp, .java, .rb, .sh, .php]
+  Data: [.json, .csv, .yaml, .yml, .xml, .sql, .toml]
+  Archives: [.zip, .tar, .gz, .tgz, .xz, .7z]
+  Logs: [.log]
+  Docs: [.pdf, .md, .txt]
+  Images: [.png, .jpg, .jpeg, .gif, .svg]
+exclude:
+  - .git/
+  - node_modules/
+  - vendor/
+  - target/
+  - .venv/
+`,
+}
+
+// presetNames returns the sorted names of the built-in presets.
+func presetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadPresets parses the named presets and layers them in order, so later
+// presets take precedence over earlier ones.
+func loadPresets(names []string) (*Config, error) {
+	merged := &Config{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		text, ok := Presets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(presetNames(), ", "))
+		}
+		cfg, err := parseConfig([]byte(text))
+		if err != nil {
+			return nil, fmt.Errorf("preset %s: %v", name, err)
+		}
+		merged = merged.layer(cfg)
+	}
+	return merged, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reportProgress prints how many entries and directories the scan has read
+// every opts.Progress until done is closed, so a big tree doesn't look hung
+// before the first file moves. Scans that finish within one interval print
+// nothing. Reports go to stderr, keeping the run's output the same
+// whatever the timing.
+func (s *scanner) reportProgress(done <-chan struct{}) {
+	if s.opts.Progress <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.opts.Progress)
+	defer ticker.Stop()
+	start := time.Now()
+	reported := false
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprintf(os.Stderr, "⏳ Scanned %d entries in %d dirs...\n", s.entries.Load(), s.dirs.Load())
+			reported = true
+		case <-done:
+			if reported {
+				fmt.Fprintf(os.Stderr, "📂 Scanned %d entries in %d dirs in %v\n", s.entries.Load(), s.dirs.Load(), time.Since(start).Round(time.Millisecond))
+			}
+			return
+		}
+	}
+}
+
+// transferMinSize is the size from which a copy, compression or upload
+// shows its progress; smaller ones are done before anyone would wonder.
+const transferMinSize = 256 << 20
+
+// transferDelay is how long a transfer runs before its progress shows, so
+// fast local copies don't flash a bar.
+const transferDelay = time.Second
+
+// transferEvery holds -progress, how often transfers are reported when
+// stderr isn't a terminal. On a terminal a progress bar is redrawn
+// continuously.
+var transferEvery = 2 * time.Second
+
+// transfer is a large file being copied, compressed or uploaded.
+type transfer struct {
+	name  string
+	size  int64
+	pos   func() int64 // how many bytes are done
+	start time.Time
+}
+
+// transfers are the transfers in progress, drawn by one goroutine while
+// there are any.
+var transfers struct {
+	mu      sync.Mutex
+	active  []*transfer
+	drawing bool // the goroutine is running
+	drawn   bool // a bar is on the terminal
+}
+
+// stderrIsTerminal reports whether stderr is a terminal.
+var stderrIsTerminal = sync.OnceValue(func() bool {
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+})
+
+// startTransfer shows the progress of the named file of the given size,
+// with pos reporting how much is done, until finish is called. Small files
+// aren't shown, and finish is safe to call on the nil they get.
+func startTransfer(name string, size int64, pos func() int64) *transfer {
+	if size < transferMinSize || (transferEvery <= 0 && !stderrIsTerminal()) {
+		return nil
+	}
+	t := &transfer{name: name, size: size, pos: pos, start: time.Now()}
+	transfers.mu.Lock()
+	defer transfers.mu.Unlock()
+	transfers.active = append(transfers.active, t)
+	if !transfers.drawing {
+		transfers.drawing = true
+		go drawTransfers()
+	}
+	return t
+}
+
+// finish stops showing the transfer.
+func (t *transfer) finish() {
+	if t == nil {
+		return
+	}
+	transfers.mu.Lock()
+	defer transfers.mu.Unlock()
+	transfers.active = slices.DeleteFunc(transfers.active, func(a *transfer) bool { return a == t })
+}
+
+// filePos returns a pos for startTransfer that reads f's offset, which
+// moves as f is read or written, even by copy_file_range.
+func filePos(f *os.File) func() int64 {
+	return func() int64 {
+		off, _ := f.Seek(0, io.SeekCurrent)
+		return off
+	}
+}
+
+// countingReader counts what is read through it, for uploads.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// drawTransfers reports the active transfers until there are none. On a
+// terminal it keeps one line on stderr up to date with a bar for the
+// largest transfer left, and how many others there are; otherwise it
+// prints a line per transfer every transferEvery.
+func drawTransfers() {
+	tty, every := stderrIsTerminal(), transferEvery
+	if tty {
+		every = 250 * time.Millisecond
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for range ticker.C {
+		transfers.mu.Lock()
+		var shown []*transfer
+		for _, t := range transfers.active {
+			if time.Since(t.start) >= transferDelay {
+				shown = append(shown, t)
+			}
+		}
+		if len(transfers.active) == 0 {
+			if transfers.drawn {
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				transfers.drawn = false
+			}
+			transfers.drawing = false
+			transfers.mu.Unlock()
+			return
+		}
+		switch {
+		case len(shown) == 0:
+		case tty:
+			slices.SortFunc(shown, func(a, b *transfer) int { return cmp.Compare(b.size-b.pos(), a.size-a.pos()) })
+			line := shown[0].bar()
+			if len(shown) > 1 {
+				line += fmt.Sprintf(" (+%d more)", len(shown)-1)
+			}
+			// The cursor goes back to the start so other output overwrites
+			// the bar rather than following it.
+			fmt.Fprintf(os.Stderr, "\r\033[K%s\r", line)
+			transfers.drawn = true
+		default:
+			for _, t := range shown {
+				fmt.Fprintln(os.Stderr, t.status())
+			}
+		}
+		transfers.mu.Unlock()
+	}
+}
+
+// bar returns the transfer as a progress bar with its status.
+func (t *transfer) bar() string {
+	const width = 20
+	done := min(t.pos(), t.size)
+	filled := int(done * width / t.size)
+	name := t.name
+	if runes := []rune(name); len(runes) > 24 {
+		name = string(runes[:23]) + "…"
+	}
+	return fmt.Sprintf("⏳ %s [%s%s] %s", name, strings.Repeat("█", filled), strings.Repeat("░", width-filled), t.numbers(done))
+}
+
+// status returns the transfer's progress as a line of text.
+func (t *transfer) status() string {
+	return fmt.Sprintf("⏳ %s: %s", t.name, t.numbers(min(t.pos(), t.size)))
+}
+
+// numbers formats how far the transfer is, how fast it goes, and when it
+// should be done.
+func (t *transfer) numbers(done int64) string {
+	elapsed := time.Since(t.start)
+	rate := float64(done) / elapsed.Seconds()
+	text := fmt.Sprintf("%3d%% %s/%s %s/s", done*100/t.size, ByteSize(done), ByteSize(t.size), ByteSize(rate))
+	if rate > 0 {
+		eta := time.Duration(float64(t.size-done) / rate * float64(time.Second))
+		text += " ETA " + eta.Round(time.Second).String()
+	}
+	return text
+}
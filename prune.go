@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// pruneEmpty holds -prune-empty: folders inside the organized directories
+// that a run empties are removed at the end.
+var pruneEmpty bool
+
+// pruneEmptyDirs removes the folders the run's moves and deletions left
+// empty, deepest first, and their parents as they become empty in turn.
+// The organized directories themselves are never removed, nor are folders
+// that were already empty. Each removal is journaled so undo recreates it.
+func (j *journal) pruneEmptyDirs() {
+	if j == nil || !pruneEmpty || j.stopped() {
+		return
+	}
+	j.mu.Lock()
+	vacated := map[string]bool{}
+	for _, op := range j.ops {
+		if op.Action == ActionMove || op.Action == ActionDelete || (op.Action == ActionCompress || op.Action == ActionArchive) && runMode == ModeMove {
+			vacated[filepath.Dir(op.Source)] = true
+		}
+	}
+	j.mu.Unlock()
+	dirs := make([]string, 0, len(vacated))
+	for dir := range vacated {
+		dirs = append(dirs, dir)
+	}
+	// A folder's path is longer than its parent's.
+	sort.Slice(dirs, func(a, b int) bool { return len(dirs[a]) > len(dirs[b]) })
+
+	var removed []string
+	for _, dir := range dirs {
+		for d := dir; j.inside(d); d = filepath.Dir(d) {
+			if os.Remove(longPath(d)) != nil {
+				break // Not empty, or already gone.
+			}
+			j.add(journalOp{Action: opRmdir, Source: d})
+			removed = append(removed, d)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	sort.Strings(removed)
+	fmt.Printf("🧹 Removed %d empty folder(s):\n", len(removed))
+	for _, d := range removed {
+		fmt.Printf("  %s\n", d)
+	}
+}
+
+// inside reports whether dir is strictly below one of the directories the
+// run organizes.
+func (j *journal) inside(dir string) bool {
+	for _, root := range j.start.Dirs {
+		if dir != root && isWithin(dir, root) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// sysClonefileat is the clonefileat system call, which makes a
+// copy-on-write clone on APFS.
+const sysClonefileat = 462
+
+// atFDCWD is AT_FDCWD: paths are relative to the working directory.
+const atFDCWD = -2
+
+// cloneFile creates dst as a copy-on-write clone of src, keeping its
+// permissions and times. It fails rather than copying when the file system
+// can't clone, or src and dst are on different ones.
+func cloneFile(src, dst string) error {
+	from, err := syscall.BytePtrFromString(src)
+	if err != nil {
+		return err
+	}
+	to, err := syscall.BytePtrFromString(dst)
+	if err != nil {
+		return err
+	}
+	fd := atFDCWD
+	if _, _, errno := syscall.Syscall6(sysClonefileat, uintptr(fd), uintptr(unsafe.Pointer(from)), uintptr(fd), uintptr(unsafe.Pointer(to)), 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, which makes the destination share the
+// source's data blocks on Btrfs, XFS and other copy-on-write file systems.
+const ficlone = 0x40049409
+
+// cloneFile creates dst as a copy-on-write clone of src, keeping its
+// metadata. It fails rather than copying when the file system can't clone,
+// or src and dst are on different ones.
+func cloneFile(src, dst string) (err error) {
+	in, err := os.Open(longPath(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(longPath(dst), os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(longPath(dst))
+		}
+	}()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd()); errno != 0 {
+		return errno
+	}
+	return copyMetadata(src, info, dst)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// cloneFile would create dst as a copy-on-write clone of src; this
+// platform has no way to ask for one.
+func cloneFile(src, dst string) error {
+	return errors.New("reflinks are not supported on this platform")
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// remoteStore is a destination on another machine, such as one given as
+// -dest sftp://user@nas/organized. Paths are absolute slash-separated paths
+// on the store; missing files are reported as fs.ErrNotExist.
+type remoteStore interface {
+	// url returns the URL of the path p, as journaled and shown.
+	url(p string) string
+	stat(p string) (remoteInfo, error)
+	mkdirAll(dir string) error
+	// upload copies the local file to p, taking up a partial upload left
+	// by an interrupted run where the store can.
+	upload(local, p string) error
+	download(p, local string) error
+	remove(p string) error
+}
+
+// remoteInfo describes a file on a remote store. Stores that only show
+// modification times rounded down set the precision they have.
+type remoteInfo struct {
+	size      int64
+	modTime   time.Time
+	precision time.Duration
+	dir       bool
+}
+
+// remoteSchemes maps the URL schemes -dest accepts to their stores.
+var remoteSchemes = map[string]func(u *url.URL) (remoteStore, error){
+	"dav":  newWebDAVStore,
+	"davs": newWebDAVStore,
+	"s3":   newS3Store,
+	"sftp": newSFTPStore,
+}
+
+// remoteDest and remoteRoot are set when -dest is a remote URL: files are
+// uploaded below remoteRoot on it instead of moved into local folders.
+var (
+	remoteDest remoteStore
+	remoteRoot string
+)
+
+// remoteAttempts is how often a remote operation is tried before its file
+// fails.
+const remoteAttempts = 3
+
+// isRemoteURL reports whether s is a URL with a remote store's scheme.
+func isRemoteURL(s string) bool {
+	scheme, _, ok := strings.Cut(s, "://")
+	_, known := remoteSchemes[strings.ToLower(scheme)]
+	return ok && known
+}
+
+// openRemote returns the store for the URL s and the path on it that it
+// names.
+func openRemote(s string) (remoteStore, string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, "", err
+	}
+	open, ok := remoteSchemes[strings.ToLower(u.Scheme)]
+	if !ok {
+		schemes := make([]string, 0, len(remoteSchemes))
+		for scheme := range remoteSchemes {
+			schemes = append(schemes, scheme)
+		}
+		sort.Strings(schemes)
+		return nil, "", fmt.Errorf("unsupported scheme %q (supported: %s)", u.Scheme, strings.Join(schemes, ", "))
+	}
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("%s has no host", s)
+	}
+	store, err := open(u)
+	if err != nil {
+		return nil, "", err
+	}
+	root := path.Clean("/" + u.Path)
+	return store, root, nil
+}
+
+// setRemoteDest makes the URL s the destination of the run.
+func setRemoteDest(s string) error {
+	store, root, err := openRemote(s)
+	if err != nil {
+		return err
+	}
+	remoteDest, remoteRoot = store, root
+	return nil
+}
+
+// withRetries runs op until it succeeds, the file turns out to be missing
+// or it has been tried remoteAttempts times, waiting a little longer after
+// each failure, since networks and servers drop out for a moment.
+func withRetries(op func() error) error {
+	var err error
+	for attempt := 1; attempt <= remoteAttempts; attempt++ {
+		if err = op(); err == nil || errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if attempt < remoteAttempts {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+	}
+	return err
+}
+
+// uploadFile moves or copies the file into the folder rel below the remote
+// destination, named name. original is the name before -sanitize-names
+// changed it, if it did.
+func uploadFile(file File, action Action, rel, name, original string, dryRun bool) error {
+	switch {
+	case file.unit:
+		return errors.New("folders cannot be moved to a remote destination")
+	case file.symlink:
+		return errors.New("symbolic links cannot be moved to a remote destination")
+	case action == ActionCompress:
+		return errors.New("files cannot be compressed to a remote destination")
+	}
+	dir := path.Join(remoteRoot, filepath.ToSlash(rel))
+	dest, replace, err := claimRemote(file, path.Join(dir, name), dryRun)
+	if err != nil || dest == "" {
+		return err
+	}
+	url := remoteDest.url(dest)
+	if dryRun {
+		fmt.Printf("Would upload %q to %s\n", file.Name, url)
+		runHooks(file, url, true)
+		return nil
+	}
+	unlock, err := lockForMove(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := withRetries(func() error { return remoteDest.mkdirAll(dir) }); err != nil {
+		return fmt.Errorf("failed to create %s: %v", remoteDest.url(dir), err)
+	}
+	if replace {
+		// Servers can't set files aside, so undo can't bring it back.
+		runJournal.add(journalOp{Action: opReplace, Dest: url})
+	}
+	if err := withRetries(func() error { return remoteDest.upload(file.Path, dest) }); err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+	info, err := remoteDest.stat(dest)
+	if err != nil {
+		return fmt.Errorf("failed to check the upload: %v", err)
+	}
+	if info.size != file.Size {
+		return fmt.Errorf("uploaded %s of %s to %s", ByteSize(info.size), ByteSize(file.Size), url)
+	}
+	if action == ActionMove && runJournal.deferring() {
+		runJournal.remove(file.Path, action)
+	} else if action == ActionMove {
+		if err := os.Remove(longPath(file.Path)); err != nil {
+			return fmt.Errorf("uploaded to %s but failed to remove the original: %v", url, err)
+		}
+	}
+	runJournal.add(journalOp{Action: action, Source: file.Path, Dest: url, Original: original})
+	unlock()
+	runHooks(file, url, false)
+	return nil
+}
+
+// claimRemote decides where on the remote destination the file goes when p
+// is taken, following -on-conflict like claimDestination does for local
+// ones, and reports whether it replaces a file already there. Claims are
+// kept by URL. An empty path means the file stays where it is, which has
+// been reported.
+func claimRemote(file File, p string, dryRun bool) (string, bool, error) {
+	claimsMu.Lock()
+	defer claimsMu.Unlock()
+	info, err := remoteDest.stat(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", false, fmt.Errorf("failed to check %s: %v", remoteDest.url(p), err)
+	}
+	exists := err == nil
+	claimed, isClaimed := claims[remoteDest.url(p)]
+	if !exists && !isClaimed {
+		claims[remoteDest.url(p)] = file.ModTime
+		return p, false, nil
+	}
+	if diff := file.ModTime.Sub(info.modTime); exists && !isClaimed && !info.dir && runMode != ModeMove &&
+		info.size == file.Size && diff < info.precision+2*time.Second && diff > -2*time.Second {
+		// Uploaded by an earlier run.
+		if dryRun {
+			fmt.Printf("Would skip %q: %s is already a copy\n", file.Name, remoteDest.url(p))
+		}
+		return "", false, nil
+	}
+	existing := claimed
+	if exists && (!isClaimed || info.modTime.After(claimed)) {
+		existing = info.modTime
+	}
+
+	shown, reason := remoteDest.url(p), "already exists"
+	switch onConflict {
+	case ConflictNewerWins:
+		if !file.ModTime.After(existing) {
+			reason = "already exists and is not older"
+			break
+		}
+		fallthrough
+	case ConflictOverwrite:
+		if exists && info.dir {
+			return "", false, fmt.Errorf("%s already exists; folders are never overwritten", remoteDest.url(p))
+		}
+		claims[remoteDest.url(p)] = file.ModTime
+		return p, exists, nil
+	case ConflictRename:
+		free := remoteFreeName(p, file)
+		claims[remoteDest.url(free)] = file.ModTime
+		return free, false, nil
+	case ConflictHash:
+		sum, err := hashFile(file.Path)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to hash file: %v", err)
+		}
+		ext := path.Ext(p)
+		hashed := strings.TrimSuffix(p, ext) + "-" + sum[:8] + ext
+		_, isClaimed := claims[remoteDest.url(hashed)]
+		info, err := remoteDest.stat(hashed)
+		if isClaimed || (err == nil && !info.dir && info.size == file.Size && remoteSum(hashed) == sum) {
+			shown, reason = remoteDest.url(hashed), "has the same contents"
+			break
+		}
+		if err == nil {
+			hashed = remoteFreeName(hashed, file)
+		}
+		claims[remoteDest.url(hashed)] = file.ModTime
+		return hashed, false, nil
+	}
+	if dryRun {
+		fmt.Printf("Would skip %q: %s %s\n", file.Name, shown, reason)
+	} else {
+		fmt.Printf("⚠️ Skipped %q: %s %s\n", file.Name, shown, reason)
+	}
+	return "", false, nil
+}
+
+// remoteSum returns the SHA-256 of the file at p on the remote
+// destination, which is downloaded to a temporary folder to hash it, or ""
+// if it can't be.
+func remoteSum(p string) string {
+	tmp, err := os.MkdirTemp("", "organizer-remote-")
+	if err != nil {
+		return ""
+	}
+	defer os.RemoveAll(tmp)
+	local := filepath.Join(tmp, path.Base(p))
+	if err := withRetries(func() error { return remoteDest.download(p, local) }); err != nil {
+		return ""
+	}
+	sum, _ := hashFile(local)
+	return sum
+}
+
+// remoteFreeName is freeName for the remote destination. claimsMu must be
+// held.
+func remoteFreeName(p string, file File) string {
+	taken := func(p string) bool {
+		_, err := remoteDest.stat(p)
+		_, isClaimed := claims[remoteDest.url(p)]
+		return isClaimed || !errors.Is(err, fs.ErrNotExist)
+	}
+	ext := path.Ext(p)
+	stem := strings.TrimSuffix(p, ext)
+	if conflictSuffix == SuffixTimestamp {
+		stem += " " + file.ModTime.Format("2006-01-02 150405")
+		if !taken(stem + ext) {
+			return stem + ext
+		}
+	}
+	for i := 1; ; i++ {
+		if p := fmt.Sprintf("%s (%d)%s", stem, i, ext); !taken(p) {
+			return p
+		}
+	}
+}
+
+// undoRemote reverses an upload journaled by uploadFile: a moved file is
+// downloaded back unless its original is still there, as when an -atomic
+// run is rolled back before removing it, and the upload removed. A file
+// the upload replaced is gone for good.
+func (op journalOp) undoRemote() error {
+	if op.Action == opReplace {
+		return fmt.Errorf("the file replaced at %s cannot be restored", op.Dest)
+	}
+	store, p, err := openRemote(op.Dest)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(longPath(op.Source)); op.Action == ActionMove && errors.Is(err, fs.ErrNotExist) {
+		if err := withRetries(func() error { return store.download(p, op.Source) }); err != nil {
+			return fmt.Errorf("failed to download %s back to %s: %v", op.Dest, op.Source, err)
+		}
+	}
+	if err := withRetries(func() error { return store.remove(p) }); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %v", op.Dest, err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runReorganize implements "organizer reorganize": after the rules
+// change, it moves the files of an organized tree that "verify" would
+// report into the folders the rules now choose. Files keep their names and
+// are only ever moved, whatever action first put them there. The moves are
+// journaled as a run of their own, so undo takes them back.
+func runReorganize(args []string) int {
+	fs := flag.NewFlagSet("reorganize", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(envName("config")), "Path to a YAML config file")
+	preset := fs.String("preset", os.Getenv(envName("preset")), "Comma-separated built-in presets to use under the config")
+	profile := fs.String("profile", os.Getenv(envName("profile")), "Named profile from the config file to use")
+	dest := fs.String("dest", ".", "The organized tree: the directory holding the category folders")
+	dryRun := fs.Bool("dry-run", false, "Show what would be moved without moving it")
+	conflict := fs.String("on-conflict", ConflictRename, "What to do when a file of the same name is already there: skip, overwrite, rename, newer-wins, ask or hash-suffix")
+	fs.BoolVar(&pruneEmpty, "prune-empty", false, "Remove the folders the moves leave empty")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer reorganize [-config path] [-profile name] [-preset name] [-dest dir] [-on-conflict mode] [-prune-empty] [-dry-run]")
+		return 2
+	}
+	if strings.Contains(*dest, "://") {
+		fmt.Println("❌ reorganize works on local trees only")
+		return 1
+	}
+	switch *conflict {
+	case ConflictSkip, ConflictOverwrite, ConflictRename, ConflictNewerWins, ConflictAsk, ConflictHash:
+		onConflict = *conflict
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -on-conflict %q (valid: skip, overwrite, rename, newer-wins, ask, hash-suffix)\n", *conflict)
+		return 2
+	}
+	dir, err := filepath.Abs(expandHome(*dest))
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	cfg, err := loadGlobalConfig(*configPath)
+	if err == nil && *profile != "" {
+		cfg, err = cfg.selectProfile(*profile)
+	}
+	if err == nil {
+		err = prepareConfig(cfg, *preset, dir)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	if !*dryRun {
+		release, err := lockDirs([]string{dir})
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		defer release()
+		runJournal = newJournal([]string{dir}, false)
+		defer func() {
+			runJournal.pruneEmptyDirs()
+			runJournal.finish()
+			runJournal = nil
+		}()
+	}
+	checked, misplaced, err := findMisplaced(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	moved, failed := 0, 0
+	for _, m := range misplaced {
+		if m.err != nil {
+			fmt.Printf("❌ %s: %v\n", m.rel, m.err)
+			failed++
+			continue
+		}
+		file := m.file
+		file.plan = &journalOp{Action: ActionMove, Source: file.Path, Dest: filepath.Join(dir, m.want, filepath.Base(file.Path))}
+		err := executeAction(file, m.want, *dryRun)
+		runJournal.outcome(file, err)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", m.rel, err)
+			failed++
+			continue
+		}
+		moved++
+	}
+	if len(misplaced) == 0 {
+		fmt.Printf("✅ All %d organized file(s) are already where the current rules would put them\n", checked)
+		return 0
+	}
+	verb := "Moved"
+	if *dryRun {
+		verb = "Would move"
+	}
+	fmt.Printf("%s %d of %d organized file(s) whose folder changed\n", verb, moved, checked)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
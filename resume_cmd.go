@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// runResume implements "organizer resume": it takes up the latest run, or
+// the one given with -run, if it was interrupted, and carries out what its
+// journaled plan has left, without scanning or deciding anything again.
+func runResume(args []string) int {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	runID := fs.String("run", "", "ID of the interrupted run to resume (default: the latest run)")
+	dryRun := fs.Bool("dry-run", false, "Show what is left to do without changing anything")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer resume [-run ID] [-dry-run]")
+		return 2
+	}
+
+	runs, err := listRuns()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	var run *runRecord
+	for i := len(runs) - 1; i >= 0; i-- {
+		if *runID == "" || runs[i].ID == *runID {
+			run = &runs[i]
+			break
+		}
+	}
+	switch {
+	case run == nil && *runID != "":
+		fmt.Printf("❌ no journaled run %q; see history\n", *runID)
+		return 1
+	case run == nil, run.status() != "interrupted" && *runID == "":
+		fmt.Println("Nothing to resume")
+		return 0
+	case run.Undone:
+		fmt.Printf("❌ run %s has been undone\n", run.ID)
+		return 1
+	case run.Ended:
+		fmt.Printf("❌ run %s finished; there is nothing to resume\n", run.ID)
+		return 1
+	case run.Start.Atomic:
+		// Its deletions were still pending, and only in memory.
+		fmt.Printf("❌ run %s was -atomic; undo it with undo -run %s and organize again\n", run.ID, run.ID)
+		return 1
+	}
+	if err := run.restoreSettings(); err != nil {
+		fmt.Printf("❌ run %s: %v\n", run.ID, err)
+		return 1
+	}
+
+	left, done := run.remaining()
+	fmt.Printf("↪️ Resuming run %s: %d file(s) left\n", run.ID, len(left))
+	report := &SkipReport{}
+	defer report.finish(false)
+	resetClaims()
+	if !*dryRun {
+		release, err := lockDirs(run.Start.Dirs)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		defer release()
+		if runJournal, err = resumeJournal(*run); err != nil {
+			fmt.Printf("❌ Failed to open the journal of run %s: %v\n", run.ID, err)
+			return 1
+		}
+		defer func() {
+			runJournal.skipped(report.Skips)
+			runJournal.pruneEmptyDirs()
+			runJournal.finish()
+			runJournal = nil
+		}()
+	}
+	for _, op := range done {
+		// Handled just before the interruption, without an outcome yet.
+		runJournal.outcome(File{Name: filepath.Base(op.Source), Path: op.Source}, nil)
+	}
+	plans := make([]plannedFile, len(left))
+	for i, op := range left {
+		plans[i] = op.plannedFile()
+	}
+	processPlans(feedPlans(plans), processWorkers, *dryRun, report)
+	fmt.Println("Processing complete!")
+	return 0
+}
+
+// restoreSettings puts back the flags the run was started with that shape
+// how its plan is carried out.
+func (rec runRecord) restoreSettings() error {
+	if rec.Start.Settings == nil {
+		return errors.New("its settings were not journaled, so it cannot be resumed")
+	}
+	return applySettings(rec.Start.Settings)
+}
+
+// remaining returns the plans of files the run never finished, oldest
+// first, and separately those whose change was journaled but not their
+// outcome.
+func (rec runRecord) remaining() (left, done []journalOp) {
+	changed := map[string]bool{}
+	for _, op := range rec.Ops {
+		if op.isChange() {
+			changed[op.Source] = true
+		}
+	}
+	open := map[string]journalOp{}
+	var order []string
+	for _, e := range rec.Events {
+		switch e.Event {
+		case eventPlan:
+			open[e.Source] = e
+			order = append(order, e.Source)
+		case eventDone, eventFailed:
+			delete(open, e.Source)
+		}
+	}
+	for _, src := range order {
+		op, ok := open[src]
+		if !ok {
+			continue
+		}
+		delete(open, src)
+		if changed[src] {
+			done = append(done, op)
+		} else {
+			left = append(left, op)
+		}
+	}
+	return left, done
+}
+
+// plannedFile rebuilds the file the plan is for from what is on disk now,
+// with the destination directory the plan decided.
+func (op journalOp) plannedFile() plannedFile {
+	p := plannedFile{file: File{Name: filepath.Base(op.Source), Path: op.Source, root: op.Root}, rel: ".", planned: true}
+	stat := os.Stat
+	if op.Symlink {
+		stat = os.Lstat
+	}
+	info, err := stat(longPath(op.Source))
+	if errors.Is(err, fs.ErrNotExist) {
+		p.err = errors.New("no longer exists")
+	} else if err != nil {
+		p.err = err
+	} else {
+		p.file = newFile(op.Source, info)
+		p.file.root = op.Root
+		p.file.unit = op.Unit
+		p.file.symlink = op.Symlink
+	}
+	p.file.plan = &op
+	switch op.Action {
+	case ActionMove, ActionCopy, ActionCompress, ActionArchive:
+		if rel, err := filepath.Rel(p.file.baseDir(), filepath.Dir(op.Dest)); err == nil {
+			p.rel = rel
+		} else {
+			p.err = err
+		}
+	}
+	return p
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// learnedRulesName is the file next to the config file that holds the
+// rules "organizer review" learns. It is loaded underneath the config.
+const learnedRulesName = "learned.yaml"
+
+// runReview implements "organizer review": it goes through the files
+// -quarantine left in the directory's _Unsorted folder, asks which category
+// each belongs to and moves it there. When the answer is meant for every
+// file with that extension it is saved as a rule, and the remaining such
+// files follow it without asking.
+func runReview(args []string) int {
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(envName("config")), "Path to a YAML config file")
+	preset := fs.String("preset", os.Getenv(envName("preset")), "Comma-separated built-in presets to use under the config")
+	profile := fs.String("profile", os.Getenv(envName("profile")), "Named profile from the config file to use")
+	dryRun := fs.Bool("dry-run", false, "Ask, but only show what would be moved and learned")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer review [-config path] [-profile name] [-preset name] [-dry-run] [dir]")
+		return 2
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = expandHome(fs.Arg(0))
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	cfg, err := loadGlobalConfig(*configPath)
+	if err == nil && *profile != "" {
+		cfg, err = cfg.selectProfile(*profile)
+	}
+	if err == nil {
+		err = prepareConfig(cfg, *preset, dir)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	files, err := unsortedFiles(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Printf("Nothing to review in %s\n", filepath.Join(dir, unsortedFolder))
+		return 0
+	}
+
+	fmt.Printf("%d file(s) to review. Categories: %s\n", len(files), strings.Join(categoryOrder(Categories), ", "))
+	if !*dryRun {
+		release, err := lockDirs([]string{dir})
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		defer release()
+		runJournal = newJournal([]string{dir}, false)
+		defer func() {
+			runJournal.finish()
+			runJournal = nil
+		}()
+	}
+	learned := map[string]string{}
+	sorted := 0
+	for _, file := range files {
+		category, ok := learned[file.Extension]
+		if !ok {
+			var quit bool
+			if category, quit = askCategory(file); quit {
+				break
+			}
+			if category == "" {
+				continue
+			}
+		}
+		file.Category = category
+		rel, err := destinationFor(&file)
+		if err == nil {
+			err = executeAction(file, rel, *dryRun)
+		}
+		runJournal.outcome(file, err)
+		if err != nil {
+			fmt.Printf("❌ %q: %v\n", file.Name, err)
+			continue
+		}
+		sorted++
+		if ok || file.Extension == "" || !askYesNo(fmt.Sprintf("Send every %s file to %s from now on?", file.Extension, category)) {
+			continue
+		}
+		learned[file.Extension] = category
+		if *dryRun {
+			fmt.Printf("Would learn: %s files go to %s\n", file.Extension, category)
+			continue
+		}
+		path, err := learnRule(file.Extension, category)
+		if err != nil {
+			fmt.Printf("❌ failed to save the rule: %v\n", err)
+			continue
+		}
+		fmt.Printf("✅ Learned: %s files go to %s (%s)\n", file.Extension, category, path)
+	}
+	fmt.Printf("Reviewed %d of %d file(s)\n", sorted, len(files))
+	return 0
+}
+
+// unsortedFiles returns the files in dir's _Unsorted folder, by name.
+func unsortedFiles(dir string) ([]File, error) {
+	unsorted := filepath.Join(dir, unsortedFolder)
+	entries, err := os.ReadDir(unsorted)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == folderMarkerName {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Gone meanwhile.
+		}
+		file := newFile(filepath.Join(unsorted, entry.Name()), info)
+		file.root = dir
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// askCategory asks which category the file belongs to. An answer matching
+// a known category in anything but case is taken as that one; any other
+// name starts a new category. It returns "" to leave the file where it is
+// and quit to stop reviewing.
+func askCategory(file File) (category string, quit bool) {
+	for {
+		fmt.Printf("❓ %s (%s): category, [s]kip or [q]uit? ", file.Name, ByteSize(file.Size))
+		line, err := stdin.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		switch strings.ToLower(answer) {
+		case "s", "skip":
+			return "", false
+		case "q", "quit":
+			return "", true
+		case "":
+			if err != nil {
+				fmt.Println()
+				return "", true
+			}
+			continue
+		}
+		for name := range Categories {
+			if strings.EqualFold(name, answer) {
+				return name, false
+			}
+		}
+		if err := checkCategoryName(answer); err != nil {
+			fmt.Printf("⚠️ %v\n", err)
+			continue
+		}
+		return answer, false
+	}
+}
+
+// checkCategoryName rejects names that cannot be a folder inside the
+// organized directory.
+func checkCategoryName(name string) error {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%q is not a folder inside the directory", name)
+	}
+	return nil
+}
+
+// askYesNo asks the question and reports whether the answer was yes, the
+// default.
+func askYesNo(question string) bool {
+	fmt.Printf("❓ %s [Y/n] ", question)
+	line, _ := stdin.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "", "y", "yes":
+		return true
+	}
+	return false
+}
+
+// learnedRulesPath returns where learned rules are kept, or "" if no
+// location can be determined.
+func learnedRulesPath() string {
+	path := defaultConfigPath()
+	if path == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(path), learnedRulesName)
+}
+
+// loadLearnedRules loads the learned rules, or an empty config if there
+// are none yet.
+func loadLearnedRules() (*Config, error) {
+	path := learnedRulesPath()
+	if path == "" {
+		return &Config{}, nil
+	}
+	cfg, err := loadConfig(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load learned rules %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// learnRule appends a rule sending files with the extension to the
+// category to the learned rules file, creating it if needed, and returns
+// its path.
+func learnRule(ext, category string) (string, error) {
+	path := learnedRulesPath()
+	if path == "" {
+		return "", errors.New("cannot determine the config location")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		b.WriteString("# Rules learned by \"go-file-organizer review\", checked after those in\n# config.yaml. Edit or remove them freely.\nrules:\n")
+	}
+	fmt.Fprintf(&b, "  - name: %q\n    extensions: [%q]\n    category: %q\n", "learned "+ext, strings.TrimPrefix(ext, "."), category)
+	_, err = f.WriteString(b.String())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return path, err
+}
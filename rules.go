@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Rule assigns Category to files that satisfy all of its conditions.
+//
+// Rules are evaluated before the extension-based Categories fallback, in
+// descending Priority order; rules with equal priority keep the order they
+// were written in (.organizerrc rules before global ones). The first rule
+// that matches wins and no further rules are consulted.
+type Rule struct {
+	Name          string            `yaml:"name"`           // optional label used in messages
+	Priority      int               `yaml:"priority"`       // higher runs first, default 0
+	Glob          string            `yaml:"glob"`           // filename glob, e.g. "invoice-*.pdf" (case-insensitive)
+	Regex         string            `yaml:"regex"`          // filename regular expression
+	Extensions    []string          `yaml:"extensions"`     // any of these extensions
+	MIME          []string          `yaml:"mime"`           // any of these sniffed types, e.g. "application/pdf" or "image/*"
+	Source        []string          `yaml:"source"`         // file must come from one of these directories (or below)
+	MinSize       ByteSize          `yaml:"min_size"`       // at least this many bytes
+	MaxSize       ByteSize          `yaml:"max_size"`       // at most this many bytes
+	OlderThan     Age               `yaml:"older_than"`     // not modified for at least this long
+	NewerThan     Age               `yaml:"newer_than"`     // modified within this long
+	MinDuration   Age               `yaml:"min_duration"`   // a video at least this long
+	MaxDuration   Age               `yaml:"max_duration"`   // a video at most this long
+	MinResolution Resolution        `yaml:"min_resolution"` // a video at least this sharp, e.g. 4K, 1080p or 720p
+	MaxResolution Resolution        `yaml:"max_resolution"` // a video at most this sharp
+	Codec         []string          `yaml:"codec"`          // a video in any of these codecs, e.g. h264, hevc or av1
+	PDF           map[string]string `yaml:"pdf"`            // a PDF whose metadata fields match these globs, e.g. producer: "*ScanSnap*"
+	Office        map[string]string `yaml:"office"`         // a docx, xlsx or pptx whose properties match these globs, e.g. company: "Acme*"
+	Category      string            `yaml:"category"`       // destination category
+	Destination   string            `yaml:"destination"`    // optional destination template for this rule
+	Action        string            `yaml:"action"`         // move (default), copy, delete, skip, rename, compress, exec or archive
+	Rename        string            `yaml:"rename"`         // new-name template for the rename action, or for move, copy and compress
+	Exec          string            `yaml:"exec"`           // command template for the exec action
+	Timeout       Age               `yaml:"timeout"`        // exec action time limit, default 1m
+	Format        string            `yaml:"format"`         // archive action format: zip (default) or tar.zst
+
+	re     *regexp.Regexp     // compiled Regex
+	dest   *template.Template // compiled Destination
+	action Action             // parsed Action
+	rename *template.Template // compiled Rename
+	exec   *template.Template // compiled Exec
+}
+
+// Rules holds the active rules loaded from the config file.
+var Rules []Rule
+
+// compile validates the rule and prepares its matchers.
+func (r *Rule) compile() error {
+	if r.Category == "" {
+		return fmt.Errorf("rule %s: category is required", r.label())
+	}
+	if !r.hasCondition() {
+		return fmt.Errorf("rule %s: needs at least one condition", r.label())
+	}
+	if r.MaxSize > 0 && r.MinSize > r.MaxSize {
+		return fmt.Errorf("rule %s: min_size is larger than max_size", r.label())
+	}
+	if r.NewerThan > 0 && r.OlderThan >= r.NewerThan {
+		return fmt.Errorf("rule %s: older_than must be less than newer_than", r.label())
+	}
+	if r.MaxDuration > 0 && r.MinDuration > r.MaxDuration {
+		return fmt.Errorf("rule %s: min_duration is longer than max_duration", r.label())
+	}
+	if r.MaxResolution > 0 && r.MinResolution > r.MaxResolution {
+		return fmt.Errorf("rule %s: min_resolution is higher than max_resolution", r.label())
+	}
+	for i, codec := range r.Codec {
+		r.Codec[i] = strings.ToLower(strings.TrimSpace(codec))
+	}
+	if err := compileMetaGlobs(r.PDF, pdfFields); err != nil {
+		return fmt.Errorf("rule %s: pdf: %v", r.label(), err)
+	}
+	if err := compileMetaGlobs(r.Office, officeFields); err != nil {
+		return fmt.Errorf("rule %s: office: %v", r.label(), err)
+	}
+	for i, ext := range r.Extensions {
+		r.Extensions[i] = normalizeExt(ext)
+	}
+	for i, dir := range r.Source {
+		abs, err := filepath.Abs(expandHome(dir))
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid source %q: %v", r.label(), dir, err)
+		}
+		r.Source[i] = abs
+	}
+	if r.Glob != "" {
+		if _, err := filepath.Match(r.Glob, ""); err != nil {
+			return fmt.Errorf("rule %s: invalid glob %q: %v", r.label(), r.Glob, err)
+		}
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid regex %q: %v", r.label(), r.Regex, err)
+		}
+		r.re = re
+	}
+	if r.Destination != "" {
+		tmpl, err := parseDestination(r.Destination)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid destination: %v", r.label(), err)
+		}
+		r.dest = tmpl
+	}
+	action, err := parseAction(r.Action)
+	if err != nil {
+		return fmt.Errorf("rule %s: %v", r.label(), err)
+	}
+	r.action = action
+	switch {
+	case r.Format != "" && action != ActionArchive:
+		return fmt.Errorf("rule %s: format only applies to the archive action", r.label())
+	case r.Format != "" && r.Format != ArchiveZip && r.Format != ArchiveTarZst:
+		return fmt.Errorf("rule %s: unknown archive format %q (valid: %s, %s)", r.label(), r.Format, ArchiveZip, ArchiveTarZst)
+	}
+	if action == ActionRename && r.Rename == "" {
+		return fmt.Errorf("rule %s: the rename action needs a rename template", r.label())
+	}
+	if r.Rename != "" {
+		tmpl, err := parseDestination(r.Rename)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid rename template: %v", r.label(), err)
+		}
+		r.rename = tmpl
+	}
+	if action == ActionExec {
+		if r.Exec == "" {
+			return fmt.Errorf("rule %s: the exec action needs an exec command template", r.label())
+		}
+		tmpl, err := parseDestination(r.Exec)
+		if err != nil {
+			return fmt.Errorf("rule %s: invalid exec template: %v", r.label(), err)
+		}
+		r.exec = tmpl
+	}
+	return nil
+}
+
+// hasCondition reports whether the rule restricts which files it matches.
+func (r *Rule) hasCondition() bool {
+	return r.Glob != "" || r.Regex != "" || len(r.Extensions) > 0 || len(r.MIME) > 0 || len(r.Source) > 0 ||
+		r.MinSize > 0 || r.MaxSize > 0 || r.OlderThan > 0 || r.NewerThan > 0 || r.videoCondition() || len(r.PDF) > 0 || len(r.Office) > 0
+}
+
+// videoCondition reports whether the rule has conditions only videos can
+// meet.
+func (r *Rule) videoCondition() bool {
+	return r.MinDuration > 0 || r.MaxDuration > 0 || r.MinResolution > 0 || r.MaxResolution > 0 || len(r.Codec) > 0
+}
+
+// label returns the rule's name, or a description of its matcher.
+func (r *Rule) label() string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.Glob != "":
+		return fmt.Sprintf("glob %q", r.Glob)
+	case r.Regex != "":
+		return fmt.Sprintf("regex %q", r.Regex)
+	case r.Category != "":
+		return fmt.Sprintf("for %q", r.Category)
+	}
+	return "(unnamed)"
+}
+
+// Matches reports whether the file satisfies every condition set on the rule.
+func (r *Rule) Matches(f *File) bool {
+	return r.mismatch(f) == ""
+}
+
+// mismatch returns why the file fails the rule, or "" if it matches.
+// Content sniffing and metadata conditions are left until last because they
+// have to read the file.
+func (r *Rule) mismatch(f *File) string {
+	if r.Glob != "" {
+		ok, _ := filepath.Match(strings.ToLower(r.Glob), strings.ToLower(f.Name))
+		if !ok {
+			return fmt.Sprintf("name does not match glob %q", r.Glob)
+		}
+	}
+	if r.re != nil && !r.re.MatchString(f.Name) {
+		return fmt.Sprintf("name does not match regex %q", r.Regex)
+	}
+	if len(r.Extensions) > 0 && !containsExt(r.Extensions, f.Extension) {
+		return fmt.Sprintf("extension %q is not one of %s", f.Extension, strings.Join(r.Extensions, ", "))
+	}
+	if r.MinSize > 0 && f.Size < int64(r.MinSize) {
+		return fmt.Sprintf("size %s is below min_size %s", ByteSize(f.Size), r.MinSize)
+	}
+	if r.MaxSize > 0 && f.Size > int64(r.MaxSize) {
+		return fmt.Sprintf("size %s is above max_size %s", ByteSize(f.Size), r.MaxSize)
+	}
+	if len(r.Source) > 0 {
+		dir, _ := filepath.Abs(filepath.Dir(f.Path))
+		if !slices.ContainsFunc(r.Source, func(src string) bool { return isWithin(dir, src) }) {
+			return fmt.Sprintf("source directory %s is not one of %s", dir, strings.Join(r.Source, ", "))
+		}
+	}
+	age := time.Since(f.ModTime)
+	if r.OlderThan > 0 && age < time.Duration(r.OlderThan) {
+		return fmt.Sprintf("modified %s ago, not older than %s", Age(age.Round(time.Second)), r.OlderThan)
+	}
+	if r.NewerThan > 0 && age > time.Duration(r.NewerThan) {
+		return fmt.Sprintf("modified %s ago, not newer than %s", Age(age.Round(time.Second)), r.NewerThan)
+	}
+	if len(r.MIME) > 0 && !r.matchesMIME(f.DetectMIME()) {
+		return fmt.Sprintf("content type %q is not one of %s", f.MIME, strings.Join(r.MIME, ", "))
+	}
+	if r.videoCondition() {
+		if reason := r.videoMismatch(f.Video()); reason != "" {
+			return reason
+		}
+	}
+	if len(r.PDF) > 0 {
+		info := f.PDF()
+		if !info.isPDF {
+			return "not a PDF"
+		}
+		if field := metaMismatch(r.PDF, info.field); field != "" {
+			return fmt.Sprintf("PDF %s %q does not match %q", field, info.field(field), r.PDF[field])
+		}
+	}
+	if len(r.Office) > 0 {
+		props := f.Office()
+		if !props.isOffice {
+			return "not an Office document"
+		}
+		if field := metaMismatch(r.Office, props.field); field != "" {
+			return fmt.Sprintf("Office %s %q does not match %q", field, props.field(field), r.Office[field])
+		}
+	}
+	return ""
+}
+
+// compileMetaGlobs checks a metadata condition's globs, by field name, and
+// lowercases them so they match case-insensitively.
+func compileMetaGlobs(globs map[string]string, fields []string) error {
+	for field, glob := range globs {
+		if !slices.Contains(fields, field) {
+			return fmt.Errorf("unknown field %q (valid: %s)", field, strings.Join(fields, ", "))
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %q for %s: %v", glob, field, err)
+		}
+		globs[field] = strings.ToLower(glob)
+	}
+	return nil
+}
+
+// metaMismatch returns the first field, in name order, whose value doesn't
+// match its glob, or "" if all do.
+func metaMismatch(globs map[string]string, value func(field string) string) string {
+	fields := make([]string, 0, len(globs))
+	for field := range globs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if ok, _ := path.Match(globs[field], strings.ToLower(value(field))); !ok {
+			return field
+		}
+	}
+	return ""
+}
+
+// videoMismatch returns why the video fails the rule's video conditions, or
+// "" if it meets them. Files that aren't videos meet none, and neither
+// duration condition is met when the container doesn't record one.
+func (r *Rule) videoMismatch(v Video) string {
+	if v.Codec == "" {
+		return "not a video"
+	}
+	if (r.MinDuration > 0 || r.MaxDuration > 0) && v.Duration <= 0 {
+		return "video duration unknown"
+	}
+	if r.MinDuration > 0 && v.Duration < time.Duration(r.MinDuration) {
+		return fmt.Sprintf("video duration %s is below min_duration %s", Age(v.Duration.Round(time.Second)), r.MinDuration)
+	}
+	if r.MaxDuration > 0 && v.Duration > time.Duration(r.MaxDuration) {
+		return fmt.Sprintf("video duration %s is above max_duration %s", Age(v.Duration.Round(time.Second)), r.MaxDuration)
+	}
+	if r.MinResolution > 0 && v.lines() < int(r.MinResolution) {
+		return fmt.Sprintf("video resolution %dx%d is below min_resolution %s", v.Width, v.Height, r.MinResolution)
+	}
+	if r.MaxResolution > 0 && v.lines() > int(r.MaxResolution) {
+		return fmt.Sprintf("video resolution %dx%d is above max_resolution %s", v.Width, v.Height, r.MaxResolution)
+	}
+	if len(r.Codec) > 0 && !slices.Contains(r.Codec, v.Codec) {
+		return fmt.Sprintf("video codec %q is not one of %s", v.Codec, strings.Join(r.Codec, ", "))
+	}
+	return ""
+}
+
+// matchesMIME reports whether mime matches any of the rule's MIME patterns.
+func (r *Rule) matchesMIME(mime string) bool {
+	for _, pattern := range r.MIME {
+		if mimeMatches(pattern, mime) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileRules compiles every rule, returning the first error found, and
+// sorts them into evaluation order.
+func compileRules(rules []Rule) error {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return err
+		}
+	}
+	orderRules(rules)
+	return nil
+}
+
+// orderRules sorts rules by descending priority, keeping the written order
+// for rules of equal priority.
+func orderRules(rules []Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Priority > rules[j].Priority
+	})
+}
+
+// matchRule returns the first rule, in evaluation order, that matches the
+// file, or nil.
+func matchRule(f *File) *Rule {
+	for i := range Rules {
+		if Rules[i].Matches(f) {
+			return &Rules[i]
+		}
+	}
+	return nil
+}
+
+// covers reports whether r matches every file that o matches, meaning o can
+// never be reached when r is evaluated first. It is conservative: false
+// negatives are possible, false positives are not.
+func (r *Rule) covers(o *Rule) bool {
+	if r.Glob != "" && !strings.EqualFold(r.Glob, o.Glob) {
+		return false
+	}
+	if r.Regex != "" && r.Regex != o.Regex {
+		return false
+	}
+	if len(r.Extensions) > 0 {
+		if len(o.Extensions) == 0 {
+			return false
+		}
+		for _, ext := range o.Extensions {
+			if !containsExt(r.Extensions, ext) {
+				return false
+			}
+		}
+	}
+	if len(r.MIME) > 0 {
+		if len(o.MIME) == 0 {
+			return false
+		}
+		for _, pattern := range o.MIME {
+			// A wildcard is only covered by the same or a broader wildcard.
+			if strings.HasSuffix(pattern, "/*") {
+				if !slices.Contains(r.MIME, pattern) && !slices.Contains(r.MIME, "*") {
+					return false
+				}
+			} else if !r.matchesMIME(pattern) {
+				return false
+			}
+		}
+	}
+	if r.MinSize > o.MinSize {
+		return false
+	}
+	if r.MaxSize > 0 && (o.MaxSize == 0 || o.MaxSize > r.MaxSize) {
+		return false
+	}
+	if r.OlderThan > o.OlderThan {
+		return false
+	}
+	if r.NewerThan > 0 && (o.NewerThan == 0 || o.NewerThan > r.NewerThan) {
+		return false
+	}
+	if r.MinDuration > o.MinDuration || r.MinResolution > o.MinResolution {
+		return false
+	}
+	if r.MaxDuration > 0 && (o.MaxDuration == 0 || o.MaxDuration > r.MaxDuration) {
+		return false
+	}
+	if r.MaxResolution > 0 && (o.MaxResolution == 0 || o.MaxResolution > r.MaxResolution) {
+		return false
+	}
+	if len(r.Codec) > 0 {
+		if len(o.Codec) == 0 {
+			return false
+		}
+		for _, codec := range o.Codec {
+			if !slices.Contains(r.Codec, codec) {
+				return false
+			}
+		}
+	}
+	for field, glob := range r.PDF {
+		if o.PDF[field] != glob {
+			return false
+		}
+	}
+	for field, glob := range r.Office {
+		if o.Office[field] != glob {
+			return false
+		}
+	}
+	if len(r.Source) > 0 {
+		if len(o.Source) == 0 {
+			return false
+		}
+		for _, dir := range o.Source {
+			if !slices.ContainsFunc(r.Source, func(src string) bool { return isWithin(dir, src) }) {
+				return false
+			}
+		}
+	}
+	return true
+}
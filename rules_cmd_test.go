@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRulesTestFlagsAfterFilename(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	data := "categories:\n  Docs: [.pdf]\nrules:\n  - category: Large\n    min_size: 5MB\n"
+	if err := os.WriteFile(config, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"-config", config, "-dir", dir, "-size", "10MB", "-expect", "Large", "report.pdf"}, 0},
+		{[]string{"report.pdf", "-config", config, "-dir", dir, "-size", "10MB", "-expect", "Large"}, 0},
+		{[]string{"-config", config, "report.pdf", "-dir", dir, "-expect", "Docs"}, 0},
+		{[]string{"report.pdf", "-config", config, "-dir", dir, "-expect", "Large"}, 1},
+		{[]string{"report.pdf", "-config", config, "other.pdf"}, 2},
+	} {
+		if got := runRulesTest(tc.args); got != tc.want {
+			t.Errorf("rules test %q: exit code %d, want %d", tc.args, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+// runLockName is the lock file a run keeps in each directory it changes,
+// so a second run, say one started by cron while another was started by
+// hand, doesn't organize the same directory at the same time.
+const runLockName = ".organizer.lock"
+
+// errRunLocked is returned by lockRun when another run holds the lock.
+var errRunLocked = errors.New("locked")
+
+// lockDirs takes the run lock of each directory, plus -dest's if set, and
+// returns the function releasing them all. If another run holds one of the
+// locks, none are kept and the error names the directory.
+func lockDirs(dirs []string) (func(), error) {
+	var abs []string
+	for _, dir := range append(slices.Clip(dirs), destRoot) {
+		if dir == "" {
+			continue
+		}
+		if a, err := filepath.Abs(dir); err == nil {
+			dir = a
+		}
+		if !slices.Contains(abs, dir) {
+			abs = append(abs, dir)
+		}
+	}
+	var releases []func()
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	for _, dir := range abs {
+		r, holder, err := lockRun(filepath.Join(dir, runLockName))
+		if errors.Is(err, errRunLocked) {
+			release()
+			if holder != "" {
+				return nil, fmt.Errorf("another run (pid %s) is organizing %s", holder, dir)
+			}
+			return nil, fmt.Errorf("another run is organizing %s", dir)
+		}
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to lock %s: %v", dir, err)
+		}
+		releases = append(releases, r)
+	}
+	return release, nil
+}
@@ -0,0 +1,27 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// lockRun creates the lock file at path, failing if it exists. Without
+// file locks a run that crashed leaves it behind; remove it by hand.
+func lockRun(path string) (release func(), holder string, err error) {
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		data, _ := os.ReadFile(path)
+		return nil, strings.TrimSpace(string(data)), errRunLocked
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	fh.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	fh.Close()
+	return func() { os.Remove(path) }, "", nil
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockRun takes an exclusive flock on the lock file at path, creating it,
+// and records this process's ID in it. The lock goes away with the process,
+// so a run that crashed leaves nothing stale behind. When another run holds
+// it, holder is that run's process ID if known. Releasing removes the
+// file.
+func lockRun(path string) (release func(), holder string, err error) {
+	for {
+		fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := syscall.Flock(int(fh.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			data, _ := os.ReadFile(path)
+			fh.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, strings.TrimSpace(string(data)), errRunLocked
+			}
+			return nil, "", err
+		}
+		// The holder before us may have removed the file as we opened it;
+		// a lock on the removed file protects nothing.
+		opened, err := fh.Stat()
+		current, serr := os.Stat(path)
+		if err == nil && serr == nil && os.SameFile(opened, current) {
+			fh.Truncate(0)
+			fh.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			return func() {
+				os.Remove(path)
+				fh.Close()
+			}, "", nil
+		}
+		fh.Close()
+		if serr != nil && !errors.Is(serr, fs.ErrNotExist) {
+			return nil, "", serr
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "syscall"
+
+// lockRun opens the lock file at path without sharing, creating it. Windows
+// deletes it when the handle closes, including when the process dies, and
+// nobody else can open it meanwhile, so the holder's process ID can't be
+// read back.
+func lockRun(path string) (release func(), holder string, err error) {
+	name, err := syscall.UTF16PtrFromString(longPath(path))
+	if err != nil {
+		return nil, "", err
+	}
+	const (
+		accessDelete          = 0x00010000
+		fileFlagDeleteOnClose = 0x04000000
+	)
+	h, err := syscall.CreateFile(name, syscall.GENERIC_WRITE|accessDelete, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_HIDDEN|fileFlagDeleteOnClose, 0)
+	if err == errorSharingViolation {
+		return nil, "", errRunLocked
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return func() { syscall.CloseHandle(h) }, "", nil
+}
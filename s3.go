@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the smallest part of a multipart upload; files up to it
+// are uploaded in one request. S3 allows at most s3MaxParts parts, so parts
+// of huge files are larger.
+const (
+	s3PartSize = 16 << 20
+	s3MaxParts = 10000
+)
+
+// s3MetaMtime is the metadata the file's modification time is kept in,
+// since an object's own Last-Modified is when it was uploaded.
+const s3MetaMtime = "X-Amz-Meta-Mtime"
+
+// s3Store is a destination in an S3 bucket, or one of an S3-compatible
+// service such as MinIO or Backblaze B2, given as
+// s3://bucket/prefix?endpoint=https://minio.local:9000&region=eu-west-1.
+// Category folders become key prefixes. Requests are signed with AWS
+// Signature Version 4 using AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and,
+// for temporary credentials, AWS_SESSION_TOKEN. Without endpoint and
+// region, AWS_ENDPOINT_URL and AWS_REGION are used, then AWS itself in
+// us-east-1.
+type s3Store struct {
+	bucket, query        string
+	endpoint             *url.URL
+	pathStyle            bool // bucket in the path rather than the host name
+	region               string
+	accessKey, secretKey string
+	sessionToken         string
+}
+
+func newS3Store(u *url.URL) (remoteStore, error) {
+	s := &s3Store{bucket: u.Host, query: u.RawQuery}
+	q := u.Query()
+	s.region = firstNonEmpty(q.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	endpoint := firstNonEmpty(q.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	if endpoint == "" {
+		endpoint = "https://s3." + s.region + ".amazonaws.com"
+		s.pathStyle = strings.Contains(s.bucket, ".") // which the certificate doesn't cover
+	} else {
+		s.pathStyle = true
+	}
+	var err error
+	if s.endpoint, err = url.Parse(endpoint); err != nil || s.endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+	s.accessKey, s.secretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	s.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("s3 destinations need AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (s *s3Store) url(p string) string {
+	u := url.URL{Scheme: "s3", Host: s.bucket, Path: p, RawQuery: s.query}
+	return u.String()
+}
+
+// key returns the object key of the path p.
+func (s *s3Store) key(p string) string {
+	return strings.TrimPrefix(p, "/")
+}
+
+// s3Error is the error document S3 answers a failed request with.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do sends a signed request for the object key, or the bucket if key is
+// "", and returns the response if it succeeded. A missing object is
+// reported as fs.ErrNotExist.
+func (s *s3Store) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	escaped := "/" + awsEscape(key, false)
+	if s.pathStyle {
+		escaped = "/" + awsEscape(s.bucket, true) + escaped
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.RawPath = strings.TrimSuffix(s.endpoint.EscapedPath(), "/") + escaped
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now().UTC())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fs.ErrNotExist
+	}
+	var e s3Error
+	if data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return nil, fmt.Errorf("%s: %s", e.Code, e.Message)
+	}
+	return nil, errors.New(resp.Status)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, whose
+// body hashes to payloadHash. Every header set so far is signed.
+func (s *s3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	request := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonical.String(), signed, payloadHash}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request", toSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signed, hex.EncodeToString(key)))
+}
+
+// awsEscape percent-encodes s the way Signature Version 4 expects: every
+// byte but letters, digits and "-._~", and "/" too if slash is set.
+func awsEscape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 || c == '/' && !slash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery encodes the query sorted by name, as signed.
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, awsEscape(name, true)+"="+awsEscape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func (s *s3Store) stat(p string) (remoteInfo, error) {
+	resp, err := s.do(http.MethodHead, s.key(p), nil, nil, nil)
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	resp.Body.Close()
+	info := remoteInfo{size: resp.ContentLength}
+	if sec, err := strconv.ParseFloat(resp.Header.Get(s3MetaMtime), 64); err == nil {
+		info.modTime = time.Unix(0, int64(sec*1e9))
+	} else if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.modTime = t
+	}
+	return info, nil
+}
+
+// mkdirAll does nothing: prefixes need no creating.
+func (s *s3Store) mkdirAll(dir string) error {
+	return nil
+}
+
+// upload puts a file of up to s3PartSize in one request, and larger ones
+// as a multipart upload. Each request carries the SHA-256 of what it
+// sends, which S3 checks before storing it.
+func (s *s3Store) upload(local, p string) error {
+	f, err := os.Open(longPath(local))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	counted := &countingReader{r: throttle(f)}
+	t := startTransfer(filepath.Base(local), info.Size(), counted.n.Load)
+	defer t.finish()
+	header := http.Header{}
+	header.Set(s3MetaMtime, strconv.FormatFloat(float64(info.ModTime().UnixNano())/1e9, 'f', 3, 64))
+	if info.Size() <= s3PartSize {
+		data, err := io.ReadAll(counted)
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(http.MethodPut, s.key(p), nil, header, data)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	return s.uploadParts(counted, info.Size(), s.key(p), header)
+}
+
+// s3Part is a part of a multipart upload.
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+	Size       int64  `xml:"Size,omitempty"`
+}
+
+// uploadParts uploads the file of the given size to key in parts. If an
+// earlier attempt left an unfinished multipart upload for key, the parts it
+// already has with the same contents are kept and only the rest are sent.
+func (s *s3Store) uploadParts(f io.Reader, size int64, key string, header http.Header) error {
+	partSize := int64(s3PartSize)
+	if n := (size + s3MaxParts - 1) / s3MaxParts; n > partSize {
+		partSize = (n + 1<<20 - 1) &^ (1<<20 - 1)
+	}
+	uploadID, have, err := s.pendingUpload(key)
+	if err != nil {
+		return err
+	}
+	if uploadID == "" {
+		resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+		if err != nil {
+			return fmt.Errorf("failed to start the upload: %v", err)
+		}
+		var created struct {
+			UploadID string `xml:"UploadId"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&created)
+		resp.Body.Close()
+		if err != nil || created.UploadID == "" {
+			return fmt.Errorf("failed to start the upload: %v", err)
+		}
+		uploadID = created.UploadID
+	}
+
+	var done struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}
+	buf := make([]byte, partSize)
+	for n := 1; int64(n-1)*partSize < size; n++ {
+		data := buf[:min(partSize, size-int64(n-1)*partSize)]
+		if _, err := io.ReadFull(f, data); err != nil {
+			return err
+		}
+		sum := md5.Sum(data)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		if part, ok := have[n]; ok && part.ETag == etag && part.Size == int64(len(data)) {
+			done.Parts = append(done.Parts, s3Part{PartNumber: n, ETag: etag})
+			continue
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		resp, err := s.do(http.MethodPut, key, query, nil, data)
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d: %v", n, err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("ETag"); got != "" {
+			etag = got
+		}
+		done.Parts = append(done.Parts, s3Part{PartNumber: n, ETag: etag})
+	}
+	body, err := xml.Marshal(done)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return fmt.Errorf("failed to complete the upload: %v", err)
+	}
+	defer resp.Body.Close()
+	// Completing can fail after the response has begun; the error then
+	// comes in its body.
+	var e s3Error
+	if data, _ := io.ReadAll(resp.Body); xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return fmt.Errorf("failed to complete the upload: %s: %s", e.Code, e.Message)
+	}
+	return nil
+}
+
+// pendingUpload returns the ID of the latest unfinished multipart upload
+// to key, if any, and the parts it has.
+func (s *s3Store) pendingUpload(key string) (string, map[int]s3Part, error) {
+	resp, err := s.do(http.MethodGet, "", url.Values{"uploads": {""}, "prefix": {key}}, nil, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to look for an interrupted upload: %v", err)
+	}
+	var uploads struct {
+		Uploads []struct {
+			Key       string    `xml:"Key"`
+			UploadID  string    `xml:"UploadId"`
+			Initiated time.Time `xml:"Initiated"`
+		} `xml:"Upload"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&uploads)
+	resp.Body.Close()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to look for an interrupted upload: %v", err)
+	}
+	var id string
+	var latest time.Time
+	for _, u := range uploads.Uploads {
+		if u.Key == key && !u.Initiated.Before(latest) {
+			id, latest = u.UploadID, u.Initiated
+		}
+	}
+	if id == "" {
+		return "", nil, nil
+	}
+	have := map[int]s3Part{}
+	for marker := ""; ; {
+		query := url.Values{"uploadId": {id}}
+		if marker != "" {
+			query.Set("part-number-marker", marker)
+		}
+		resp, err := s.do(http.MethodGet, key, query, nil, nil)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil, nil // Finished or aborted meanwhile.
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to list the parts of an interrupted upload: %v", err)
+		}
+		var parts struct {
+			Parts       []s3Part `xml:"Part"`
+			IsTruncated bool     `xml:"IsTruncated"`
+			NextMarker  string   `xml:"NextPartNumberMarker"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&parts)
+		resp.Body.Close()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to list the parts of an interrupted upload: %v", err)
+		}
+		for _, part := range parts.Parts {
+			have[part.PartNumber] = part
+		}
+		if !parts.IsTruncated || parts.NextMarker == "" {
+			return id, have, nil
+		}
+		marker = parts.NextMarker
+	}
+}
+
+// download fetches p to local through a temporary file next to it, with
+// the modification time the object was uploaded with.
+func (s *s3Store) download(p, local string) (err error) {
+	resp, err := s.do(http.MethodGet, s.key(p), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	tmp := filepath.Join(filepath.Dir(local), "."+filepath.Base(local)+".organizer-tmp")
+	f, err := os.Create(longPath(tmp))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(longPath(tmp))
+		}
+	}()
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if sec, err := strconv.ParseFloat(resp.Header.Get(s3MetaMtime), 64); err == nil {
+		t := time.Unix(0, int64(sec*1e9))
+		os.Chtimes(longPath(tmp), t, t)
+	}
+	return os.Rename(longPath(tmp), longPath(local))
+}
+
+func (s *s3Store) remove(p string) error {
+	resp, err := s.do(http.MethodDelete, s.key(p), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
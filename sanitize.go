@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// sanitizeNames holds -sanitize-names: names are made safe for Windows,
+// exFAT and FAT drives and SMB shares as files are moved, so the same
+// layout works wherever the destination lives.
+var sanitizeNames bool
+
+// reservedNames are the device names Windows refuses as file names, with or
+// without an extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeName returns name with the characters Windows rejects
+// (<>:"/\|?* and control characters) replaced by underscores, trailing
+// dots and spaces dropped, and an underscore added to reserved device
+// names, so "CON.txt" becomes "CON_.txt".
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+	stem, ext, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = stem + "_"
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+// sanitizePath sanitizes each element of the relative path rel.
+func sanitizePath(rel string) string {
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		if part != "." && part != ".." {
+			parts[i] = sanitizeName(part)
+		}
+	}
+	return strings.Join(parts, string(filepath.Separator))
+}
+
+// portablePath converts the relative path rel the way -normalize-names
+// and -sanitize-names ask for.
+func portablePath(rel string) string {
+	rel = normalizeName(rel, normalizeNames)
+	if sanitizeNames {
+		rel = sanitizePath(rel)
+	}
+	return rel
+}
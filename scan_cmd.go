@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// inventoryVersion is bumped whenever the inventory format changes
+// incompatibly.
+const inventoryVersion = 1
+
+// Inventory is what "organizer scan -export" writes: every file found, how
+// it was categorized and where it would go, without anything being moved.
+type Inventory struct {
+	Version int              `json:"version"`
+	Created time.Time        `json:"created"`
+	Files   []InventoryEntry `json:"files"`
+	Skipped []Skip           `json:"skipped"`
+}
+
+// InventoryEntry describes one file or, with -folders, one folder.
+type InventoryEntry struct {
+	Dir         string    `json:"dir"`  // the scanned directory, absolute
+	Path        string    `json:"path"` // slash-separated, relative to Dir
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mtime"`
+	IsDir       bool      `json:"is_dir,omitempty"`
+	Extension   string    `json:"extension,omitempty"`
+	MIME        string    `json:"mime,omitempty"`
+	Category    string    `json:"category"`
+	Rule        string    `json:"rule,omitempty"`        // the rule that matched, if any
+	Action      Action    `json:"action"`                // what a run would do
+	Destination string    `json:"destination,omitempty"` // relative to Dir, for actions that place the file
+	SHA256      string    `json:"sha256,omitempty"`      // with -hash
+	Error       string    `json:"error,omitempty"`       // why the destination or hash is missing
+}
+
+// runScan implements "organizer scan": it scans like a run would and
+// prints or exports the inventory without moving anything.
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(envName("config")), "Path to a YAML config file")
+	profile := fs.String("profile", os.Getenv(envName("profile")), "Named profile from the config file to use")
+	preset := fs.String("preset", os.Getenv(envName("preset")), "Comma-separated built-in presets to use under the config")
+	var dirs, excludes, includes listFlag
+	fs.Var(&dirs, "dir", "Directory to scan; repeat or separate with commas for several (default: the current directory)")
+	fs.Var(&excludes, "exclude", "Gitignore-style pattern or path to leave out; repeat for several")
+	fs.Var(&includes, "include", "Only list files matching this glob; repeat for several")
+	export := fs.String("export", "", "Write the inventory as JSON to this file (\"-\" for stdout) instead of printing a summary")
+	hash := fs.Bool("hash", false, "Include the SHA-256 of every file")
+	recursive := fs.Bool("recursive", false, "Also scan subdirectories")
+	maxDepth := fs.Int("max-depth", 0, "With -recursive, how many levels of subdirectories to descend (0 = no limit)")
+	folders := fs.Bool("folders", false, "List the folders inside -dir as units, as -folders would move them")
+	symlinks := fs.String("symlinks", SymlinksSkip, "How to treat symbolic links: skip, follow or move")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer scan [-dir path] [-recursive] [-hash] [-export inventory.json]")
+		return 2
+	}
+
+	switch *symlinks {
+	case SymlinksSkip, SymlinksFollow, SymlinksMove:
+	default:
+		fmt.Printf("❌ invalid -symlinks %q (valid: skip, follow, move)\n", *symlinks)
+		return 2
+	}
+
+	cfg, err := loadGlobalConfig(*configPath)
+	if err == nil && *profile != "" {
+		cfg, err = cfg.selectProfile(*profile)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	opts := ScanOptions{
+		Recursive:  *recursive,
+		MaxDepth:   *maxDepth,
+		Folders:    *folders && !*recursive,
+		Symlinks:   *symlinks,
+		EmptyFiles: EmptyOrganize,
+		Exclude:    excludes,
+		Include:    includes,
+		Workers:    defaultScanWorkers,
+		Cache:      true,
+	}
+
+	inv := Inventory{Version: inventoryVersion, Created: time.Now().UTC(), Files: []InventoryEntry{}}
+	report := &SkipReport{}
+	for _, dir := range dirList(dirs) {
+		if err := prepareConfig(cfg, *preset, dir); err != nil {
+			fmt.Printf("❌ %s: %v\n", dir, err)
+			return 1
+		}
+		files, err := scanDir(dir, opts, report)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", dir, err)
+			return 1
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			abs = dir
+		}
+		for f := range files {
+			inv.Files = append(inv.Files, inventoryEntry(abs, f, *hash))
+		}
+	}
+	sort.Slice(inv.Files, func(i, j int) bool {
+		a, b := inv.Files[i], inv.Files[j]
+		if a.Dir != b.Dir {
+			return a.Dir < b.Dir
+		}
+		return a.Path < b.Path
+	})
+	report.sort()
+	inv.Skipped = report.Skips
+	if inv.Skipped == nil {
+		inv.Skipped = []Skip{}
+	}
+
+	if *export == "" {
+		printInventory(inv)
+		return 0
+	}
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	data = append(data, '\n')
+	if *export == "-" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*export, data, 0644); err != nil {
+		fmt.Printf("❌ failed to write inventory: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Wrote %d file(s) to %s\n", len(inv.Files), *export)
+	return 0
+}
+
+// inventoryEntry describes the file found in dir, working out its
+// destination the same way a run would.
+func inventoryEntry(dir string, f File, hash bool) InventoryEntry {
+	rel, err := filepath.Rel(f.baseDir(), f.Path)
+	if err != nil {
+		rel = f.Name
+	}
+	if !f.IsDir {
+		f.DetectMIME()
+	}
+	e := InventoryEntry{
+		Dir:       dir,
+		Path:      filepath.ToSlash(rel),
+		Name:      f.Name,
+		Size:      f.Size,
+		ModTime:   f.ModTime,
+		IsDir:     f.IsDir,
+		Extension: f.Extension,
+		MIME:      f.MIME,
+	}
+	dest, err := destinationFor(&f)
+	e.Category, e.Action = f.Category, fileAction(f)
+	if f.Rule != nil {
+		e.Rule = f.Rule.label()
+	}
+	switch {
+	case err != nil:
+		e.Error = err.Error()
+	case e.Action == ActionMove || e.Action == ActionCopy || e.Action == ActionCompress:
+		name, err := movedName(f)
+		if err != nil {
+			e.Error = err.Error()
+			break
+		}
+		if e.Action == ActionCompress {
+			name += compressedExt(compression(f))
+		}
+		e.Destination = filepath.ToSlash(filepath.Join(dest, name))
+	case e.Action == ActionArchive:
+		e.Destination = filepath.ToSlash(filepath.Join(dest, archiveName(f)))
+	}
+	if hash && !f.IsDir {
+		if sum, err := hashFile(f.Path); err != nil {
+			e.Error = fmt.Sprintf("failed to hash: %v", err)
+		} else {
+			e.SHA256 = sum
+		}
+	}
+	return e
+}
+
+// hashFile returns the hex SHA-256 of the file's contents.
+func hashFile(path string) (string, error) {
+	fh, err := os.Open(longPath(path))
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, throttle(fh)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// printInventory summarizes the inventory by category.
+func printInventory(inv Inventory) {
+	type total struct {
+		files int
+		bytes int64
+	}
+	totals := map[string]*total{}
+	var categories []string
+	for _, e := range inv.Files {
+		t := totals[e.Category]
+		if t == nil {
+			t = &total{}
+			totals[e.Category] = t
+			categories = append(categories, e.Category)
+		}
+		t.files++
+		t.bytes += e.Size
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		t := totals[category]
+		fmt.Printf("📂 %-14s %6d file(s) %10s\n", category, t.files, ByteSize(t.bytes))
+	}
+	fmt.Printf("%d file(s) found, %d skipped; use -export to save the full inventory\n", len(inv.Files), len(inv.Skipped))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// scanCacheVersion is bumped whenever content detection changes, so stale
+// results from older versions are discarded.
+const scanCacheVersion = 2
+
+// scanCache remembers what was learned from each file's content during
+// earlier scans of a directory, so files whose size and modification time
+// are unchanged are not read again. It lives in the user's cache directory,
+// one file per organized directory, and a nil cache does nothing.
+type scanCache struct {
+	path    string
+	dir     string                // absolute organized directory
+	old     map[string]cacheEntry // entries loaded from disk
+	entries map[string]cacheEntry // entries seen in this scan
+	changed bool
+
+	mu sync.Mutex // scans fill and store from several goroutines
+}
+
+// cacheEntry is what the cache knows about one file, by relative path.
+type cacheEntry struct {
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	MIME       string    `json:"mime,omitempty"`
+	ContentExt string    `json:"content_ext,omitempty"`
+	Program    string    `json:"program,omitempty"`
+	Sniffed    bool      `json:"sniffed,omitempty"` // ContentExt is known, even if ""
+}
+
+// scanCacheFile is the on-disk format.
+type scanCacheFile struct {
+	Version int                   `json:"version"`
+	Dir     string                `json:"dir"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// scanCachePath returns where the cache for dir is kept, or "" if there is
+// no user cache directory.
+func scanCachePath(dir string) string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(base, configDirName, "scan", hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadScanCache loads the cache for dir. A missing, unreadable or outdated
+// cache file starts an empty cache; nil is returned only when there is
+// nowhere to keep one.
+func loadScanCache(dir string) *scanCache {
+	path := scanCachePath(dir)
+	if path == "" {
+		return nil
+	}
+	abs, _ := filepath.Abs(dir)
+	c := &scanCache{path: path, dir: abs, old: map[string]cacheEntry{}, entries: map[string]cacheEntry{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+	var f scanCacheFile
+	if json.Unmarshal(data, &f) == nil && f.Version == scanCacheVersion && f.Entries != nil {
+		c.old = f.Entries
+	}
+	return c
+}
+
+// fill copies cached content details into the file if it is unchanged.
+func (c *scanCache) fill(rel string, f *File) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.old[rel]
+	if !ok || e.Size != f.Size || !e.ModTime.Equal(f.ModTime) {
+		return
+	}
+	f.MIME = e.MIME
+	f.contentExt, f.contentProgram, f.contentSniffed = e.ContentExt, e.Program, e.Sniffed
+}
+
+// store records the file's content details for the next scan.
+func (c *scanCache) store(rel string, f File) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := cacheEntry{Size: f.Size, ModTime: f.ModTime, MIME: f.MIME, ContentExt: f.contentExt, Program: f.contentProgram, Sniffed: f.contentSniffed}
+	if old, ok := c.old[rel]; !ok || old != e {
+		c.changed = true
+	}
+	c.entries[rel] = e
+}
+
+// save writes the cache back, dropping files that are gone. It does
+// nothing if no entry changed.
+func (c *scanCache) save() error {
+	if c == nil || (!c.changed && len(c.entries) == len(c.old)) {
+		return nil
+	}
+	data, err := json.Marshal(scanCacheFile{Version: scanCacheVersion, Dir: c.dir, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	// Write a temporary file and rename it so readers never see half a cache.
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
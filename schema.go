@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// configSchema returns a JSON Schema (draft 2020-12) describing the config
+// file format, derived from the Config struct so it cannot drift from what
+// the loader accepts.
+func configSchema() map[string]any {
+	defs := map[string]any{}
+	schema := schemaForStruct(reflect.TypeOf(Config{}), defs)
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = "https://github.com/bettjesse/go-file-organizer/config.schema.json"
+	schema["title"] = "go-file-organizer config"
+	schema["$defs"] = defs
+	return schema
+}
+
+// configSchemaJSON renders configSchema as indented JSON.
+func configSchemaJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(configSchema(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+var (
+	configType     = reflect.TypeOf(Config{})
+	categoryType   = reflect.TypeOf(CategoryMap{})
+	byteSizeType   = reflect.TypeOf(ByteSize(0))
+	ageType        = reflect.TypeOf(Age(0))
+	resolutionType = reflect.TypeOf(Resolution(0))
+)
+
+// schemaForStruct describes a struct decoded by decodeYAML: its yaml-tagged
+// fields and no others.
+func schemaForStruct(t reflect.Type, defs map[string]any) map[string]any {
+	props := map[string]any{}
+	for name, idx := range yamlFields(t) {
+		props[name] = schemaForType(t.Field(idx).Type, defs)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// schemaForType describes values of type t.
+func schemaForType(t reflect.Type, defs map[string]any) map[string]any {
+	switch t {
+	case configType:
+		return map[string]any{"$ref": "#"}
+	case byteSizeType:
+		return map[string]any{
+			"description": `Size in bytes, or with a unit such as "10MB" or "1.5GiB" (powers of 1024)`,
+			"type":        []string{"string", "integer"},
+			"pattern":     `^\s*[0-9]+(\.[0-9]+)?\s*([KkMmGgTt]([Ii]?[Bb])?|[Bb])?\s*$`,
+		}
+	case ageType:
+		return map[string]any{
+			"description": `Duration such as "12h", "30d", "2w" or "2y" (365 days)`,
+			"type":        "string",
+			"pattern":     `^\s*[0-9.]+(d|w|y)\s*$|^([0-9.]+(ns|us|µs|ms|s|m|h))+$`,
+		}
+	case resolutionType:
+		// JSON Schema patterns have no (?i), so both cases are spelled out.
+		return map[string]any{
+			"description": `Video resolution as the shorter side in pixels, such as "1080p" or 1080, or "4K", "8K", "UHD", "Full HD" or "HD"`,
+			"type":        []string{"string", "integer"},
+			"pattern":     `^\s*([0-9]+[Pp]?|[48][Kk]|[Uu][Hh][Dd]|[Ff][Hh][Dd]|[Ff][Uu][Ll][Ll] ?[Hh][Dd]|[Hh][Dd])\s*$`,
+		}
+	case categoryType:
+		defs["category"] = map[string]any{
+			"oneOf": []any{
+				map[string]any{"$ref": "#/$defs/extensions"},
+				map[string]any{
+					"type":                 "object",
+					"properties":           map[string]any{"extensions": map[string]any{"$ref": "#/$defs/extensions"}},
+					"additionalProperties": map[string]any{"$ref": "#/$defs/category"},
+				},
+			},
+		}
+		defs["extensions"] = map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		}
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": map[string]any{"$ref": "#/$defs/category"},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaForType(t.Elem(), defs)
+	case reflect.Struct:
+		name := strings.ToLower(t.Name())
+		if _, ok := defs[name]; !ok {
+			defs[name] = map[string]any{} // placeholder for recursive types
+			defs[name] = schemaForStruct(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	case reflect.Slice:
+		// decodeYAML also accepts a single scalar in place of a list.
+		items := schemaForType(t.Elem(), defs)
+		if t.Elem().Kind() == reflect.String {
+			return map[string]any{"oneOf": []any{
+				map[string]any{"type": "array", "items": items},
+				items,
+			}}
+		}
+		return map[string]any{"type": "array", "items": items}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.String {
+			// Option values such as "dry-run: true" are read as text.
+			return map[string]any{
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": []string{"string", "number", "boolean"}},
+			}
+		}
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": schemaForType(t.Elem(), defs),
+		}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
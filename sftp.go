@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sftpStore is a destination reached over SFTP, with the system's OpenSSH
+// sftp client so keys, agents, known hosts and ~/.ssh/config work as they
+// do for ssh. Its connections are pooled by an OpenSSH control master per
+// host, kept open for a minute after the last command, so each operation
+// doesn't pay for a new handshake. Paths below /~/ are relative to the
+// login directory, as in sftp://nas/~/organized.
+type sftpStore struct {
+	user, host, port string
+}
+
+func newSFTPStore(u *url.URL) (remoteStore, error) {
+	if _, err := exec.LookPath("sftp"); err != nil {
+		return nil, errors.New("sftp destinations need the OpenSSH sftp client")
+	}
+	return &sftpStore{user: u.User.Username(), host: u.Hostname(), port: u.Port()}, nil
+}
+
+func (s *sftpStore) url(p string) string {
+	u := url.URL{Scheme: "sftp", Host: s.host, Path: p}
+	if s.port != "" {
+		u.Host += ":" + s.port
+	}
+	if s.user != "" {
+		u.User = url.User(s.user)
+	}
+	return u.String()
+}
+
+// batch runs the commands in one sftp session and returns what it printed.
+// A command prefixed with "-" may fail without failing the rest.
+func (s *sftpStore) batch(commands ...string) (string, error) {
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if runtime.GOOS != "windows" {
+		// Windows' OpenSSH has no connection sharing.
+		args = append(args,
+			"-o", "ControlMaster=auto",
+			"-o", "ControlPath="+filepath.Join(os.TempDir(), "go-file-organizer-%C"),
+			"-o", "ControlPersist=60")
+	}
+	if s.port != "" {
+		args = append(args, "-P", s.port)
+	}
+	if kbits := int64(bandwidth.limit() * 8 / 1000); kbits > 0 {
+		// sftp paces its own transfers, in Kbit/s.
+		args = append(args, "-l", strconv.FormatInt(kbits, 10))
+	}
+	target := s.host
+	if s.user != "" {
+		target = s.user + "@" + target
+	}
+	cmd := exec.Command("sftp", append(args, target)...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	out, err := cmd.CombinedOutput()
+	output := string(out)
+	if err != nil {
+		if strings.Contains(output, "not found") || strings.Contains(output, "No such file") {
+			return output, fs.ErrNotExist
+		}
+		if msg := sftpError(output); msg != "" {
+			return output, errors.New(msg)
+		}
+		return output, err
+	}
+	return output, nil
+}
+
+// sftpError returns the last line sftp printed that isn't an echoed
+// command, which says what went wrong.
+func sftpError(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" && !strings.HasPrefix(line, "sftp>") {
+			return line
+		}
+	}
+	return ""
+}
+
+// remotePath returns p as sftp is to be given it.
+func (s *sftpStore) remotePath(p string) string {
+	if p == "/~" {
+		return "."
+	}
+	if rest, ok := strings.CutPrefix(p, "/~/"); ok {
+		return rest
+	}
+	return p
+}
+
+// quoteSFTP quotes the path as an argument of an sftp command, with the
+// glob characters escaped so they are taken as they are.
+func quoteSFTP(p string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range p {
+		switch r {
+		case '"', '\\', '*', '?', '[':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// stat lists p with "ls -ln" and reads its size and modification time, which
+// sftp shows to the minute for recent files and to the day for older ones.
+// A directory lists its contents instead, so when no line is p itself, p
+// is checked to be a directory by changing into it.
+func (s *sftpStore) stat(p string) (remoteInfo, error) {
+	rp := s.remotePath(p)
+	out, err := s.batch("ls -ln " + quoteSFTP(rp))
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 9 || !strings.HasSuffix(line, " "+rp) {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			continue
+		}
+		info := remoteInfo{size: size, dir: strings.HasPrefix(fields[0], "d"), precision: time.Minute}
+		stamp := strings.Join(fields[5:8], " ")
+		if t, err := time.ParseInLocation("Jan 2 15:04", stamp, time.Local); err == nil {
+			// Recent files are shown without a year.
+			now := time.Now()
+			info.modTime = t.AddDate(now.Year(), 0, 0)
+			if info.modTime.After(now.Add(24 * time.Hour)) {
+				info.modTime = info.modTime.AddDate(-1, 0, 0)
+			}
+		} else if t, err := time.ParseInLocation("Jan 2 2006", stamp, time.Local); err == nil {
+			info.modTime, info.precision = t, 24*time.Hour
+		}
+		return info, nil
+	}
+	if _, err := s.batch("cd " + quoteSFTP(rp)); err != nil {
+		return remoteInfo{}, fmt.Errorf("failed to make out %s from its listing: %v", s.url(p), err)
+	}
+	return remoteInfo{dir: true}, nil
+}
+
+func (s *sftpStore) mkdirAll(dir string) error {
+	rp := s.remotePath(dir)
+	var commands []string
+	for i := range rp {
+		if rp[i] == '/' && i > 0 {
+			commands = append(commands, "-mkdir "+quoteSFTP(rp[:i]))
+		}
+	}
+	commands = append(commands, "-mkdir "+quoteSFTP(rp))
+	if _, err := s.batch(commands...); err != nil {
+		return err
+	}
+	if info, err := s.stat(dir); err != nil {
+		return err
+	} else if !info.dir {
+		return fmt.Errorf("%s is not a directory", s.url(dir))
+	}
+	return nil
+}
+
+// upload sends the file to a hidden partial file next to p and renames it
+// into place once complete. A partial file left by an interrupted upload
+// is resumed where it stopped with reput.
+func (s *sftpStore) upload(local, p string) error {
+	part := path.Join(path.Dir(p), "."+path.Base(p)+".part")
+	put := "put"
+	if info, err := s.stat(part); err == nil && !info.dir {
+		put = "reput"
+	}
+	_, err := s.batch(
+		put+" -p "+quoteSFTP(local)+" "+quoteSFTP(s.remotePath(part)),
+		"rename "+quoteSFTP(s.remotePath(part))+" "+quoteSFTP(s.remotePath(p)))
+	return err
+}
+
+// download fetches p to local through a temporary file next to it.
+func (s *sftpStore) download(p, local string) error {
+	tmp := filepath.Join(filepath.Dir(local), "."+filepath.Base(local)+".organizer-tmp")
+	if _, err := s.batch("get -p " + quoteSFTP(s.remotePath(p)) + " " + quoteSFTP(tmp)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, local)
+}
+
+func (s *sftpStore) remove(p string) error {
+	_, err := s.batch("rm " + quoteSFTP(s.remotePath(p)))
+	return err
+}
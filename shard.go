@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Schemes for sharding a category folder, set per category in the config's
+// shard section.
+const (
+	ShardLetter = "letter" // A/, B/, ..., and # for names starting otherwise
+	ShardYear   = "year"   // 2024/, by modification time
+	ShardMonth  = "month"  // 2024-05/, by modification time
+)
+
+// defaultShardLimit is how many entries a folder may hold before it is
+// sharded, unless -shard-limit says otherwise.
+const defaultShardLimit = 1000
+
+// ShardCategories holds the config's shard section: per category, the
+// scheme its folders are split into subfolders by once they grow too big.
+var ShardCategories map[string]string
+
+// shardLimit holds -shard-limit.
+var shardLimit = defaultShardLimit
+
+// categoryShard returns the scheme the category's folders are sharded by,
+// or "" if they aren't.
+func categoryShard(category string) string {
+	if scheme := ShardCategories[category]; scheme != "" {
+		return scheme
+	}
+	return ShardCategories[canonicalCategory(category)]
+}
+
+// checkShard validates a scheme from the config.
+func checkShard(scheme string) error {
+	switch scheme {
+	case ShardLetter, ShardYear, ShardMonth:
+		return nil
+	}
+	return fmt.Errorf("unknown shard scheme %q (valid: %s, %s, %s)", scheme, ShardLetter, ShardYear, ShardMonth)
+}
+
+// shardName returns the subfolder the scheme puts an entry called name,
+// modified at modTime, in.
+func shardName(scheme, name string, modTime time.Time) string {
+	switch scheme {
+	case ShardYear:
+		return modTime.Format("2006")
+	case ShardMonth:
+		return modTime.Format("2006-01")
+	}
+	if r, _ := utf8.DecodeRuneInString(name); unicode.IsLetter(r) {
+		return string(unicode.ToUpper(r))
+	}
+	return "#"
+}
+
+// isShard reports whether the folder called name is one the scheme makes.
+func isShard(scheme, name string) bool {
+	digits := func(s string) bool {
+		return s != "" && strings.Trim(s, "0123456789") == ""
+	}
+	switch scheme {
+	case ShardYear:
+		return len(name) == 4 && digits(name)
+	case ShardMonth:
+		return len(name) == 7 && name[4] == '-' && digits(name[:4]) && digits(name[5:])
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	return name == "#" || size == len(name) && unicode.IsUpper(r)
+}
+
+// shardFolder is what a run knows about a destination folder of a sharded
+// category.
+type shardFolder struct {
+	entries int  // not in a shard
+	sharded bool // holds shards, so new entries go into them
+}
+
+var (
+	shardMu      sync.Mutex
+	shardFolders = map[string]*shardFolder{} // by path; guarded by shardMu
+)
+
+// shardDir returns the folder, relative to the organized directory, that
+// the file called name goes to instead of rel, the folder its category
+// sends it to. Once rel holds more than -shard-limit entries, it is split
+// into subfolders by its category's scheme: what it holds is moved into
+// them, and so is every file after. A folder holding shards is taken to
+// be sharded from then on.
+func shardDir(file File, rel, name string, dryRun bool) string {
+	scheme := categoryShard(file.Category)
+	if scheme == "" {
+		return rel
+	}
+	dir := filepath.Join(file.baseDir(), rel)
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	folder := shardFolders[dir]
+	if folder == nil {
+		folder = readShardFolder(dir, scheme)
+		shardFolders[dir] = folder
+		if folder.sharded && folder.entries > 0 {
+			// Moved in since it was sharded.
+			shardEntries(dir, scheme, folder.entries, dryRun)
+		}
+	}
+	if !folder.sharded {
+		if folder.entries < shardLimit {
+			folder.entries++
+			return rel
+		}
+		shardEntries(dir, scheme, folder.entries, dryRun)
+		folder.sharded = true
+	}
+	return filepath.Join(rel, shardName(scheme, name, file.ModTime))
+}
+
+// readShardFolder counts the entries of dir not in a shard, and whether it
+// holds any shard.
+func readShardFolder(dir, scheme string) *shardFolder {
+	folder := &shardFolder{}
+	entries, _ := os.ReadDir(longPath(dir))
+	for _, e := range entries {
+		switch {
+		case strings.HasPrefix(e.Name(), "."):
+		case e.IsDir() && isShard(scheme, e.Name()):
+			folder.sharded = true
+		default:
+			folder.entries++
+		}
+	}
+	return folder
+}
+
+// shardEntries moves what dir holds outside its shards, count entries
+// as far as the run knows, into them by the scheme. Hidden files, such as
+// the organizer's marker, stay. The moves are journaled, so undo puts the
+// entries back.
+func shardEntries(dir, scheme string, count int, dryRun bool) {
+	if dryRun {
+		fmt.Printf("Would shard %s by %s, moving %d entries into subfolders\n", dir, scheme, count)
+		return
+	}
+	entries, err := os.ReadDir(longPath(dir))
+	if err != nil {
+		fmt.Printf("⚠️ Failed to shard %s: %v\n", dir, err)
+		return
+	}
+	moved := 0
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") || e.IsDir() && isShard(scheme, name) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		src := filepath.Join(dir, name)
+		shard := filepath.Join(dir, shardName(scheme, name, info.ModTime()))
+		dst := filepath.Join(shard, name)
+		if _, err := os.Lstat(longPath(dst)); err == nil {
+			fmt.Printf("⚠️ Left %s where it is: %s is taken\n", src, dst)
+			continue
+		}
+		if err := runJournal.mkdirAll(shard); err != nil {
+			fmt.Printf("⚠️ Failed to shard %s: %v\n", dir, err)
+			return
+		}
+		symlink := info.Mode()&os.ModeSymlink != 0
+		if symlink {
+			err = moveSymlink(src, dst, false)
+		} else {
+			err = retryStale(func() error { return os.Rename(longPath(src), longPath(dst)) })
+		}
+		if err != nil {
+			fmt.Printf("⚠️ Failed to move %s into %s: %v\n", src, shard, err)
+			continue
+		}
+		runJournal.add(journalOp{Action: ActionMove, Source: src, Dest: dst, Symlink: symlink})
+		moved++
+	}
+	fmt.Printf("🗂️ Sharded %s by %s, moving %d entries into subfolders\n", dir, scheme, moved)
+}
+
+// inShard reports whether the file, found in the folder got, is in the
+// shard of want, the folder its category sends it to, that its scheme
+// gives it.
+func inShard(file File, want, got string) bool {
+	scheme := categoryShard(file.Category)
+	return scheme != "" && filepath.Dir(got) == want && filepath.Base(got) == shardName(scheme, file.Name, file.ModTime)
+}
+
+// resetShards forgets what the run learned about folders, for the next.
+func resetShards() {
+	shardMu.Lock()
+	defer shardMu.Unlock()
+	shardFolders = map[string]*shardFolder{}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Reasons an entry is skipped, as they appear in the JSON skip report.
+const (
+	SkipUnreadable = "unreadable"  // stat or read failed, e.g. permission denied
+	SkipInProgress = "in-progress" // still downloading or recently modified
+	SkipInUse      = "in-use"      // open in another process; retried next run
+	SkipSpecial    = "special"     // a FIFO, socket or device node
+	SkipVetoed     = "vetoed"      // a validator kept it from being moved
+)
+
+// skipIcons prefix each reason in the printed report.
+var skipIcons = map[string]string{
+	SkipUnreadable: "⚠️",
+	SkipInProgress: "⏳",
+	SkipInUse:      "⏸️",
+	SkipSpecial:    "🚫",
+	SkipVetoed:     "🛡️",
+}
+
+// Skip is one entry a run left alone.
+type Skip struct {
+	Dir    string `json:"dir"`    // the organized directory
+	Path   string `json:"path"`   // slash-separated, relative to Dir
+	Reason string `json:"reason"` // one of the Skip* constants
+	Detail string `json:"detail"` // the error or explanation
+}
+
+// SkipReport collects the entries skipped during a run so they can be
+// reported together at the end instead of scrolling past between moves.
+// It is safe for concurrent use; a nil report discards everything.
+type SkipReport struct {
+	mu    sync.Mutex
+	Skips []Skip `json:"skipped"`
+}
+
+// skipReportPath is where -skip-report writes the report as JSON, "" for
+// nowhere.
+var skipReportPath string
+
+// add records that path, relative to dir, was skipped.
+func (r *SkipReport) add(dir, path, reason string, detail any) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Skips = append(r.Skips, Skip{Dir: dir, Path: path, Reason: reason, Detail: fmt.Sprint(detail)})
+}
+
+// addFile records that the file was skipped.
+func (r *SkipReport) addFile(f File, reason string, detail any) {
+	rel, err := filepath.Rel(f.root, f.Path)
+	if err != nil {
+		rel = f.Name
+	}
+	r.add(f.root, filepath.ToSlash(rel), reason, detail)
+}
+
+// sort orders the skips by reason, directory and path so reports don't
+// depend on the order a parallel scan found them in.
+func (r *SkipReport) sort() {
+	sort.Slice(r.Skips, func(i, j int) bool {
+		a, b := r.Skips[i], r.Skips[j]
+		if a.Reason != b.Reason {
+			return a.Reason > b.Reason
+		}
+		if a.Dir != b.Dir {
+			return a.Dir < b.Dir
+		}
+		return a.Path < b.Path
+	})
+}
+
+// print writes the report to stdout.
+func (r *SkipReport) print(multiDir bool) {
+	if len(r.Skips) == 0 {
+		return
+	}
+	fmt.Printf("⚠️ Skipped %d entry(s):\n", len(r.Skips))
+	for _, s := range r.Skips {
+		path := s.Path
+		if multiDir {
+			path = filepath.Join(s.Dir, filepath.FromSlash(s.Path))
+		}
+		fmt.Printf("  %s %s: %s\n", skipIcons[s.Reason], path, s.Detail)
+	}
+}
+
+// write saves the report as JSON to path.
+func (r *SkipReport) write(path string) error {
+	if r.Skips == nil {
+		r.Skips = []Skip{}
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// finish sorts the report, prints it and writes it out for -skip-report.
+func (r *SkipReport) finish(multiDir bool) {
+	r.sort()
+	r.print(multiDir)
+	if skipReportPath == "" {
+		return
+	}
+	if err := r.write(skipReportPath); err != nil {
+		fmt.Printf("❌ Failed to write the skip report: %v\n", err)
+	}
+}
+
+// specialKind describes the mode of a FIFO, socket, device node or other
+// non-regular file that is never organized, or returns "" for regular
+// files, directories and symbolic links.
+func specialKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "named pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	case mode&os.ModeIrregular != 0:
+		return "irregular file"
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen is how much of a file is read for content detection.
+const sniffLen = 4096
+
+// readHead returns up to sniffLen bytes from the start of the file at path.
+func readHead(path string) ([]byte, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// sniffMIME detects the file's MIME type from its content, without
+// parameters such as charset. Unreadable files report "".
+func sniffMIME(path string) string {
+	head, err := readHead(path)
+	if err != nil {
+		return ""
+	}
+	mime := http.DetectContentType(head)
+	if i := strings.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	return strings.TrimSpace(mime)
+}
+
+// mimeMatches reports whether mime matches pattern, which is either an
+// exact type such as "application/pdf" or a wildcard such as "image/*".
+func mimeMatches(pattern, mime string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mime, prefix+"/")
+	}
+	return pattern == "*" || pattern == mime
+}
+
+// DetectMIME fills in f.MIME from the file's content if it is not known yet.
+func (f *File) DetectMIME() string {
+	if f.MIME == "" && !f.IsDir {
+		f.MIME = sniffMIME(f.Path)
+	}
+	return f.MIME
+}
+
+// ContentExt returns the extension the file's content suggests, or "" if
+// it is not recognized. The content is read at most once.
+func (f *File) ContentExt() string {
+	f.sniffContent()
+	return f.contentExt
+}
+
+// ProgramCategory returns categoryExecutables or categoryScripts if the
+// file's content is a program, or "". The content is read at most once.
+func (f *File) ProgramCategory() string {
+	f.sniffContent()
+	return f.contentProgram
+}
+
+// sniffContent fills in contentExt and contentProgram on first use.
+func (f *File) sniffContent() {
+	if !f.contentSniffed && !f.IsDir {
+		if head, err := readHead(f.Path); err == nil {
+			f.contentExt = sniffExt(head)
+			f.contentProgram = sniffProgram(head)
+			f.contentSniffed = true
+		}
+	}
+}
+
+// magicSignatures are content signatures not covered by http.DetectContentType,
+// mapped to the extension such files would normally carry.
+var magicSignatures = []struct {
+	offset int
+	magic  string
+	ext    string
+}{
+	{0, "7z\xbc\xaf\x27\x1c", ".7z"},
+	{0, "BZh", ".bz2"},
+	{0, "\xfd7zXZ\x00", ".xz"},
+	{0, "\x28\xb5\x2f\xfd", ".zst"},
+	{257, "ustar", ".tar"},
+	{4, "ftypheic", ".heic"},
+	{4, "ftypqt", ".mov"},
+	{0, "fLaC", ".flac"},
+	{0, "ID3", ".mp3"},
+	{0, "\x1a\x45\xdf\xa3", ".mkv"},
+}
+
+// mimeExtensions maps types reported by http.DetectContentType to a
+// representative extension.
+var mimeExtensions = map[string]string{
+	"image/jpeg":                   ".jpg",
+	"image/png":                    ".png",
+	"image/gif":                    ".gif",
+	"image/webp":                   ".webp",
+	"image/bmp":                    ".bmp",
+	"image/x-icon":                 ".ico",
+	"application/pdf":              ".pdf",
+	"application/zip":              ".zip",
+	"application/x-gzip":           ".gz",
+	"application/x-rar-compressed": ".rar",
+	"audio/mpeg":                   ".mp3",
+	"audio/wave":                   ".wav",
+	"audio/aiff":                   ".aiff",
+	"application/ogg":              ".ogg",
+	"video/mp4":                    ".mp4",
+	"video/webm":                   ".webm",
+	"video/avi":                    ".avi",
+	"text/plain":                   ".txt",
+	"text/html":                    ".html",
+	"text/xml":                     ".xml",
+}
+
+// sniffExt guesses the extension a file should have from the first bytes
+// of its content, returning "" if the content is not recognized.
+func sniffExt(head []byte) string {
+	for _, sig := range magicSignatures {
+		end := sig.offset + len(sig.magic)
+		if len(head) >= end && string(head[sig.offset:end]) == sig.magic {
+			return sig.ext
+		}
+	}
+	mime := http.DetectContentType(head)
+	if i := strings.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	return mimeExtensions[mime]
+}
+
+// Categories for extensionless programs, see sniffProgram.
+const (
+	categoryExecutables = "Executables"
+	categoryScripts     = "Scripts"
+)
+
+// programSignatures are the headers of native executables: ELF, Mach-O
+// (both byte orders, 32 and 64 bit) and PE.
+var programSignatures = []string{
+	"\x7fELF",
+	"\xfe\xed\xfa\xce", "\xce\xfa\xed\xfe",
+	"\xfe\xed\xfa\xcf", "\xcf\xfa\xed\xfe",
+	"MZ",
+}
+
+// sniffProgram returns categoryExecutables for native executables,
+// categoryScripts for files starting with a shebang, and "" otherwise.
+func sniffProgram(head []byte) string {
+	if strings.HasPrefix(string(head), "#!") {
+		return categoryScripts
+	}
+	for _, magic := range programSignatures {
+		if strings.HasPrefix(string(head), magic) {
+			return categoryExecutables
+		}
+	}
+	// Universal Mach-O binaries share 0xcafebabe with Java class files;
+	// a small architecture count tells them apart.
+	if len(head) >= 8 && string(head[:4]) == "\xca\xfe\xba\xbe" && head[4] == 0 && head[5] == 0 && head[6] == 0 && head[7] > 0 && head[7] < 20 {
+		return categoryExecutables
+	}
+	return ""
+}
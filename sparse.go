@@ -0,0 +1,56 @@
+//go:build darwin || dragonfly || freebsd || illumos || linux || solaris
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// lseek whence values for finding the data regions of a sparse file.
+var seekData, seekHole = 3, 4
+
+func init() {
+	if runtime.GOOS == "darwin" {
+		seekData, seekHole = 4, 3
+	}
+}
+
+// copyContents copies the size bytes of in to out, writing only the data
+// regions of a sparse file so its holes stay unallocated on the
+// destination. File systems that don't report holes get a plain copy.
+func copyContents(out, in *os.File, size int64) error {
+	hole, err := in.Seek(0, seekHole)
+	if err != nil || hole >= size {
+		// No holes, or no way to find them.
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err = io.Copy(out, throttle(in))
+		return err
+	}
+	for off := int64(0); off < size; {
+		data, err := in.Seek(off, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break // Only a hole is left.
+		}
+		if err != nil {
+			return err
+		}
+		if hole, err = in.Seek(data, seekHole); err != nil {
+			return err
+		}
+		if _, err := out.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, throttle(io.NewSectionReader(in, data, hole-data))); err != nil {
+			return err
+		}
+		off = hole
+	}
+	// Extend the copy over a trailing hole.
+	return out.Truncate(size)
+}
@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || illumos || linux || solaris)
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// copyContents copies in to out. Holes in sparse files can't be found on
+// this platform, so they are written out as zeros.
+func copyContents(out, in *os.File, size int64) error {
+	_, err := io.Copy(out, throttle(in))
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// staging is set by "organizer stage": the plan is kept as the staged
+// plan, for status and commit, rather than written where -o says.
+var staging bool
+
+// stagedPlanPath returns where the staged plan is kept:
+// $XDG_STATE_HOME/go-file-organizer/staged.json, next to the journals, or
+// "" if there is no home directory.
+func stagedPlanPath() string {
+	dir := journalDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(dir), "staged.json")
+}
+
+// readStagedPlan reads the staged plan, or returns nil if nothing is
+// staged.
+func readStagedPlan() (*runPlan, error) {
+	path := stagedPlanPath()
+	if path == "" {
+		return nil, errors.New("no home directory to keep a staged plan in")
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return readPlan(path)
+}
+
+// runStatus implements "organizer status": it lists the staged steps and
+// flags the files that changed since they were staged.
+func runStatus(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer status")
+		return 2
+	}
+	rp, err := readStagedPlan()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	if rp == nil {
+		fmt.Println("Nothing staged")
+		return 0
+	}
+	fmt.Printf("Staged %s: %d step(s) in %s\n", rp.Created.Local().Format(time.DateTime), len(rp.Steps), strings.Join(rp.Dirs, ", "))
+	stale := 0
+	for _, step := range rp.Steps {
+		what := fmt.Sprintf("%s %s", step.Action, step.Source)
+		switch {
+		case step.Action == ActionExec:
+			what += ": " + step.Command
+		case step.Dest != "":
+			what += " → " + step.Dest
+		}
+		if why := step.changed(); why != "" {
+			fmt.Printf("  ⚠️ %s (%s)\n", what, why)
+			stale++
+		} else {
+			fmt.Printf("  %s\n", what)
+		}
+	}
+	if stale > 0 {
+		fmt.Printf("%d step(s) changed since staging; commit will refuse until you stage again\n", stale)
+	}
+	return 0
+}
+
+// runCommit implements "organizer commit": it carries out the staged plan
+// like apply and, once done, unstages it.
+func runCommit(args []string) int {
+	fs := flag.NewFlagSet("commit", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show what committing would do without changing anything")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer commit [-dry-run]")
+		return 2
+	}
+	rp, err := readStagedPlan()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	if rp == nil {
+		fmt.Println("Nothing staged; see stage")
+		return 0
+	}
+	code := applyPlan(rp, *dryRun)
+	if code == 0 && !*dryRun {
+		if err := os.Remove(stagedPlanPath()); err != nil {
+			fmt.Printf("⚠️ Failed to unstage the plan: %v\n", err)
+		}
+	}
+	return code
+}
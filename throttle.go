@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttleChunk is the most a throttled read asks for at once, and so the
+// size of one I/O operation under -iops.
+const throttleChunk = 256 << 10
+
+// byteRate is a rate in bytes per second, written like a size with an
+// optional "/s", e.g. "20MB/s".
+type byteRate ByteSize
+
+// Set implements flag.Value.
+func (r *byteRate) Set(s string) error {
+	return (*ByteSize)(r).Set(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+}
+
+func (r byteRate) String() string {
+	if r == 0 {
+		return "0"
+	}
+	return ByteSize(r).String() + "/s"
+}
+
+// rateLimiter spaces out work so it averages at most rate units a second,
+// however many workers share it. A nil or zero-rate limiter lets
+// everything through.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time // when the work reserved so far is paid for
+}
+
+// bandwidth and iops hold -bwlimit and -iops: how many bytes a second the
+// run reads, and how many I/O operations it makes.
+var bandwidth, iops rateLimiter
+
+// setRate sets the limit; zero removes it.
+func (l *rateLimiter) setRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.next = rate, time.Time{}
+}
+
+// limit returns the rate, or zero if there is none.
+func (l *rateLimiter) limit() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// wait reserves n units and sleeps until they are paid for.
+func (l *rateLimiter) wait(n int64) {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	// Idle time is not saved up, beyond making up for oversleeping.
+	if earliest := time.Now().Add(-100 * time.Millisecond); l.next.Before(earliest) {
+		l.next = earliest
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	until := l.next
+	l.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+// throttling reports whether -bwlimit or -iops is in effect.
+func throttling() bool {
+	return bandwidth.limit() > 0 || iops.limit() > 0
+}
+
+// throttledReader reads within -bwlimit and -iops.
+type throttledReader struct {
+	r io.Reader
+}
+
+func (t throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	iops.wait(1)
+	n, err := t.r.Read(p)
+	bandwidth.wait(int64(n))
+	return n, err
+}
+
+// WriteTo copies in throttleChunk reads, where io.Copy would otherwise
+// make many small ones.
+func (t throttledReader) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, throttleChunk)
+	var written int64
+	for {
+		n, err := t.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		} else if err != nil {
+			return written, err
+		}
+	}
+}
+
+// throttle returns r, throttled if -bwlimit or -iops is set. Unthrottled
+// readers keep fast paths such as copy_file_range.
+func throttle(r io.Reader) io.Reader {
+	if !throttling() {
+		return r
+	}
+	return throttledReader{r}
+}
+
+// throttleOp waits its turn for an I/O operation other than reading data,
+// such as a rename, under -iops.
+func throttleOp() {
+	iops.wait(1)
+}
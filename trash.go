@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// trashCan is the platform's trash: the XDG Trash on Linux and the BSDs,
+// the Trash on macOS and the Recycle Bin on Windows.
+type trashCan interface {
+	// put moves the file or folder at path into the trash and returns
+	// where it is kept there, or "" if the platform doesn't say.
+	put(path string) (string, error)
+	// restore moves an item put returned back to path.
+	restore(trashed, path string) error
+}
+
+// systemTrash is this platform's trash.
+var systemTrash trashCan = newTrash()
+
+// useTrash holds -trash: files removed by the delete action go to the
+// trash rather than being unlinked.
+var useTrash = true
+
+// trashDuplicates holds -trash-duplicates: a file moving onto an identical
+// file goes to the trash instead of being kept under another name.
+var trashDuplicates bool
+
+// deleteFile removes the file at path for the delete action: into the
+// trash, or with -trash=false for good. It returns where the trash keeps
+// the file, "" if nowhere known.
+func deleteFile(path string) (string, error) {
+	if !useTrash {
+		return "", retryStale(func() error { return os.Remove(longPath(path)) })
+	}
+	return systemTrash.put(path)
+}
+
+// isDuplicate reports whether destPath is a regular file with the same
+// contents as the file, but not the file itself through a hard link.
+func isDuplicate(file File, destPath string) bool {
+	dest, err := os.Lstat(longPath(destPath))
+	if err != nil || !dest.Mode().IsRegular() || dest.Size() != file.Size {
+		return false
+	}
+	src, err := os.Lstat(longPath(file.Path))
+	if err != nil || os.SameFile(src, dest) {
+		return false
+	}
+	return verifyCopy(file.Path, destPath) == nil
+}
+
+// trashDuplicate puts the file, a duplicate of destPath, in the trash.
+// With -atomic that waits until the run commits.
+func trashDuplicate(file File, destPath string, dryRun bool) error {
+	if dryRun {
+		fmt.Printf("Would trash %q: %s is identical\n", file.Name, destPath)
+		return nil
+	}
+	if runJournal.deferring() {
+		runJournal.remove(file.Path, ActionDelete)
+		return nil
+	}
+	trashed, err := systemTrash.put(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to trash duplicate: %v", err)
+	}
+	fmt.Printf("🗑️ Trashed %q: %s is identical\n", file.Name, destPath)
+	runJournal.add(journalOp{Action: ActionDelete, Source: file.Path, Trash: trashed})
+	return nil
+}
+
+// topDir returns the top directory of the file system holding path, the
+// mount point a per-volume trash lives under.
+func topDir(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return filepath.Dir(path)
+	}
+	dev, ok := deviceID(info)
+	dir := path
+	for ok {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		pinfo, err := os.Stat(parent)
+		if err != nil {
+			break
+		}
+		if pdev, _ := deviceID(pinfo); pdev != dev {
+			break
+		}
+		dir = parent
+	}
+	return dir
+}
+
+// trashName returns base, or if that is taken base with a counter before
+// the extension.
+func trashName(base string, taken func(name string) bool) string {
+	ext := filepath.Ext(base)
+	stem := base[:len(base)-len(ext)]
+	name := base
+	for i := 2; taken(name); i++ {
+		name = fmt.Sprintf("%s %d%s", stem, i, ext)
+	}
+	return name
+}
+
+// exists reports whether anything is at path.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// macTrash is the macOS Trash: ~/.Trash, and for files on other volumes
+// the volume's .Trashes/$uid, which Finder shows as part of the same
+// Trash. Put Back in Finder needs metadata only Finder writes, so items
+// are restored by undo instead.
+type macTrash struct{}
+
+func newTrash() trashCan {
+	return macTrash{}
+}
+
+func (macTrash) put(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	trashed, err := putMac(filepath.Join(home, ".Trash"), abs)
+	if errors.Is(err, syscall.EXDEV) {
+		trashed, err = putMac(filepath.Join(topDir(abs), ".Trashes", fmt.Sprint(os.Getuid())), abs)
+	}
+	return trashed, err
+}
+
+// putMac moves abs into the trash directory under a free name.
+func putMac(trash, abs string) (string, error) {
+	if err := os.MkdirAll(trash, 0700); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(trash, trashName(filepath.Base(abs), func(name string) bool {
+		return exists(filepath.Join(trash, name))
+	}))
+	if err := retryStale(func() error { return os.Rename(abs, dest) }); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+func (macTrash) restore(trashed, path string) error {
+	return os.Rename(trashed, path)
+}
@@ -0,0 +1,21 @@
+//go:build !unix && !windows
+
+package main
+
+import "errors"
+
+// noTrash stands in on platforms without a trash; deleting fails rather
+// than unlinking unless -trash=false.
+type noTrash struct{}
+
+func newTrash() trashCan {
+	return noTrash{}
+}
+
+func (noTrash) put(path string) (string, error) {
+	return "", errors.New("this platform has no trash; use -trash=false to delete for good")
+}
+
+func (noTrash) restore(trashed, path string) error {
+	return errors.New("this platform has no trash")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// SHFileOperationW and its flags, from shellapi.h.
+var procSHFileOperation = syscall.NewLazyDLL("shell32.dll").NewProc("SHFileOperationW")
+
+const (
+	foDelete          = 0x0003
+	fofSilent         = 0x0004
+	fofNoConfirmation = 0x0010
+	fofAllowUndo      = 0x0040
+	fofNoErrorUI      = 0x0400
+)
+
+// shFileOpStruct is SHFILEOPSTRUCTW.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// recycleBin is the Windows Recycle Bin. The shell doesn't say where it
+// keeps an item, so items are restored from the Recycle Bin, not by undo.
+type recycleBin struct{}
+
+func newTrash() trashCan {
+	return recycleBin{}
+}
+
+func (recycleBin) put(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// The shell takes a list of paths ending in an empty one, and no
+	// \\?\ prefixes.
+	from, err := syscall.UTF16FromString(abs)
+	if err != nil {
+		return "", err
+	}
+	from = append(from, 0)
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+	if r, _, _ := procSHFileOperation.Call(uintptr(unsafe.Pointer(&op))); r != 0 {
+		return "", fmt.Errorf("moving to the Recycle Bin failed with code %#x", r)
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return "", errors.New("moving to the Recycle Bin was cancelled")
+	}
+	return "", nil
+}
+
+func (recycleBin) restore(trashed, path string) error {
+	return errors.New("restore it from the Recycle Bin")
+}
@@ -0,0 +1,106 @@
+//go:build unix && !darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// xdgTrash is the trash of the freedesktop.org Trash specification: the
+// home trash, and for files on other file systems a .Trash-$uid folder
+// at the top of theirs. Each item has a .trashinfo file recording where
+// it came from, so file managers can restore it.
+type xdgTrash struct{}
+
+func newTrash() trashCan {
+	return xdgTrash{}
+}
+
+// homeTrash returns $XDG_DATA_HOME/Trash, by default ~/.local/share/Trash.
+func homeTrash() (string, error) {
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" && filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+func (xdgTrash) put(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	trash, err := homeTrash()
+	if err != nil {
+		return "", err
+	}
+	trashed, err := putXDG(trash, abs, abs)
+	if errors.Is(err, syscall.EXDEV) {
+		// The home trash is on another file system; use this one's.
+		top := topDir(abs)
+		rel, _ := filepath.Rel(top, abs)
+		trashed, err = putXDG(filepath.Join(top, fmt.Sprintf(".Trash-%d", os.Getuid())), abs, rel)
+	}
+	return trashed, err
+}
+
+// putXDG moves abs into the trash directory, recording infoPath, absolute
+// or relative to the trash's file system, as where it came from. The info
+// file is created first so the name is claimed before the move.
+func putXDG(trash, abs, infoPath string) (string, error) {
+	files, info := filepath.Join(trash, "files"), filepath.Join(trash, "info")
+	for _, dir := range []string{files, info} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+	}
+	text := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: infoPath}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+	for {
+		name := trashName(filepath.Base(abs), func(name string) bool {
+			return exists(filepath.Join(files, name)) || exists(filepath.Join(info, name+".trashinfo"))
+		})
+		infoFile := filepath.Join(info, name+".trashinfo")
+		f, err := os.OpenFile(infoFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue // Claimed by another item meanwhile.
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.WriteString(text)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		dest := filepath.Join(files, name)
+		if err == nil {
+			err = retryStale(func() error { return os.Rename(abs, dest) })
+		}
+		if err != nil {
+			os.Remove(infoFile)
+			return "", err
+		}
+		return dest, nil
+	}
+}
+
+func (xdgTrash) restore(trashed, path string) error {
+	if err := os.Rename(trashed, path); err != nil {
+		return err
+	}
+	name := filepath.Base(trashed)
+	info := filepath.Join(filepath.Dir(filepath.Dir(trashed)), "info", name+".trashinfo")
+	if err := os.Remove(info); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("restored, but failed to remove %s: %v", info, err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runUndo implements "organizer undo": it reverses the last run that
+// hasn't been undone yet, or the one given with -run, from its journal.
+func runUndo(args []string) int {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	runID := fs.String("run", "", "ID of the run to undo (default: the latest one not yet undone)")
+	list := fs.Bool("list", false, "List the journaled runs instead of undoing one")
+	dryRun := fs.Bool("dry-run", false, "Show what would be put back without changing anything")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer undo [-run ID] [-list] [-dry-run]")
+		return 2
+	}
+
+	runs, err := listRuns()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	if *list {
+		printRuns(runs)
+		return 0
+	}
+
+	var run *runRecord
+	for i := len(runs) - 1; i >= 0; i-- {
+		if *runID == "" && !runs[i].Undone || runs[i].ID == *runID {
+			run = &runs[i]
+			break
+		}
+	}
+	switch {
+	case run == nil && *runID != "":
+		fmt.Printf("❌ no journaled run %q; see undo -list\n", *runID)
+		return 1
+	case run == nil:
+		fmt.Println("Nothing to undo")
+		return 0
+	case run.Undone:
+		fmt.Printf("❌ run %s has already been undone\n", run.ID)
+		return 1
+	}
+
+	if *dryRun {
+		for i := len(run.Ops) - 1; i >= 0; i-- {
+			if line := run.Ops[i].describe(); line != "" {
+				fmt.Println("Would " + line)
+			}
+		}
+		return 0
+	}
+	// Directories removed since can't be raced in.
+	var dirs []string
+	for _, dir := range run.Start.Dirs {
+		if _, err := os.Stat(longPath(dir)); err == nil {
+			dirs = append(dirs, dir)
+		}
+	}
+	release, err := lockDirs(dirs)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	defer release()
+	undone, errs := undoOps(run.Ops)
+	if err := run.markUndone(); err != nil {
+		fmt.Printf("⚠️ Failed to mark run %s as undone: %v\n", run.ID, err)
+	}
+	fmt.Printf("↩️ Undid run %s: %d change(s) put back\n", run.ID, undone)
+	for _, err := range errs {
+		fmt.Printf("❌ %v\n", err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// describe says what undoing the step does, for dry runs, or "" for steps
+// not worth a line.
+func (op journalOp) describe() string {
+	switch op.Action {
+	case opMkdir:
+		return fmt.Sprintf("remove folder %s if empty", op.Dest)
+	case opRmdir:
+		return fmt.Sprintf("recreate folder %s", op.Source)
+	case opMarker, opUnmark:
+		return ""
+	case opLink:
+		return fmt.Sprintf("turn %s back into a copy of %s", op.Dest, op.Source)
+	case opReplace:
+		if op.Backup == "" {
+			return fmt.Sprintf("fail to restore the file replaced at %s", op.Dest)
+		}
+		return fmt.Sprintf("restore the file replaced at %s", op.Dest)
+	case ActionDelete:
+		if op.Trash != "" {
+			return fmt.Sprintf("take %s back out of the trash", op.Source)
+		}
+		return fmt.Sprintf("fail to restore the deleted %s", op.Source)
+	case ActionExec:
+		return fmt.Sprintf("fail to undo the command run for %s", op.Source)
+	case ActionMove, ActionRename:
+		return fmt.Sprintf("move %s back to %s", op.Dest, op.Source)
+	case ActionExtract:
+		return fmt.Sprintf("remove %s, extracted from %s", op.Dest, op.Source)
+	case ActionArchive:
+		if _, err := os.Lstat(longPath(op.Source)); err != nil {
+			return fmt.Sprintf("unpack %s from %s", op.Source, op.Dest)
+		}
+		return ""
+	case ActionCompress:
+		if _, err := os.Lstat(longPath(op.Source)); err != nil {
+			return fmt.Sprintf("unpack %s to %s and remove it", op.Dest, op.Source)
+		}
+	}
+	return fmt.Sprintf("remove %s", op.Dest)
+}
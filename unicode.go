@@ -0,0 +1,387 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Unicode normalization forms for file names, see -normalize-names. macOS
+// stores names decomposed (NFD, "e" followed by a combining accent) while
+// Linux and Windows keep whatever they are given, usually composed (NFC),
+// so the same name can arrive in either form.
+const (
+	FormNFC = "nfc"
+	FormNFD = "nfd"
+)
+
+// normalizeNames is the form names are converted to when files are moved,
+// "" to keep them as they are.
+var normalizeNames string
+
+// compositions lists each precomposed letter with the base and combining
+// mark it decomposes into. It covers the Latin, Greek and Cyrillic letters
+// with diacritics, which are what file names need in practice; Hangul is
+// composed algorithmically below.
+var compositions = [][3]rune{
+	{0x41, 0x300, 0xc0}, {0x41, 0x301, 0xc1}, {0x41, 0x302, 0xc2}, {0x41, 0x303, 0xc3}, {0x41, 0x308, 0xc4},
+	{0x41, 0x30a, 0xc5}, {0x43, 0x327, 0xc7}, {0x45, 0x300, 0xc8}, {0x45, 0x301, 0xc9}, {0x45, 0x302, 0xca},
+	{0x45, 0x308, 0xcb}, {0x49, 0x300, 0xcc}, {0x49, 0x301, 0xcd}, {0x49, 0x302, 0xce}, {0x49, 0x308, 0xcf},
+	{0x4e, 0x303, 0xd1}, {0x4f, 0x300, 0xd2}, {0x4f, 0x301, 0xd3}, {0x4f, 0x302, 0xd4}, {0x4f, 0x303, 0xd5},
+	{0x4f, 0x308, 0xd6}, {0x55, 0x300, 0xd9}, {0x55, 0x301, 0xda}, {0x55, 0x302, 0xdb}, {0x55, 0x308, 0xdc},
+	{0x59, 0x301, 0xdd}, {0x61, 0x300, 0xe0}, {0x61, 0x301, 0xe1}, {0x61, 0x302, 0xe2}, {0x61, 0x303, 0xe3},
+	{0x61, 0x308, 0xe4}, {0x61, 0x30a, 0xe5}, {0x63, 0x327, 0xe7}, {0x65, 0x300, 0xe8}, {0x65, 0x301, 0xe9},
+	{0x65, 0x302, 0xea}, {0x65, 0x308, 0xeb}, {0x69, 0x300, 0xec}, {0x69, 0x301, 0xed}, {0x69, 0x302, 0xee},
+	{0x69, 0x308, 0xef}, {0x6e, 0x303, 0xf1}, {0x6f, 0x300, 0xf2}, {0x6f, 0x301, 0xf3}, {0x6f, 0x302, 0xf4},
+	{0x6f, 0x303, 0xf5}, {0x6f, 0x308, 0xf6}, {0x75, 0x300, 0xf9}, {0x75, 0x301, 0xfa}, {0x75, 0x302, 0xfb},
+	{0x75, 0x308, 0xfc}, {0x79, 0x301, 0xfd}, {0x79, 0x308, 0xff}, {0x41, 0x304, 0x100}, {0x61, 0x304, 0x101},
+	{0x41, 0x306, 0x102}, {0x61, 0x306, 0x103}, {0x41, 0x328, 0x104}, {0x61, 0x328, 0x105}, {0x43, 0x301, 0x106},
+	{0x63, 0x301, 0x107}, {0x43, 0x302, 0x108}, {0x63, 0x302, 0x109}, {0x43, 0x307, 0x10a}, {0x63, 0x307, 0x10b},
+	{0x43, 0x30c, 0x10c}, {0x63, 0x30c, 0x10d}, {0x44, 0x30c, 0x10e}, {0x64, 0x30c, 0x10f}, {0x45, 0x304, 0x112},
+	{0x65, 0x304, 0x113}, {0x45, 0x306, 0x114}, {0x65, 0x306, 0x115}, {0x45, 0x307, 0x116}, {0x65, 0x307, 0x117},
+	{0x45, 0x328, 0x118}, {0x65, 0x328, 0x119}, {0x45, 0x30c, 0x11a}, {0x65, 0x30c, 0x11b}, {0x47, 0x302, 0x11c},
+	{0x67, 0x302, 0x11d}, {0x47, 0x306, 0x11e}, {0x67, 0x306, 0x11f}, {0x47, 0x307, 0x120}, {0x67, 0x307, 0x121},
+	{0x47, 0x327, 0x122}, {0x67, 0x327, 0x123}, {0x48, 0x302, 0x124}, {0x68, 0x302, 0x125}, {0x49, 0x303, 0x128},
+	{0x69, 0x303, 0x129}, {0x49, 0x304, 0x12a}, {0x69, 0x304, 0x12b}, {0x49, 0x306, 0x12c}, {0x69, 0x306, 0x12d},
+	{0x49, 0x328, 0x12e}, {0x69, 0x328, 0x12f}, {0x49, 0x307, 0x130}, {0x4a, 0x302, 0x134}, {0x6a, 0x302, 0x135},
+	{0x4b, 0x327, 0x136}, {0x6b, 0x327, 0x137}, {0x4c, 0x301, 0x139}, {0x6c, 0x301, 0x13a}, {0x4c, 0x327, 0x13b},
+	{0x6c, 0x327, 0x13c}, {0x4c, 0x30c, 0x13d}, {0x6c, 0x30c, 0x13e}, {0x4e, 0x301, 0x143}, {0x6e, 0x301, 0x144},
+	{0x4e, 0x327, 0x145}, {0x6e, 0x327, 0x146}, {0x4e, 0x30c, 0x147}, {0x6e, 0x30c, 0x148}, {0x4f, 0x304, 0x14c},
+	{0x6f, 0x304, 0x14d}, {0x4f, 0x306, 0x14e}, {0x6f, 0x306, 0x14f}, {0x4f, 0x30b, 0x150}, {0x6f, 0x30b, 0x151},
+	{0x52, 0x301, 0x154}, {0x72, 0x301, 0x155}, {0x52, 0x327, 0x156}, {0x72, 0x327, 0x157}, {0x52, 0x30c, 0x158},
+	{0x72, 0x30c, 0x159}, {0x53, 0x301, 0x15a}, {0x73, 0x301, 0x15b}, {0x53, 0x302, 0x15c}, {0x73, 0x302, 0x15d},
+	{0x53, 0x327, 0x15e}, {0x73, 0x327, 0x15f}, {0x53, 0x30c, 0x160}, {0x73, 0x30c, 0x161}, {0x54, 0x327, 0x162},
+	{0x74, 0x327, 0x163}, {0x54, 0x30c, 0x164}, {0x74, 0x30c, 0x165}, {0x55, 0x303, 0x168}, {0x75, 0x303, 0x169},
+	{0x55, 0x304, 0x16a}, {0x75, 0x304, 0x16b}, {0x55, 0x306, 0x16c}, {0x75, 0x306, 0x16d}, {0x55, 0x30a, 0x16e},
+	{0x75, 0x30a, 0x16f}, {0x55, 0x30b, 0x170}, {0x75, 0x30b, 0x171}, {0x55, 0x328, 0x172}, {0x75, 0x328, 0x173},
+	{0x57, 0x302, 0x174}, {0x77, 0x302, 0x175}, {0x59, 0x302, 0x176}, {0x79, 0x302, 0x177}, {0x59, 0x308, 0x178},
+	{0x5a, 0x301, 0x179}, {0x7a, 0x301, 0x17a}, {0x5a, 0x307, 0x17b}, {0x7a, 0x307, 0x17c}, {0x5a, 0x30c, 0x17d},
+	{0x7a, 0x30c, 0x17e}, {0x4f, 0x31b, 0x1a0}, {0x6f, 0x31b, 0x1a1}, {0x55, 0x31b, 0x1af}, {0x75, 0x31b, 0x1b0},
+	{0x41, 0x30c, 0x1cd}, {0x61, 0x30c, 0x1ce}, {0x49, 0x30c, 0x1cf}, {0x69, 0x30c, 0x1d0}, {0x4f, 0x30c, 0x1d1},
+	{0x6f, 0x30c, 0x1d2}, {0x55, 0x30c, 0x1d3}, {0x75, 0x30c, 0x1d4}, {0xdc, 0x304, 0x1d5}, {0xfc, 0x304, 0x1d6},
+	{0xdc, 0x301, 0x1d7}, {0xfc, 0x301, 0x1d8}, {0xdc, 0x30c, 0x1d9}, {0xfc, 0x30c, 0x1da}, {0xdc, 0x300, 0x1db},
+	{0xfc, 0x300, 0x1dc}, {0xc4, 0x304, 0x1de}, {0xe4, 0x304, 0x1df}, {0x226, 0x304, 0x1e0}, {0x227, 0x304, 0x1e1},
+	{0xc6, 0x304, 0x1e2}, {0xe6, 0x304, 0x1e3}, {0x47, 0x30c, 0x1e6}, {0x67, 0x30c, 0x1e7}, {0x4b, 0x30c, 0x1e8},
+	{0x6b, 0x30c, 0x1e9}, {0x4f, 0x328, 0x1ea}, {0x6f, 0x328, 0x1eb}, {0x1ea, 0x304, 0x1ec}, {0x1eb, 0x304, 0x1ed},
+	{0x1b7, 0x30c, 0x1ee}, {0x292, 0x30c, 0x1ef}, {0x6a, 0x30c, 0x1f0}, {0x47, 0x301, 0x1f4}, {0x67, 0x301, 0x1f5},
+	{0x4e, 0x300, 0x1f8}, {0x6e, 0x300, 0x1f9}, {0xc5, 0x301, 0x1fa}, {0xe5, 0x301, 0x1fb}, {0xc6, 0x301, 0x1fc},
+	{0xe6, 0x301, 0x1fd}, {0xd8, 0x301, 0x1fe}, {0xf8, 0x301, 0x1ff}, {0x41, 0x30f, 0x200}, {0x61, 0x30f, 0x201},
+	{0x41, 0x311, 0x202}, {0x61, 0x311, 0x203}, {0x45, 0x30f, 0x204}, {0x65, 0x30f, 0x205}, {0x45, 0x311, 0x206},
+	{0x65, 0x311, 0x207}, {0x49, 0x30f, 0x208}, {0x69, 0x30f, 0x209}, {0x49, 0x311, 0x20a}, {0x69, 0x311, 0x20b},
+	{0x4f, 0x30f, 0x20c}, {0x6f, 0x30f, 0x20d}, {0x4f, 0x311, 0x20e}, {0x6f, 0x311, 0x20f}, {0x52, 0x30f, 0x210},
+	{0x72, 0x30f, 0x211}, {0x52, 0x311, 0x212}, {0x72, 0x311, 0x213}, {0x55, 0x30f, 0x214}, {0x75, 0x30f, 0x215},
+	{0x55, 0x311, 0x216}, {0x75, 0x311, 0x217}, {0x53, 0x326, 0x218}, {0x73, 0x326, 0x219}, {0x54, 0x326, 0x21a},
+	{0x74, 0x326, 0x21b}, {0x48, 0x30c, 0x21e}, {0x68, 0x30c, 0x21f}, {0x41, 0x307, 0x226}, {0x61, 0x307, 0x227},
+	{0x45, 0x327, 0x228}, {0x65, 0x327, 0x229}, {0xd6, 0x304, 0x22a}, {0xf6, 0x304, 0x22b}, {0xd5, 0x304, 0x22c},
+	{0xf5, 0x304, 0x22d}, {0x4f, 0x307, 0x22e}, {0x6f, 0x307, 0x22f}, {0x22e, 0x304, 0x230}, {0x22f, 0x304, 0x231},
+	{0x59, 0x304, 0x232}, {0x79, 0x304, 0x233}, {0xa8, 0x301, 0x385}, {0x391, 0x301, 0x386}, {0x395, 0x301, 0x388},
+	{0x397, 0x301, 0x389}, {0x399, 0x301, 0x38a}, {0x39f, 0x301, 0x38c}, {0x3a5, 0x301, 0x38e}, {0x3a9, 0x301, 0x38f},
+	{0x3ca, 0x301, 0x390}, {0x399, 0x308, 0x3aa}, {0x3a5, 0x308, 0x3ab}, {0x3b1, 0x301, 0x3ac}, {0x3b5, 0x301, 0x3ad},
+	{0x3b7, 0x301, 0x3ae}, {0x3b9, 0x301, 0x3af}, {0x3cb, 0x301, 0x3b0}, {0x3b9, 0x308, 0x3ca}, {0x3c5, 0x308, 0x3cb},
+	{0x3bf, 0x301, 0x3cc}, {0x3c5, 0x301, 0x3cd}, {0x3c9, 0x301, 0x3ce}, {0x3d2, 0x301, 0x3d3}, {0x3d2, 0x308, 0x3d4},
+	{0x415, 0x300, 0x400}, {0x415, 0x308, 0x401}, {0x413, 0x301, 0x403}, {0x406, 0x308, 0x407}, {0x41a, 0x301, 0x40c},
+	{0x418, 0x300, 0x40d}, {0x423, 0x306, 0x40e}, {0x418, 0x306, 0x419}, {0x438, 0x306, 0x439}, {0x435, 0x300, 0x450},
+	{0x435, 0x308, 0x451}, {0x433, 0x301, 0x453}, {0x456, 0x308, 0x457}, {0x43a, 0x301, 0x45c}, {0x438, 0x300, 0x45d},
+	{0x443, 0x306, 0x45e}, {0x474, 0x30f, 0x476}, {0x475, 0x30f, 0x477}, {0x416, 0x306, 0x4c1}, {0x436, 0x306, 0x4c2},
+	{0x410, 0x306, 0x4d0}, {0x430, 0x306, 0x4d1}, {0x410, 0x308, 0x4d2}, {0x430, 0x308, 0x4d3}, {0x415, 0x306, 0x4d6},
+	{0x435, 0x306, 0x4d7}, {0x4d8, 0x308, 0x4da}, {0x4d9, 0x308, 0x4db}, {0x416, 0x308, 0x4dc}, {0x436, 0x308, 0x4dd},
+	{0x417, 0x308, 0x4de}, {0x437, 0x308, 0x4df}, {0x418, 0x304, 0x4e2}, {0x438, 0x304, 0x4e3}, {0x418, 0x308, 0x4e4},
+	{0x438, 0x308, 0x4e5}, {0x41e, 0x308, 0x4e6}, {0x43e, 0x308, 0x4e7}, {0x4e8, 0x308, 0x4ea}, {0x4e9, 0x308, 0x4eb},
+	{0x42d, 0x308, 0x4ec}, {0x44d, 0x308, 0x4ed}, {0x423, 0x304, 0x4ee}, {0x443, 0x304, 0x4ef}, {0x423, 0x308, 0x4f0},
+	{0x443, 0x308, 0x4f1}, {0x423, 0x30b, 0x4f2}, {0x443, 0x30b, 0x4f3}, {0x427, 0x308, 0x4f4}, {0x447, 0x308, 0x4f5},
+	{0x42b, 0x308, 0x4f8}, {0x44b, 0x308, 0x4f9}, {0x41, 0x325, 0x1e00}, {0x61, 0x325, 0x1e01}, {0x42, 0x307, 0x1e02},
+	{0x62, 0x307, 0x1e03}, {0x42, 0x323, 0x1e04}, {0x62, 0x323, 0x1e05}, {0x42, 0x331, 0x1e06}, {0x62, 0x331, 0x1e07},
+	{0xc7, 0x301, 0x1e08}, {0xe7, 0x301, 0x1e09}, {0x44, 0x307, 0x1e0a}, {0x64, 0x307, 0x1e0b}, {0x44, 0x323, 0x1e0c},
+	{0x64, 0x323, 0x1e0d}, {0x44, 0x331, 0x1e0e}, {0x64, 0x331, 0x1e0f}, {0x44, 0x327, 0x1e10}, {0x64, 0x327, 0x1e11},
+	{0x44, 0x32d, 0x1e12}, {0x64, 0x32d, 0x1e13}, {0x112, 0x300, 0x1e14}, {0x113, 0x300, 0x1e15}, {0x112, 0x301, 0x1e16},
+	{0x113, 0x301, 0x1e17}, {0x45, 0x32d, 0x1e18}, {0x65, 0x32d, 0x1e19}, {0x45, 0x330, 0x1e1a}, {0x65, 0x330, 0x1e1b},
+	{0x228, 0x306, 0x1e1c}, {0x229, 0x306, 0x1e1d}, {0x46, 0x307, 0x1e1e}, {0x66, 0x307, 0x1e1f}, {0x47, 0x304, 0x1e20},
+	{0x67, 0x304, 0x1e21}, {0x48, 0x307, 0x1e22}, {0x68, 0x307, 0x1e23}, {0x48, 0x323, 0x1e24}, {0x68, 0x323, 0x1e25},
+	{0x48, 0x308, 0x1e26}, {0x68, 0x308, 0x1e27}, {0x48, 0x327, 0x1e28}, {0x68, 0x327, 0x1e29}, {0x48, 0x32e, 0x1e2a},
+	{0x68, 0x32e, 0x1e2b}, {0x49, 0x330, 0x1e2c}, {0x69, 0x330, 0x1e2d}, {0xcf, 0x301, 0x1e2e}, {0xef, 0x301, 0x1e2f},
+	{0x4b, 0x301, 0x1e30}, {0x6b, 0x301, 0x1e31}, {0x4b, 0x323, 0x1e32}, {0x6b, 0x323, 0x1e33}, {0x4b, 0x331, 0x1e34},
+	{0x6b, 0x331, 0x1e35}, {0x4c, 0x323, 0x1e36}, {0x6c, 0x323, 0x1e37}, {0x1e36, 0x304, 0x1e38}, {0x1e37, 0x304, 0x1e39},
+	{0x4c, 0x331, 0x1e3a}, {0x6c, 0x331, 0x1e3b}, {0x4c, 0x32d, 0x1e3c}, {0x6c, 0x32d, 0x1e3d}, {0x4d, 0x301, 0x1e3e},
+	{0x6d, 0x301, 0x1e3f}, {0x4d, 0x307, 0x1e40}, {0x6d, 0x307, 0x1e41}, {0x4d, 0x323, 0x1e42}, {0x6d, 0x323, 0x1e43},
+	{0x4e, 0x307, 0x1e44}, {0x6e, 0x307, 0x1e45}, {0x4e, 0x323, 0x1e46}, {0x6e, 0x323, 0x1e47}, {0x4e, 0x331, 0x1e48},
+	{0x6e, 0x331, 0x1e49}, {0x4e, 0x32d, 0x1e4a}, {0x6e, 0x32d, 0x1e4b}, {0xd5, 0x301, 0x1e4c}, {0xf5, 0x301, 0x1e4d},
+	{0xd5, 0x308, 0x1e4e}, {0xf5, 0x308, 0x1e4f}, {0x14c, 0x300, 0x1e50}, {0x14d, 0x300, 0x1e51}, {0x14c, 0x301, 0x1e52},
+	{0x14d, 0x301, 0x1e53}, {0x50, 0x301, 0x1e54}, {0x70, 0x301, 0x1e55}, {0x50, 0x307, 0x1e56}, {0x70, 0x307, 0x1e57},
+	{0x52, 0x307, 0x1e58}, {0x72, 0x307, 0x1e59}, {0x52, 0x323, 0x1e5a}, {0x72, 0x323, 0x1e5b}, {0x1e5a, 0x304, 0x1e5c},
+	{0x1e5b, 0x304, 0x1e5d}, {0x52, 0x331, 0x1e5e}, {0x72, 0x331, 0x1e5f}, {0x53, 0x307, 0x1e60}, {0x73, 0x307, 0x1e61},
+	{0x53, 0x323, 0x1e62}, {0x73, 0x323, 0x1e63}, {0x15a, 0x307, 0x1e64}, {0x15b, 0x307, 0x1e65}, {0x160, 0x307, 0x1e66},
+	{0x161, 0x307, 0x1e67}, {0x1e62, 0x307, 0x1e68}, {0x1e63, 0x307, 0x1e69}, {0x54, 0x307, 0x1e6a}, {0x74, 0x307, 0x1e6b},
+	{0x54, 0x323, 0x1e6c}, {0x74, 0x323, 0x1e6d}, {0x54, 0x331, 0x1e6e}, {0x74, 0x331, 0x1e6f}, {0x54, 0x32d, 0x1e70},
+	{0x74, 0x32d, 0x1e71}, {0x55, 0x324, 0x1e72}, {0x75, 0x324, 0x1e73}, {0x55, 0x330, 0x1e74}, {0x75, 0x330, 0x1e75},
+	{0x55, 0x32d, 0x1e76}, {0x75, 0x32d, 0x1e77}, {0x168, 0x301, 0x1e78}, {0x169, 0x301, 0x1e79}, {0x16a, 0x308, 0x1e7a},
+	{0x16b, 0x308, 0x1e7b}, {0x56, 0x303, 0x1e7c}, {0x76, 0x303, 0x1e7d}, {0x56, 0x323, 0x1e7e}, {0x76, 0x323, 0x1e7f},
+	{0x57, 0x300, 0x1e80}, {0x77, 0x300, 0x1e81}, {0x57, 0x301, 0x1e82}, {0x77, 0x301, 0x1e83}, {0x57, 0x308, 0x1e84},
+	{0x77, 0x308, 0x1e85}, {0x57, 0x307, 0x1e86}, {0x77, 0x307, 0x1e87}, {0x57, 0x323, 0x1e88}, {0x77, 0x323, 0x1e89},
+	{0x58, 0x307, 0x1e8a}, {0x78, 0x307, 0x1e8b}, {0x58, 0x308, 0x1e8c}, {0x78, 0x308, 0x1e8d}, {0x59, 0x307, 0x1e8e},
+	{0x79, 0x307, 0x1e8f}, {0x5a, 0x302, 0x1e90}, {0x7a, 0x302, 0x1e91}, {0x5a, 0x323, 0x1e92}, {0x7a, 0x323, 0x1e93},
+	{0x5a, 0x331, 0x1e94}, {0x7a, 0x331, 0x1e95}, {0x68, 0x331, 0x1e96}, {0x74, 0x308, 0x1e97}, {0x77, 0x30a, 0x1e98},
+	{0x79, 0x30a, 0x1e99}, {0x17f, 0x307, 0x1e9b}, {0x41, 0x323, 0x1ea0}, {0x61, 0x323, 0x1ea1}, {0x41, 0x309, 0x1ea2},
+	{0x61, 0x309, 0x1ea3}, {0xc2, 0x301, 0x1ea4}, {0xe2, 0x301, 0x1ea5}, {0xc2, 0x300, 0x1ea6}, {0xe2, 0x300, 0x1ea7},
+	{0xc2, 0x309, 0x1ea8}, {0xe2, 0x309, 0x1ea9}, {0xc2, 0x303, 0x1eaa}, {0xe2, 0x303, 0x1eab}, {0x1ea0, 0x302, 0x1eac},
+	{0x1ea1, 0x302, 0x1ead}, {0x102, 0x301, 0x1eae}, {0x103, 0x301, 0x1eaf}, {0x102, 0x300, 0x1eb0}, {0x103, 0x300, 0x1eb1},
+	{0x102, 0x309, 0x1eb2}, {0x103, 0x309, 0x1eb3}, {0x102, 0x303, 0x1eb4}, {0x103, 0x303, 0x1eb5}, {0x1ea0, 0x306, 0x1eb6},
+	{0x1ea1, 0x306, 0x1eb7}, {0x45, 0x323, 0x1eb8}, {0x65, 0x323, 0x1eb9}, {0x45, 0x309, 0x1eba}, {0x65, 0x309, 0x1ebb},
+	{0x45, 0x303, 0x1ebc}, {0x65, 0x303, 0x1ebd}, {0xca, 0x301, 0x1ebe}, {0xea, 0x301, 0x1ebf}, {0xca, 0x300, 0x1ec0},
+	{0xea, 0x300, 0x1ec1}, {0xca, 0x309, 0x1ec2}, {0xea, 0x309, 0x1ec3}, {0xca, 0x303, 0x1ec4}, {0xea, 0x303, 0x1ec5},
+	{0x1eb8, 0x302, 0x1ec6}, {0x1eb9, 0x302, 0x1ec7}, {0x49, 0x309, 0x1ec8}, {0x69, 0x309, 0x1ec9}, {0x49, 0x323, 0x1eca},
+	{0x69, 0x323, 0x1ecb}, {0x4f, 0x323, 0x1ecc}, {0x6f, 0x323, 0x1ecd}, {0x4f, 0x309, 0x1ece}, {0x6f, 0x309, 0x1ecf},
+	{0xd4, 0x301, 0x1ed0}, {0xf4, 0x301, 0x1ed1}, {0xd4, 0x300, 0x1ed2}, {0xf4, 0x300, 0x1ed3}, {0xd4, 0x309, 0x1ed4},
+	{0xf4, 0x309, 0x1ed5}, {0xd4, 0x303, 0x1ed6}, {0xf4, 0x303, 0x1ed7}, {0x1ecc, 0x302, 0x1ed8}, {0x1ecd, 0x302, 0x1ed9},
+	{0x1a0, 0x301, 0x1eda}, {0x1a1, 0x301, 0x1edb}, {0x1a0, 0x300, 0x1edc}, {0x1a1, 0x300, 0x1edd}, {0x1a0, 0x309, 0x1ede},
+	{0x1a1, 0x309, 0x1edf}, {0x1a0, 0x303, 0x1ee0}, {0x1a1, 0x303, 0x1ee1}, {0x1a0, 0x323, 0x1ee2}, {0x1a1, 0x323, 0x1ee3},
+	{0x55, 0x323, 0x1ee4}, {0x75, 0x323, 0x1ee5}, {0x55, 0x309, 0x1ee6}, {0x75, 0x309, 0x1ee7}, {0x1af, 0x301, 0x1ee8},
+	{0x1b0, 0x301, 0x1ee9}, {0x1af, 0x300, 0x1eea}, {0x1b0, 0x300, 0x1eeb}, {0x1af, 0x309, 0x1eec}, {0x1b0, 0x309, 0x1eed},
+	{0x1af, 0x303, 0x1eee}, {0x1b0, 0x303, 0x1eef}, {0x1af, 0x323, 0x1ef0}, {0x1b0, 0x323, 0x1ef1}, {0x59, 0x300, 0x1ef2},
+	{0x79, 0x300, 0x1ef3}, {0x59, 0x323, 0x1ef4}, {0x79, 0x323, 0x1ef5}, {0x59, 0x309, 0x1ef6}, {0x79, 0x309, 0x1ef7},
+	{0x59, 0x303, 0x1ef8}, {0x79, 0x303, 0x1ef9}, {0x3b1, 0x313, 0x1f00}, {0x3b1, 0x314, 0x1f01}, {0x1f00, 0x300, 0x1f02},
+	{0x1f01, 0x300, 0x1f03}, {0x1f00, 0x301, 0x1f04}, {0x1f01, 0x301, 0x1f05}, {0x1f00, 0x342, 0x1f06}, {0x1f01, 0x342, 0x1f07},
+	{0x391, 0x313, 0x1f08}, {0x391, 0x314, 0x1f09}, {0x1f08, 0x300, 0x1f0a}, {0x1f09, 0x300, 0x1f0b}, {0x1f08, 0x301, 0x1f0c},
+	{0x1f09, 0x301, 0x1f0d}, {0x1f08, 0x342, 0x1f0e}, {0x1f09, 0x342, 0x1f0f}, {0x3b5, 0x313, 0x1f10}, {0x3b5, 0x314, 0x1f11},
+	{0x1f10, 0x300, 0x1f12}, {0x1f11, 0x300, 0x1f13}, {0x1f10, 0x301, 0x1f14}, {0x1f11, 0x301, 0x1f15}, {0x395, 0x313, 0x1f18},
+	{0x395, 0x314, 0x1f19}, {0x1f18, 0x300, 0x1f1a}, {0x1f19, 0x300, 0x1f1b}, {0x1f18, 0x301, 0x1f1c}, {0x1f19, 0x301, 0x1f1d},
+	{0x3b7, 0x313, 0x1f20}, {0x3b7, 0x314, 0x1f21}, {0x1f20, 0x300, 0x1f22}, {0x1f21, 0x300, 0x1f23}, {0x1f20, 0x301, 0x1f24},
+	{0x1f21, 0x301, 0x1f25}, {0x1f20, 0x342, 0x1f26}, {0x1f21, 0x342, 0x1f27}, {0x397, 0x313, 0x1f28}, {0x397, 0x314, 0x1f29},
+	{0x1f28, 0x300, 0x1f2a}, {0x1f29, 0x300, 0x1f2b}, {0x1f28, 0x301, 0x1f2c}, {0x1f29, 0x301, 0x1f2d}, {0x1f28, 0x342, 0x1f2e},
+	{0x1f29, 0x342, 0x1f2f}, {0x3b9, 0x313, 0x1f30}, {0x3b9, 0x314, 0x1f31}, {0x1f30, 0x300, 0x1f32}, {0x1f31, 0x300, 0x1f33},
+	{0x1f30, 0x301, 0x1f34}, {0x1f31, 0x301, 0x1f35}, {0x1f30, 0x342, 0x1f36}, {0x1f31, 0x342, 0x1f37}, {0x399, 0x313, 0x1f38},
+	{0x399, 0x314, 0x1f39}, {0x1f38, 0x300, 0x1f3a}, {0x1f39, 0x300, 0x1f3b}, {0x1f38, 0x301, 0x1f3c}, {0x1f39, 0x301, 0x1f3d},
+	{0x1f38, 0x342, 0x1f3e}, {0x1f39, 0x342, 0x1f3f}, {0x3bf, 0x313, 0x1f40}, {0x3bf, 0x314, 0x1f41}, {0x1f40, 0x300, 0x1f42},
+	{0x1f41, 0x300, 0x1f43}, {0x1f40, 0x301, 0x1f44}, {0x1f41, 0x301, 0x1f45}, {0x39f, 0x313, 0x1f48}, {0x39f, 0x314, 0x1f49},
+	{0x1f48, 0x300, 0x1f4a}, {0x1f49, 0x300, 0x1f4b}, {0x1f48, 0x301, 0x1f4c}, {0x1f49, 0x301, 0x1f4d}, {0x3c5, 0x313, 0x1f50},
+	{0x3c5, 0x314, 0x1f51}, {0x1f50, 0x300, 0x1f52}, {0x1f51, 0x300, 0x1f53}, {0x1f50, 0x301, 0x1f54}, {0x1f51, 0x301, 0x1f55},
+	{0x1f50, 0x342, 0x1f56}, {0x1f51, 0x342, 0x1f57}, {0x3a5, 0x314, 0x1f59}, {0x1f59, 0x300, 0x1f5b}, {0x1f59, 0x301, 0x1f5d},
+	{0x1f59, 0x342, 0x1f5f}, {0x3c9, 0x313, 0x1f60}, {0x3c9, 0x314, 0x1f61}, {0x1f60, 0x300, 0x1f62}, {0x1f61, 0x300, 0x1f63},
+	{0x1f60, 0x301, 0x1f64}, {0x1f61, 0x301, 0x1f65}, {0x1f60, 0x342, 0x1f66}, {0x1f61, 0x342, 0x1f67}, {0x3a9, 0x313, 0x1f68},
+	{0x3a9, 0x314, 0x1f69}, {0x1f68, 0x300, 0x1f6a}, {0x1f69, 0x300, 0x1f6b}, {0x1f68, 0x301, 0x1f6c}, {0x1f69, 0x301, 0x1f6d},
+	{0x1f68, 0x342, 0x1f6e}, {0x1f69, 0x342, 0x1f6f}, {0x3b1, 0x300, 0x1f70}, {0x3b5, 0x300, 0x1f72}, {0x3b7, 0x300, 0x1f74},
+	{0x3b9, 0x300, 0x1f76}, {0x3bf, 0x300, 0x1f78}, {0x3c5, 0x300, 0x1f7a}, {0x3c9, 0x300, 0x1f7c}, {0x1f00, 0x345, 0x1f80},
+	{0x1f01, 0x345, 0x1f81}, {0x1f02, 0x345, 0x1f82}, {0x1f03, 0x345, 0x1f83}, {0x1f04, 0x345, 0x1f84}, {0x1f05, 0x345, 0x1f85},
+	{0x1f06, 0x345, 0x1f86}, {0x1f07, 0x345, 0x1f87}, {0x1f08, 0x345, 0x1f88}, {0x1f09, 0x345, 0x1f89}, {0x1f0a, 0x345, 0x1f8a},
+	{0x1f0b, 0x345, 0x1f8b}, {0x1f0c, 0x345, 0x1f8c}, {0x1f0d, 0x345, 0x1f8d}, {0x1f0e, 0x345, 0x1f8e}, {0x1f0f, 0x345, 0x1f8f},
+	{0x1f20, 0x345, 0x1f90}, {0x1f21, 0x345, 0x1f91}, {0x1f22, 0x345, 0x1f92}, {0x1f23, 0x345, 0x1f93}, {0x1f24, 0x345, 0x1f94},
+	{0x1f25, 0x345, 0x1f95}, {0x1f26, 0x345, 0x1f96}, {0x1f27, 0x345, 0x1f97}, {0x1f28, 0x345, 0x1f98}, {0x1f29, 0x345, 0x1f99},
+	{0x1f2a, 0x345, 0x1f9a}, {0x1f2b, 0x345, 0x1f9b}, {0x1f2c, 0x345, 0x1f9c}, {0x1f2d, 0x345, 0x1f9d}, {0x1f2e, 0x345, 0x1f9e},
+	{0x1f2f, 0x345, 0x1f9f}, {0x1f60, 0x345, 0x1fa0}, {0x1f61, 0x345, 0x1fa1}, {0x1f62, 0x345, 0x1fa2}, {0x1f63, 0x345, 0x1fa3},
+	{0x1f64, 0x345, 0x1fa4}, {0x1f65, 0x345, 0x1fa5}, {0x1f66, 0x345, 0x1fa6}, {0x1f67, 0x345, 0x1fa7}, {0x1f68, 0x345, 0x1fa8},
+	{0x1f69, 0x345, 0x1fa9}, {0x1f6a, 0x345, 0x1faa}, {0x1f6b, 0x345, 0x1fab}, {0x1f6c, 0x345, 0x1fac}, {0x1f6d, 0x345, 0x1fad},
+	{0x1f6e, 0x345, 0x1fae}, {0x1f6f, 0x345, 0x1faf}, {0x3b1, 0x306, 0x1fb0}, {0x3b1, 0x304, 0x1fb1}, {0x1f70, 0x345, 0x1fb2},
+	{0x3b1, 0x345, 0x1fb3}, {0x3ac, 0x345, 0x1fb4}, {0x3b1, 0x342, 0x1fb6}, {0x1fb6, 0x345, 0x1fb7}, {0x391, 0x306, 0x1fb8},
+	{0x391, 0x304, 0x1fb9}, {0x391, 0x300, 0x1fba}, {0x391, 0x345, 0x1fbc}, {0xa8, 0x342, 0x1fc1}, {0x1f74, 0x345, 0x1fc2},
+	{0x3b7, 0x345, 0x1fc3}, {0x3ae, 0x345, 0x1fc4}, {0x3b7, 0x342, 0x1fc6}, {0x1fc6, 0x345, 0x1fc7}, {0x395, 0x300, 0x1fc8},
+	{0x397, 0x300, 0x1fca}, {0x397, 0x345, 0x1fcc}, {0x1fbf, 0x300, 0x1fcd}, {0x1fbf, 0x301, 0x1fce}, {0x1fbf, 0x342, 0x1fcf},
+	{0x3b9, 0x306, 0x1fd0}, {0x3b9, 0x304, 0x1fd1}, {0x3ca, 0x300, 0x1fd2}, {0x3b9, 0x342, 0x1fd6}, {0x3ca, 0x342, 0x1fd7},
+	{0x399, 0x306, 0x1fd8}, {0x399, 0x304, 0x1fd9}, {0x399, 0x300, 0x1fda}, {0x1ffe, 0x300, 0x1fdd}, {0x1ffe, 0x301, 0x1fde},
+	{0x1ffe, 0x342, 0x1fdf}, {0x3c5, 0x306, 0x1fe0}, {0x3c5, 0x304, 0x1fe1}, {0x3cb, 0x300, 0x1fe2}, {0x3c1, 0x313, 0x1fe4},
+	{0x3c1, 0x314, 0x1fe5}, {0x3c5, 0x342, 0x1fe6}, {0x3cb, 0x342, 0x1fe7}, {0x3a5, 0x306, 0x1fe8}, {0x3a5, 0x304, 0x1fe9},
+	{0x3a5, 0x300, 0x1fea}, {0x3a1, 0x314, 0x1fec}, {0xa8, 0x300, 0x1fed}, {0x1f7c, 0x345, 0x1ff2}, {0x3c9, 0x345, 0x1ff3},
+	{0x3ce, 0x345, 0x1ff4}, {0x3c9, 0x342, 0x1ff6}, {0x1ff6, 0x345, 0x1ff7}, {0x39f, 0x300, 0x1ff8}, {0x3a9, 0x300, 0x1ffa},
+	{0x3a9, 0x345, 0x1ffc},
+}
+
+// combiningClasses are the canonical combining classes of the marks in
+// U+0300..U+036F, as inclusive ranges. Marks outside it are treated as
+// starters, which only means they are left unchanged.
+var combiningClasses = [][3]rune{
+	{0x300, 0x314, 230},
+	{0x315, 0x315, 232},
+	{0x316, 0x319, 220},
+	{0x31a, 0x31a, 232},
+	{0x31b, 0x31b, 216},
+	{0x31c, 0x320, 220},
+	{0x321, 0x322, 202},
+	{0x323, 0x326, 220},
+	{0x327, 0x328, 202},
+	{0x329, 0x333, 220},
+	{0x334, 0x338, 1},
+	{0x339, 0x33c, 220},
+	{0x33d, 0x344, 230},
+	{0x345, 0x345, 240},
+	{0x346, 0x346, 230},
+	{0x347, 0x349, 220},
+	{0x34a, 0x34c, 230},
+	{0x34d, 0x34e, 220},
+	{0x350, 0x352, 230},
+	{0x353, 0x356, 220},
+	{0x357, 0x357, 230},
+	{0x358, 0x358, 232},
+	{0x359, 0x35a, 220},
+	{0x35b, 0x35b, 230},
+	{0x35c, 0x35c, 233},
+	{0x35d, 0x35e, 234},
+	{0x35f, 0x35f, 233},
+	{0x360, 0x361, 234},
+	{0x362, 0x362, 233},
+	{0x363, 0x36f, 230},
+}
+
+var (
+	composeTable   = map[[2]rune]rune{}
+	decomposeTable = map[rune][2]rune{}
+)
+
+func init() {
+	for _, c := range compositions {
+		composeTable[[2]rune{c[0], c[1]}] = c[2]
+		decomposeTable[c[2]] = [2]rune{c[0], c[1]}
+	}
+}
+
+// combiningClass returns the canonical combining class of r, 0 for starters.
+func combiningClass(r rune) int {
+	if r < 0x300 || r > 0x36f {
+		return 0
+	}
+	for _, c := range combiningClasses {
+		if r >= c[0] && r <= c[1] {
+			return int(c[2])
+		}
+	}
+	return 0
+}
+
+// Hangul syllables are composed from leading consonants, vowels and
+// optional trailing consonants by arithmetic.
+const (
+	hangulBase  = 0xac00
+	hangulL     = 0x1100
+	hangulV     = 0x1161
+	hangulT     = 0x11a7
+	hangulLN    = 19
+	hangulVN    = 21
+	hangulTN    = 28
+	hangulNN    = hangulVN * hangulTN
+	hangulCount = hangulLN * hangulNN
+)
+
+// decompose appends the canonical decomposition of r to out.
+func decompose(out []rune, r rune) []rune {
+	if s := r - hangulBase; s >= 0 && s < hangulCount {
+		out = append(out, hangulL+s/hangulNN, hangulV+(s%hangulNN)/hangulTN)
+		if t := s % hangulTN; t != 0 {
+			out = append(out, hangulT+t)
+		}
+		return out
+	}
+	if d, ok := decomposeTable[r]; ok {
+		return append(decompose(out, d[0]), d[1])
+	}
+	return append(out, r)
+}
+
+// nfd returns s in canonical decomposed form.
+func nfd(s string) []rune {
+	var runes []rune
+	for _, r := range s {
+		runes = decompose(runes, r)
+	}
+	// Put each run of combining marks in canonical order.
+	for i := 0; i < len(runes); {
+		if combiningClass(runes[i]) == 0 {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && combiningClass(runes[j]) != 0 {
+			j++
+		}
+		marks := runes[i:j]
+		sort.SliceStable(marks, func(a, b int) bool { return combiningClass(marks[a]) < combiningClass(marks[b]) })
+		i = j
+	}
+	return runes
+}
+
+// nfc returns s in canonical composed form.
+func nfc(s string) []rune {
+	runes := nfd(s)
+	out := runes[:0]
+	starter := -1 // index in out of the last starter
+	lastClass := 0
+	for _, r := range runes {
+		class := combiningClass(r)
+		if starter >= 0 && (lastClass < class || (lastClass == 0 && len(out)-1 == starter)) {
+			if c, ok := compose(out[starter], r); ok {
+				out[starter] = c
+				continue
+			}
+		}
+		if class == 0 {
+			starter = len(out)
+		}
+		lastClass = class
+		out = append(out, r)
+	}
+	return out
+}
+
+// compose returns the composition of the starter a with r, if any.
+func compose(a, r rune) (rune, bool) {
+	if l, v := a-hangulL, r-hangulV; l >= 0 && l < hangulLN && v >= 0 && v < hangulVN {
+		return hangulBase + (l*hangulVN+v)*hangulTN, true
+	}
+	if s, t := a-hangulBase, r-hangulT; s >= 0 && s < hangulCount && s%hangulTN == 0 && t > 0 && t < hangulTN {
+		return a + t, true
+	}
+	c, ok := composeTable[[2]rune{a, r}]
+	return c, ok
+}
+
+// normalizeName converts s to the given form; other forms leave it as is.
+func normalizeName(s, form string) string {
+	if isASCII(s) {
+		return s
+	}
+	switch form {
+	case FormNFC:
+		return string(nfc(s))
+	case FormNFD:
+		return string(nfd(s))
+	}
+	return s
+}
+
+// sameName reports whether a and b are the same name in different
+// normalization forms.
+func sameName(a, b string) bool {
+	return a == b || normalizeName(a, FormNFC) == normalizeName(b, FormNFC)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// existingDir maps each element of the relative directory rel below base
+// onto an existing folder whose name differs only in normalization form,
+// so a decomposed "Cafe\u0301" and a composed "Caf\u00e9" share one folder
+// instead of producing two that look identical.
+func existingDir(base, rel string) string {
+	parts := strings.Split(rel, string(filepath.Separator))
+	dir := base
+	for i, part := range parts {
+		next := filepath.Join(dir, part)
+		if _, err := os.Lstat(longPath(next)); err != nil && !isASCII(part) {
+			entries, _ := os.ReadDir(longPath(dir))
+			for _, entry := range entries {
+				if entry.IsDir() && sameName(entry.Name(), part) {
+					parts[i] = entry.Name()
+					next = filepath.Join(dir, entry.Name())
+					break
+				}
+			}
+		}
+		dir = next
+	}
+	return filepath.Join(parts...)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteSize is a size in bytes that can be written with units, e.g. "10MB"
+// or "1.5G". Units are powers of 1024.
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a human-readable size such as "512", "10MB" or "1.5 GiB".
+func parseByteSize(s string) (ByteSize, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	factor := 1.0
+	for _, u := range byteUnits {
+		if strings.HasSuffix(text, u.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return ByteSize(n * factor), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	v, err := parseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// Set implements flag.Value so sizes can be given on the command line.
+func (b *ByteSize) Set(s string) error {
+	return b.UnmarshalText([]byte(s))
+}
+
+// String formats the size using the largest unit that keeps it >= 1.
+func (b ByteSize) String() string {
+	n := float64(b)
+	for _, u := range []struct {
+		suffix string
+		factor float64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= u.factor {
+			return strings.TrimSuffix(strconv.FormatFloat(n/u.factor, 'f', 1, 64), ".0") + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
+
+// Age is a duration that additionally accepts day, week and year units,
+// e.g. "30d", "2w" or "2y" (a year is 365 days).
+type Age time.Duration
+
+// parseAge parses an age such as "2h", "30d" or "1.5y".
+func parseAge(s string) (Age, error) {
+	text := strings.TrimSpace(s)
+	units := map[byte]time.Duration{
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+		'y': 365 * 24 * time.Hour,
+	}
+	if text != "" {
+		if unit, ok := units[text[len(text)-1]]; ok {
+			n, err := strconv.ParseFloat(text[:len(text)-1], 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return Age(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return Age(d), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Age) UnmarshalText(text []byte) error {
+	v, err := parseAge(string(text))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Set implements flag.Value so ages can be given on the command line.
+func (a *Age) Set(s string) error {
+	return a.UnmarshalText([]byte(s))
+}
+
+// String formats the age in whole days when possible.
+func (a Age) String() string {
+	d := time.Duration(a)
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return strconv.FormatInt(int64(d/(24*time.Hour)), 10) + "d"
+	}
+	return d.String()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Validator is a check the config runs before a file is moved, copied or
+// compressed, which can veto that file's move.
+type Validator struct {
+	Name       string   `yaml:"name"`       // label used in the report
+	Categories []string `yaml:"categories"` // only check files headed for these; all if empty
+	Exec       string   `yaml:"exec"`       // command template; exiting non-zero vetoes, its output says why
+	Timeout    Age      `yaml:"timeout"`    // exec time limit, default 1m
+	Secrets    []string `yaml:"secrets"`    // regular expressions; contents matching one veto
+	MinFree    ByteSize `yaml:"min_free"`   // veto when the move would leave less free space at the destination
+
+	exec    *template.Template // compiled Exec
+	secrets []*regexp.Regexp   // compiled Secrets
+}
+
+// Validators are checked, in order, before each file is moved. They are
+// replaced by the validators from the config file.
+var Validators []Validator
+
+// vetoError is returned for a file a validator kept from being moved.
+type vetoError struct {
+	validator string
+	reason    string
+}
+
+func (e *vetoError) Error() string {
+	return fmt.Sprintf("vetoed by %s: %s", e.validator, e.reason)
+}
+
+// label returns the validator's name, or a description if it has none.
+func (v *Validator) label() string {
+	switch {
+	case v.Name != "":
+		return v.Name
+	case v.Exec != "":
+		return "exec validator"
+	case len(v.Secrets) > 0:
+		return "secrets validator"
+	}
+	return "free space validator"
+}
+
+// compile checks the validator and compiles its templates and patterns.
+func (v *Validator) compile() error {
+	if v.Exec == "" && len(v.Secrets) == 0 && v.MinFree == 0 {
+		return fmt.Errorf("validator %s: needs exec, secrets or min_free", v.label())
+	}
+	if v.Exec != "" {
+		tmpl, err := parseDestination(v.Exec)
+		if err != nil {
+			return fmt.Errorf("validator %s: invalid exec template: %v", v.label(), err)
+		}
+		v.exec = tmpl
+	}
+	v.secrets = nil
+	for _, pattern := range v.Secrets {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("validator %s: invalid secrets pattern %q: %v", v.label(), pattern, err)
+		}
+		v.secrets = append(v.secrets, re)
+	}
+	return nil
+}
+
+// compileValidators compiles every validator.
+func compileValidators(validators []Validator) error {
+	for i := range validators {
+		if err := validators[i].compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate runs the validators that apply to the file, headed for the
+// folder rel, and returns a *vetoError for the first that vetoes it. Only
+// files placed somewhere are checked: moved, copied, compressed or
+// archived.
+func validate(file File, rel string) error {
+	switch fileAction(file) {
+	case ActionMove, ActionCopy, ActionCompress, ActionArchive:
+	default:
+		return nil
+	}
+	destDir := filepath.Join(file.baseDir(), rel)
+	for i := range Validators {
+		v := &Validators[i]
+		if len(v.Categories) > 0 && !slices.Contains(v.Categories, file.Category) && !slices.Contains(v.Categories, canonicalCategory(file.Category)) {
+			continue
+		}
+		if reason := v.check(file, destDir); reason != "" {
+			return &vetoError{validator: v.label(), reason: reason}
+		}
+	}
+	return nil
+}
+
+// check runs the validator's checks on the file and returns why it vetoes
+// the move, or "" if it doesn't.
+func (v *Validator) check(file File, destDir string) string {
+	if v.MinFree > 0 && remoteDest == nil {
+		if reason := checkFreeSpace(file, destDir, int64(v.MinFree)); reason != "" {
+			return reason
+		}
+	}
+	if len(v.secrets) > 0 && !file.IsDir {
+		if reason := checkSecrets(file.Path, v.secrets); reason != "" {
+			return reason
+		}
+	}
+	if v.exec != nil {
+		command, err := renderCommand(v.exec, file)
+		if err != nil {
+			return err.Error()
+		}
+		output, err := runCommand(command, time.Duration(v.Timeout))
+		if err != nil {
+			if line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n"); line != "" {
+				return line
+			}
+			return fmt.Sprintf("%s: %v", command, err)
+		}
+	}
+	return ""
+}
+
+// checkSecrets reports which of the patterns the file's contents match, or
+// "" if none does.
+func checkSecrets(path string, patterns []*regexp.Regexp) string {
+	for _, re := range patterns {
+		fh, err := os.Open(longPath(path))
+		if err != nil {
+			return fmt.Sprintf("cannot be checked for secrets: %v", err)
+		}
+		matched := re.MatchReader(bufio.NewReader(fh))
+		fh.Close()
+		if matched {
+			return fmt.Sprintf("contents match the secrets pattern %q", re.String())
+		}
+	}
+	return ""
+}
+
+// checkFreeSpace reports whether moving the file into destDir would leave
+// less than minFree bytes free there, or "" if it wouldn't. A move within
+// one file system takes no space. Where free space can't be told, the
+// check passes.
+func checkFreeSpace(file File, destDir string, minFree int64) string {
+	dir := destDir
+	for {
+		if _, err := os.Stat(dir); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent // Created when the file moves.
+	}
+	free, ok := freeSpace(dir)
+	if !ok {
+		return ""
+	}
+	needed := file.Size
+	if fileAction(file) == ActionMove && sameDevice(file.Path, dir) {
+		needed = 0
+	}
+	if int64(free)-needed < minFree {
+		return fmt.Sprintf("%s free at %s, %s needed plus %s kept free", ByteSize(free), dir, ByteSize(needed), ByteSize(minFree))
+	}
+	return ""
+}
+
+// sameDevice reports whether both paths are known to be on one file system.
+func sameDevice(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	ad, ok := deviceID(ai)
+	bd, ok2 := deviceID(bi)
+	return ok && ok2 && ad == bd
+}
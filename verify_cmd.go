@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// misplacedFile is a file in an organized tree that the current rules
+// would put in another folder.
+type misplacedFile struct {
+	file File   // categorized as the rules see it now
+	rel  string // the file's path, relative to the tree's root
+	want string // the folder the rules choose, relative to the root
+	err  error  // why no folder could be worked out
+}
+
+// runVerify implements "organizer verify": it goes through the category
+// folders of an organized directory and reports the files the current
+// rules would put somewhere else, without moving anything. It exits with 1
+// if there are any.
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	configPath := fs.String("config", os.Getenv(envName("config")), "Path to a YAML config file")
+	preset := fs.String("preset", os.Getenv(envName("preset")), "Comma-separated built-in presets to use under the config")
+	profile := fs.String("profile", os.Getenv(envName("profile")), "Named profile from the config file to use")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: go-file-organizer verify [-config path] [-profile name] [-preset name] [dir]")
+		return 2
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = expandHome(fs.Arg(0))
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	cfg, err := loadGlobalConfig(*configPath)
+	if err == nil && *profile != "" {
+		cfg, err = cfg.selectProfile(*profile)
+	}
+	if err == nil {
+		err = prepareConfig(cfg, *preset, dir)
+	}
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	checked, misplaced, err := findMisplaced(dir)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	for _, m := range misplaced {
+		if m.err != nil {
+			fmt.Printf("❌ %s: %v\n", m.rel, m.err)
+		} else {
+			fmt.Printf("⚠️ %s: in %s, rules say %s\n", m.rel, filepath.Dir(m.rel), m.want)
+		}
+	}
+	if len(misplaced) > 0 {
+		fmt.Printf("\n%d of %d organized file(s) are not where the current rules would put them\n", len(misplaced), checked)
+		return 1
+	}
+	fmt.Printf("✅ All %d organized file(s) are where the current rules would put them\n", checked)
+	return 0
+}
+
+// findMisplaced walks the category folders of dir, the root an earlier run
+// organized into, and returns how many files it checked and those the
+// current rules would put in another folder. Files those rules would leave
+// alone, delete, rename in place or hand to a command are not checked, nor
+// are the quarantine folders.
+func findMisplaced(dir string) (int, []misplacedFile, error) {
+	outputs := outputFolders()
+	delete(outputs, quarantineFolder)
+	delete(outputs, unsortedFolder)
+	checked := 0
+	var misplaced []misplacedFile
+	err := walkOrganized(dir, outputs, func(path, rel string, info os.FileInfo) {
+		if !info.Mode().IsRegular() {
+			return
+		}
+		checked++
+		file, want, ok, err := expectedFolder(dir, path, info)
+		if err != nil {
+			misplaced = append(misplaced, misplacedFile{file: file, rel: rel, err: err})
+		} else if ok && want != filepath.Dir(rel) && !inShard(file, want, filepath.Dir(rel)) {
+			misplaced = append(misplaced, misplacedFile{file: file, rel: rel, want: want})
+		}
+	})
+	return checked, misplaced, err
+}
+
+// walkOrganized calls fn for each file in the category folders of dir:
+// those among folders and those an earlier run left its marker in. Hidden
+// files, the directory's own overrides and excluded paths are left out.
+func walkOrganized(dir string, folders map[string]bool, fn func(path, rel string, info os.FileInfo)) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			fmt.Printf("⚠️ Skipping %s: %v\n", path, err)
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		top, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+		if strings.HasPrefix(d.Name(), ".") || d.Name() == localConfigName || d.Name() == ignoreFileName ||
+			Exclude.Excluded(filepath.ToSlash(rel), d.IsDir()) || !folders[top] && !isMarkedFolder(filepath.Join(dir, top)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !nested {
+			return nil // Only files inside category folders were organized.
+		}
+		info, err := d.Info()
+		if err != nil {
+			fmt.Printf("⚠️ Skipping %s: %v\n", path, err)
+			return nil
+		}
+		fn(path, rel, info)
+		return nil
+	})
+}
+
+// expectedFolder categorizes the file at path, under the organized root
+// dir, and returns the folder the rules put it in, relative to dir. ok is
+// false if the rules don't move or copy it. A file the rules compressed is
+// judged by its name without .gz or .zst.
+func expectedFolder(dir, path string, info os.FileInfo) (file File, want string, ok bool, err error) {
+	judge := func(file File) (File, string, bool, error) {
+		file.root = dir
+		file.Categorize()
+		rel, err := destinationFor(&file)
+		if err != nil {
+			return file, "", true, err
+		}
+		switch fileAction(file) {
+		case ActionMove, ActionCopy, ActionCompress:
+			return file, rel, true, nil
+		}
+		return file, "", false, nil
+	}
+	file = newFile(path, info)
+	file, want, ok, err = judge(file)
+	if ext := filepath.Ext(file.Name); (ext == ".gz" || ext == ".zst") && len(ext) < len(file.Name) {
+		inner := newFile(path, info)
+		inner.Name = strings.TrimSuffix(file.Name, ext)
+		inner.Extension = strings.ToLower(filepath.Ext(inner.Name))
+		if innerFile, innerWant, innerOK, innerErr := judge(inner); innerErr == nil && innerOK && fileAction(innerFile) == ActionCompress && compressedExt(compression(innerFile)) == ext {
+			if rel, _ := filepath.Rel(dir, filepath.Dir(path)); innerWant == rel || !ok || err != nil {
+				return innerFile, innerWant, true, nil
+			}
+		}
+	}
+	return file, want, ok, err
+}
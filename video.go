@@ -0,0 +1,489 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Video is what a video file's container says about it, which templates
+// use as {{.Video.Duration}} and so on. It is all zero for other files.
+type Video struct {
+	Duration time.Duration
+	Width    int    // in pixels
+	Height   int    // in pixels
+	Codec    string // of the first video track: h264, hevc, av1, vp9, vp8, mpeg4, prores, ... or the codec's own code
+}
+
+// Resolution names the video's resolution by its shorter side, so that
+// portrait videos count the same: "8K", "4K", "1440p", "1080p", "720p" or
+// "SD", or "" without a video track.
+func (v Video) Resolution() string {
+	lines := v.lines()
+	switch {
+	case lines == 0:
+		return ""
+	case lines >= 4320:
+		return "8K"
+	case lines >= 2160:
+		return "4K"
+	case lines >= 1440:
+		return "1440p"
+	case lines >= 1080:
+		return "1080p"
+	case lines >= 720:
+		return "720p"
+	}
+	return "SD"
+}
+
+// lines returns the shorter side of the video, in pixels.
+func (v Video) lines() int {
+	return min(v.Width, v.Height)
+}
+
+// Resolution is a video resolution in a rule, as the number of pixels of
+// the shorter side: "4K" or "8K", "1080p" or "1080", or "HD" for 720p.
+type Resolution int
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (r *Resolution) UnmarshalText(text []byte) error {
+	s := strings.ToLower(strings.TrimSpace(string(text)))
+	switch s {
+	case "8k":
+		*r = 4320
+	case "4k", "uhd":
+		*r = 2160
+	case "fullhd", "full hd", "fhd":
+		*r = 1080
+	case "hd":
+		*r = 720
+	default:
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "p"))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid resolution %q (e.g. 4K, 1080p or 720p)", text)
+		}
+		*r = Resolution(n)
+	}
+	return nil
+}
+
+func (r Resolution) String() string {
+	switch r {
+	case 4320:
+		return "8K"
+	case 2160:
+		return "4K"
+	}
+	return strconv.Itoa(int(r)) + "p"
+}
+
+// Video returns what the file's container says about the video in it.
+func (f File) Video() Video {
+	return readMeta(f, "video", func(path string) any {
+		if path == "" {
+			return Video{}
+		}
+		v, _ := probeVideo(path)
+		return v
+	}).(Video)
+}
+
+// errNoVideo is returned for files that are not videos in a container
+// probeVideo reads.
+var errNoVideo = errors.New("not a video")
+
+// probeVideo reads the container of the video at path: MP4, MOV and the
+// like, Matroska and WebM, or AVI.
+func probeVideo(path string) (Video, error) {
+	f, err := os.Open(longPath(path))
+	if err != nil {
+		return Video{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Video{}, err
+	}
+	var head [12]byte
+	if _, err := f.ReadAt(head[:], 0); err != nil {
+		return Video{}, errNoVideo
+	}
+	switch {
+	case string(head[4:8]) == "ftyp" || string(head[4:8]) == "moov" || string(head[4:8]) == "wide" || string(head[4:8]) == "mdat":
+		return probeMP4(f, info.Size())
+	case binary.BigEndian.Uint32(head[:4]) == ebmlHeader:
+		return probeMatroska(f, info.Size())
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI ":
+		return probeAVI(f, info.Size())
+	}
+	return Video{}, errNoVideo
+}
+
+// mp4Boxes calls fn for each box of an MP4 file between start and end, with
+// the extent of its contents.
+func mp4Boxes(r io.ReaderAt, start, end int64, fn func(typ string, start, end int64) error) error {
+	var header [16]byte
+	for pos := start; pos+8 <= end; {
+		if _, err := r.ReadAt(header[:8], pos); err != nil {
+			return err
+		}
+		size, typ, body := int64(binary.BigEndian.Uint32(header[:4])), string(header[4:8]), pos+8
+		switch size {
+		case 0:
+			size = end - pos // To the end.
+		case 1:
+			if _, err := r.ReadAt(header[8:16], pos+8); err != nil {
+				return err
+			}
+			size, body = int64(binary.BigEndian.Uint64(header[8:16])), pos+16
+		}
+		if size < body-pos || pos+size > end {
+			return errors.New("malformed MP4 box")
+		}
+		if err := fn(typ, body, pos+size); err != nil {
+			return err
+		}
+		pos += size
+	}
+	return nil
+}
+
+// mp4Codecs maps MP4 sample entry formats to codec names.
+var mp4Codecs = map[string]string{
+	"avc1": "h264", "avc3": "h264", "hvc1": "hevc", "hev1": "hevc", "av01": "av1",
+	"vp09": "vp9", "vp08": "vp8", "mp4v": "mpeg4", "jpeg": "mjpeg",
+	"apch": "prores", "apcn": "prores", "apcs": "prores", "apco": "prores", "ap4h": "prores", "ap4x": "prores",
+}
+
+// probeMP4 reads the movie header and the first video track of an MP4 or
+// QuickTime file.
+func probeMP4(r io.ReaderAt, size int64) (Video, error) {
+	var v Video
+	found := false
+	read := func(b []byte, at int64) bool {
+		_, err := r.ReadAt(b, at)
+		return err == nil
+	}
+	err := mp4Boxes(r, 0, size, func(typ string, start, end int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		found = true
+		return mp4Boxes(r, start, end, func(typ string, start, end int64) error {
+			switch typ {
+			case "mvhd":
+				var b [32]byte
+				if !read(b[:min(int64(len(b)), end-start)], start) {
+					return nil
+				}
+				var scale, duration uint64
+				if b[0] == 1 { // 64-bit times
+					scale, duration = uint64(binary.BigEndian.Uint32(b[20:24])), binary.BigEndian.Uint64(b[24:32])
+				} else {
+					scale, duration = uint64(binary.BigEndian.Uint32(b[12:16])), uint64(binary.BigEndian.Uint32(b[16:20]))
+				}
+				if scale > 0 {
+					v.Duration = time.Duration(float64(duration) / float64(scale) * float64(time.Second))
+				}
+			case "trak":
+				if v.Codec != "" {
+					return nil // Only the first video track counts.
+				}
+				var width, height int
+				var handler, format string
+				mp4Boxes(r, start, end, func(typ string, start, end int64) error {
+					switch typ {
+					case "tkhd":
+						var b [96]byte
+						if !read(b[:min(int64(len(b)), end-start)], start) {
+							return nil
+						}
+						at := 76
+						if b[0] == 1 {
+							at = 88
+						}
+						width = int(binary.BigEndian.Uint32(b[at:]) >> 16)
+						height = int(binary.BigEndian.Uint32(b[at+4:]) >> 16)
+					case "mdia":
+						return mp4Boxes(r, start, end, func(typ string, start, end int64) error {
+							switch typ {
+							case "hdlr":
+								var b [12]byte
+								if read(b[:], start) {
+									handler = string(b[8:12])
+								}
+							case "minf":
+								return mp4Boxes(r, start, end, func(typ string, start, end int64) error {
+									if typ != "stbl" {
+										return nil
+									}
+									return mp4Boxes(r, start, end, func(typ string, start, end int64) error {
+										var b [16]byte
+										if typ == "stsd" && read(b[:], start) {
+											format = string(b[12:16])
+										}
+										return nil
+									})
+								})
+							}
+							return nil
+						})
+					}
+					return nil
+				})
+				if handler == "vide" {
+					v.Width, v.Height = width, height
+					v.Codec = mp4Codecs[format]
+					if v.Codec == "" {
+						v.Codec = strings.ToLower(strings.TrimSpace(format))
+					}
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil && !found {
+		return Video{}, err
+	}
+	if !found || v.Codec == "" {
+		return Video{}, errNoVideo
+	}
+	return v, nil
+}
+
+// Matroska element IDs and values read by probeMatroska.
+const (
+	ebmlHeader          = 0x1A45DFA3
+	mkvSegment          = 0x18538067
+	mkvInfo             = 0x1549A966
+	mkvTimestampScale   = 0x2AD7B1
+	mkvDuration         = 0x4489
+	mkvTracks           = 0x1654AE6B
+	mkvTrackEntry       = 0xAE
+	mkvTrackType        = 0x83
+	mkvCodecID          = 0x86
+	mkvVideo            = 0xE0
+	mkvPixelWidth       = 0xB0
+	mkvPixelHeight      = 0xBA
+	mkvCluster          = 0x1F43B675
+	mkvUnknownSize      = -1
+	mkvTrackTypeVideo   = 1
+	mkvDefaultTimescale = 1000000
+)
+
+// mkvCodecs maps Matroska codec IDs to codec names.
+var mkvCodecs = map[string]string{
+	"V_MPEG4/ISO/AVC": "h264", "V_MPEGH/ISO/HEVC": "hevc", "V_AV1": "av1", "V_VP9": "vp9", "V_VP8": "vp8",
+	"V_MPEG4/ISO/ASP": "mpeg4", "V_MPEG4/ISO/SP": "mpeg4", "V_MJPEG": "mjpeg", "V_PRORES": "prores", "V_THEORA": "theora",
+}
+
+// ebmlReader reads the EBML elements of a Matroska or WebM file.
+type ebmlReader struct {
+	r io.ReaderAt
+}
+
+// vint reads a variable-length integer at pos, returning it and its
+// length. Element IDs keep their length marker; sizes with all value bits
+// set are returned as mkvUnknownSize.
+func (e ebmlReader) vint(pos int64, id bool) (value int64, n int, err error) {
+	var b [8]byte
+	if _, err := e.r.ReadAt(b[:1], pos); err != nil {
+		return 0, 0, err
+	}
+	n = 1
+	for mask := byte(0x80); n <= 8 && b[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if n > 8 {
+		return 0, 0, errors.New("malformed EBML")
+	}
+	if _, err := e.r.ReadAt(b[:n], pos); err != nil {
+		return 0, 0, err
+	}
+	if !id {
+		b[0] &= 0xFF >> n
+	}
+	for _, c := range b[:n] {
+		value = value<<8 | int64(c)
+	}
+	if !id && value == 1<<(7*n)-1 {
+		return mkvUnknownSize, n, nil
+	}
+	return value, n, nil
+}
+
+// elements calls fn for each element between start and end, with the
+// extent of its data. fn returns false to stop.
+func (e ebmlReader) elements(start, end int64, fn func(id, start, end int64) bool) error {
+	for pos := start; pos < end; {
+		id, n, err := e.vint(pos, true)
+		if err != nil {
+			return err
+		}
+		size, m, err := e.vint(pos+int64(n), false)
+		if err != nil {
+			return err
+		}
+		body := pos + int64(n+m)
+		stop := end
+		if size != mkvUnknownSize {
+			stop = body + size
+		}
+		if stop > end || stop < body {
+			return errors.New("malformed EBML element")
+		}
+		if !fn(id, body, stop) {
+			return nil
+		}
+		pos = stop
+	}
+	return nil
+}
+
+// uint reads the unsigned integer element data between start and end.
+func (e ebmlReader) uint(start, end int64) int64 {
+	b := make([]byte, min(end-start, 8))
+	if _, err := e.r.ReadAt(b, start); err != nil {
+		return 0
+	}
+	var v int64
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+// probeMatroska reads the segment info and the first video track of a
+// Matroska or WebM file.
+func probeMatroska(r io.ReaderAt, size int64) (Video, error) {
+	e := ebmlReader{r: r}
+	var v Video
+	scale, duration := int64(mkvDefaultTimescale), 0.0
+	err := e.elements(0, size, func(id, start, end int64) bool {
+		if id != mkvSegment {
+			return true
+		}
+		e.elements(start, end, func(id, start, end int64) bool {
+			switch id {
+			case mkvInfo:
+				e.elements(start, end, func(id, start, end int64) bool {
+					switch id {
+					case mkvTimestampScale:
+						scale = e.uint(start, end)
+					case mkvDuration:
+						b := make([]byte, end-start)
+						if _, err := r.ReadAt(b, start); err == nil && len(b) == 8 {
+							duration = math.Float64frombits(binary.BigEndian.Uint64(b))
+						} else if err == nil && len(b) == 4 {
+							duration = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+						}
+					}
+					return true
+				})
+			case mkvTracks:
+				e.elements(start, end, func(id, start, end int64) bool {
+					if id != mkvTrackEntry || v.Codec != "" {
+						return true
+					}
+					var typ int64
+					var codec string
+					var width, height int
+					e.elements(start, end, func(id, start, end int64) bool {
+						switch id {
+						case mkvTrackType:
+							typ = e.uint(start, end)
+						case mkvCodecID:
+							b := make([]byte, min(end-start, 64))
+							if _, err := r.ReadAt(b, start); err == nil {
+								codec = strings.TrimRight(string(b), "\x00")
+							}
+						case mkvVideo:
+							e.elements(start, end, func(id, start, end int64) bool {
+								switch id {
+								case mkvPixelWidth:
+									width = int(e.uint(start, end))
+								case mkvPixelHeight:
+									height = int(e.uint(start, end))
+								}
+								return true
+							})
+						}
+						return true
+					})
+					if typ == mkvTrackTypeVideo {
+						v.Width, v.Height = width, height
+						if v.Codec = mkvCodecs[codec]; v.Codec == "" {
+							v.Codec = strings.ToLower(strings.TrimPrefix(codec, "V_"))
+						}
+					}
+					return true
+				})
+			case mkvCluster:
+				return false // The media data; the headers come before it.
+			}
+			return true
+		})
+		return false
+	})
+	if err != nil {
+		return Video{}, err
+	}
+	if v.Codec == "" {
+		return Video{}, errNoVideo
+	}
+	v.Duration = time.Duration(duration * float64(scale))
+	return v, nil
+}
+
+// aviCodecs maps AVI stream handlers to codec names.
+var aviCodecs = map[string]string{
+	"h264": "h264", "x264": "h264", "avc1": "h264", "hevc": "hevc", "h265": "hevc",
+	"xvid": "mpeg4", "divx": "mpeg4", "dx50": "mpeg4", "fmp4": "mpeg4", "mjpg": "mjpeg",
+}
+
+// probeAVI reads the main header and the first video stream header of an
+// AVI file.
+func probeAVI(r io.ReaderAt, size int64) (Video, error) {
+	head := make([]byte, min(size, 64<<10))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return Video{}, err
+	}
+	var v Video
+	if i := strings.Index(string(head), "avih"); i >= 0 && i+48 <= len(head) {
+		avih := head[i+8:]
+		usPerFrame := binary.LittleEndian.Uint32(avih[0:])
+		frames := binary.LittleEndian.Uint32(avih[16:])
+		v.Duration = time.Duration(usPerFrame) * time.Duration(frames) * time.Microsecond
+		v.Width = int(binary.LittleEndian.Uint32(avih[32:]))
+		v.Height = int(binary.LittleEndian.Uint32(avih[36:]))
+	}
+	for i := 0; ; {
+		at := strings.Index(string(head[i:]), "strh")
+		if at < 0 {
+			break
+		}
+		at += i
+		if at+16 > len(head) {
+			break
+		}
+		if string(head[at+8:at+12]) == "vids" {
+			handler := strings.ToLower(strings.TrimRight(string(head[at+12:at+16]), "\x00 "))
+			if v.Codec = aviCodecs[handler]; v.Codec == "" {
+				v.Codec = handler
+			}
+			break
+		}
+		i = at + 4
+	}
+	if v.Codec == "" {
+		return Video{}, errNoVideo
+	}
+	return v, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runWatch organizes dirs every interval until interrupted. The config is
+// reloaded on SIGHUP or when a config file changes; the new config is only
+// installed if it loads and validates, otherwise the previous one stays in
+// effect. Reloads happen between passes, never while files are moving.
+func runWatch(dirs []string, presets string, opts ScanOptions, dryRun bool, interval time.Duration, cfg *Config, reload func() (*Config, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	stamps := configStamps(cfg, dirs)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Printf("👀 Watching %s every %v (SIGHUP reloads the config)\n", strings.Join(dirs, ", "), interval)
+	for {
+		organizeDirs(cfg, presets, dirs, opts, dryRun)
+
+		select {
+		case <-stop:
+			fmt.Println("Stopping watch.")
+			return
+		case <-hup:
+			cfg, stamps = reloadConfig(cfg, dirs, reload, "SIGHUP")
+		case <-ticker.C:
+			if current := configStamps(cfg, dirs); !sameStamps(current, stamps) {
+				cfg, stamps = reloadConfig(cfg, dirs, reload, "config change")
+			}
+		}
+	}
+}
+
+// reloadConfig loads a fresh config, keeping the old one if it fails.
+func reloadConfig(old *Config, dirs []string, reload func() (*Config, error), why string) (*Config, map[string]time.Time) {
+	cfg, err := reload()
+	if err != nil {
+		fmt.Printf("❌ Config reload (%s) failed, keeping previous config: %v\n", why, err)
+		// Don't retry the same broken files on every tick.
+		return old, configStamps(old, dirs)
+	}
+	fmt.Printf("🔄 Reloaded config (%s)\n", why)
+	return cfg, configStamps(cfg, dirs)
+}
+
+// configStamps records the modification times of every file the config
+// was built from. Missing files are recorded with a zero time.
+func configStamps(cfg *Config, dirs []string) map[string]time.Time {
+	var paths []string
+	for _, dir := range dirs {
+		paths = append(paths, filepath.Join(dir, localConfigName), filepath.Join(dir, ignoreFileName))
+	}
+	if cfg.Source != "" {
+		paths = append(paths, cfg.Source)
+	}
+	stamps := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = info.ModTime()
+		} else {
+			stamps[path] = time.Time{}
+		}
+	}
+	return stamps
+}
+
+func sameStamps(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, t := range a {
+		if !b[path].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webdavStore is a destination on a WebDAV server such as Nextcloud, given
+// as davs://user@host/path for HTTPS or dav:// for plain HTTP. The password
+// is read from ORGANIZER_WEBDAV_PASSWORD rather than the URL, which ends up
+// in the journal; one in the URL is used but never shown.
+type webdavStore struct {
+	scheme, host   string
+	user, password string
+}
+
+func newWebDAVStore(u *url.URL) (remoteStore, error) {
+	s := &webdavStore{scheme: strings.ToLower(u.Scheme), host: u.Host, user: u.User.Username()}
+	if password, ok := u.User.Password(); ok {
+		s.password = password
+	} else {
+		s.password = os.Getenv(envName("webdav-password"))
+	}
+	return s, nil
+}
+
+func (s *webdavStore) url(p string) string {
+	u := url.URL{Scheme: s.scheme, Host: s.host, Path: p}
+	if s.user != "" {
+		u.User = url.User(s.user)
+	}
+	return u.String()
+}
+
+// httpURL returns the HTTP URL of the path p.
+func (s *webdavStore) httpURL(p string) string {
+	u := url.URL{Scheme: "https", Host: s.host, Path: p}
+	if s.scheme == "dav" {
+		u.Scheme = "http"
+	}
+	return u.String()
+}
+
+// do sends a request for the path p and returns the response if it
+// succeeded. A missing file is reported as fs.ErrNotExist.
+func (s *webdavStore) do(method, p string, header http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.httpURL(p), body)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := body.(*sizedReader); ok {
+		req.ContentLength = r.size
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fs.ErrNotExist
+	}
+	return nil, fmt.Errorf("%s %s: %s", method, s.url(p), resp.Status)
+}
+
+// davProps is the answer to a PROPFIND for a single resource.
+type davProps struct {
+	Responses []struct {
+		Propstat []struct {
+			Prop struct {
+				Length       string `xml:"DAV: getcontentlength"`
+				LastModified string `xml:"DAV: getlastmodified"`
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const davPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:getcontentlength/><d:getlastmodified/><d:resourcetype/></d:prop></d:propfind>`
+
+// stat asks for p's size, modification time, to the second, and whether it
+// is a collection.
+func (s *webdavStore) stat(p string) (remoteInfo, error) {
+	header := http.Header{"Depth": {"0"}, "Content-Type": {"application/xml"}}
+	resp, err := s.do("PROPFIND", p, header, strings.NewReader(davPropfind))
+	if err != nil {
+		return remoteInfo{}, err
+	}
+	defer resp.Body.Close()
+	var props davProps
+	if err := xml.NewDecoder(resp.Body).Decode(&props); err != nil {
+		return remoteInfo{}, fmt.Errorf("PROPFIND %s: %v", s.url(p), err)
+	}
+	for _, r := range props.Responses {
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			info := remoteInfo{dir: ps.Prop.ResourceType.Collection != nil, precision: time.Second}
+			info.size, _ = strconv.ParseInt(ps.Prop.Length, 10, 64)
+			info.modTime, _ = http.ParseTime(ps.Prop.LastModified)
+			return info, nil
+		}
+	}
+	return remoteInfo{}, fmt.Errorf("PROPFIND %s: no properties returned", s.url(p))
+}
+
+// mkdirAll creates each missing collection down to dir.
+func (s *webdavStore) mkdirAll(dir string) error {
+	if info, err := s.stat(dir); err == nil {
+		if !info.dir {
+			return fmt.Errorf("%s is not a folder", s.url(dir))
+		}
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if parent := path.Dir(dir); parent != dir {
+		if err := s.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	resp, err := s.do("MKCOL", dir+"/", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// upload puts the file at a hidden partial path next to p and moves it into
+// place once complete, so an interrupted upload never looks finished. The
+// modification time is passed along as X-OC-Mtime, which Nextcloud and
+// ownCloud keep.
+func (s *webdavStore) upload(local, p string) error {
+	f, err := os.Open(longPath(local))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	part := path.Join(path.Dir(p), "."+path.Base(p)+".part")
+	header := http.Header{"X-Oc-Mtime": {strconv.FormatInt(info.ModTime().Unix(), 10)}}
+	counted := &countingReader{r: throttle(f)}
+	t := startTransfer(filepath.Base(local), info.Size(), counted.n.Load)
+	defer t.finish()
+	resp, err := s.do(http.MethodPut, part, header, &sizedReader{counted, info.Size()})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	header = http.Header{"Destination": {s.httpURL(p)}, "Overwrite": {"T"}}
+	resp, err = s.do("MOVE", part, header, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sizedReader is a reader of known size, so requests carry a
+// Content-Length rather than being chunked, which some servers refuse.
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+func (s *webdavStore) download(p, local string) (err error) {
+	resp, err := s.do(http.MethodGet, p, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	tmp := filepath.Join(filepath.Dir(local), "."+filepath.Base(local)+".organizer-tmp")
+	f, err := os.Create(longPath(tmp))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(longPath(tmp))
+		}
+	}()
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(longPath(tmp), t, t)
+	}
+	return os.Rename(longPath(tmp), longPath(local))
+}
+
+func (s *webdavStore) remove(p string) error {
+	resp, err := s.do(http.MethodDelete, p, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
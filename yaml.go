@@ -0,0 +1,570 @@
+package main
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// This file implements the small YAML subset used by the config file:
+// block mappings, block sequences, flow sequences/mappings ([a, b] and
+// {a: b}), quoted and plain scalars, and # comments. Anchors, tags and
+// multi-line block scalars are not supported.
+
+// yamlLine is a single non-blank, comment-stripped line of YAML input.
+type yamlLine struct {
+	num    int    // 1-based line number, for error messages
+	indent int    // number of leading spaces
+	text   string // content after the indentation
+}
+
+// yamlScalar is a plain or quoted scalar kept as text until it is decoded
+// into a concrete Go type.
+type yamlScalar struct {
+	value  string
+	quoted bool
+}
+
+// parseYAML parses data into a tree of map[string]any, []any, yamlScalar
+// and nil values.
+func parseYAML(data []byte) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		if strings.Contains(raw, "\t") && strings.TrimLeft(raw, " ") != strings.TrimLeft(raw, " \t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		text := stripYAMLComment(raw)
+		if strings.TrimSpace(text) == "" || strings.TrimSpace(text) == "---" {
+			continue
+		}
+		trimmed := strings.TrimLeft(text, " ")
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " ")})
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+	p := &yamlParser{lines: lines}
+	node, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return node, nil
+}
+
+// stripYAMLComment removes a trailing # comment that is not inside quotes.
+func stripYAMLComment(s string) string {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseBlock parses the mapping or sequence starting at the current line,
+// whose entries are all at the given indentation.
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	line := p.lines[p.pos]
+	if isYAMLSeqItem(line.text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	seq := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		if !isYAMLSeqItem(line.text) {
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				item, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				seq = append(seq, item)
+			} else {
+				seq = append(seq, nil)
+			}
+			continue
+		}
+		if _, _, ok := splitYAMLKey(rest); ok || isYAMLSeqItem(rest) {
+			// "- key: value" starts a nested block; re-read the remainder of
+			// the line as if it were indented to where its content begins.
+			childIndent := indent + (len(line.text) - len(rest))
+			p.lines[p.pos] = yamlLine{num: line.num, indent: childIndent, text: rest}
+			item, err := p.parseBlock(childIndent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, item)
+			continue
+		}
+		item, err := parseYAMLFlow(rest, line.num)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, item)
+		p.pos++
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		if isYAMLSeqItem(line.text) {
+			break
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+		if rest != "" {
+			value, err := parseYAMLFlow(rest, line.num)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+			continue
+		}
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			// A sequence may sit at the same indentation as its key.
+			if next.indent > indent || (next.indent == indent && isYAMLSeqItem(next.text)) {
+				value, err := p.parseBlock(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = value
+				continue
+			}
+		}
+		m[key] = nil
+	}
+	return m, nil
+}
+
+// splitYAMLKey splits "key: rest" into its parts. Keys may be quoted.
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		after := text[end+2:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false
+		}
+		unq, err := unquoteYAML(text[:end+2])
+		if err != nil {
+			return "", "", false
+		}
+		return unq, strings.TrimSpace(strings.TrimPrefix(after, ":")), true
+	}
+	idx := strings.Index(text, ": ")
+	if idx < 0 {
+		if strings.HasSuffix(text, ":") {
+			return strings.TrimSpace(text[:len(text)-1]), "", true
+		}
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+2:]), true
+}
+
+// parseYAMLFlow parses an inline value: a scalar, [a, b] or {a: b}.
+func parseYAMLFlow(text string, num int) (any, error) {
+	f := &yamlFlow{s: text, num: num}
+	v, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	f.skipSpace()
+	if f.i < len(f.s) {
+		return nil, fmt.Errorf("line %d: unexpected %q", num, f.s[f.i:])
+	}
+	return v, nil
+}
+
+type yamlFlow struct {
+	s   string
+	i   int
+	num int
+	// depth > 0 while inside [ ] or { }, where , ] } end plain scalars.
+	depth int
+}
+
+func (f *yamlFlow) skipSpace() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) value() (any, error) {
+	f.skipSpace()
+	if f.i >= len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.i] {
+	case '[':
+		f.i++
+		f.depth++
+		seq := []any{}
+		for {
+			f.skipSpace()
+			if f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				f.depth--
+				return seq, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			f.skipSpace()
+			if f.i < len(f.s) && f.s[f.i] == ',' {
+				f.i++
+				continue
+			}
+			if f.i < len(f.s) && f.s[f.i] == ']' {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: unterminated flow sequence", f.num)
+		}
+	case '{':
+		f.i++
+		f.depth++
+		m := map[string]any{}
+		for {
+			f.skipSpace()
+			if f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				f.depth--
+				return m, nil
+			}
+			k, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(yamlScalar)
+			if !ok || f.i >= len(f.s) || f.s[f.i] != ':' {
+				return nil, fmt.Errorf("line %d: expected key in flow mapping", f.num)
+			}
+			f.i++
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			m[key.value] = v
+			f.skipSpace()
+			if f.i < len(f.s) && f.s[f.i] == ',' {
+				f.i++
+				continue
+			}
+			if f.i < len(f.s) && f.s[f.i] == '}' {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: unterminated flow mapping", f.num)
+		}
+	case '"', '\'':
+		q := f.s[f.i]
+		j := f.i + 1
+		for j < len(f.s) {
+			if q == '"' && f.s[j] == '\\' {
+				j += 2
+				continue
+			}
+			if f.s[j] == q {
+				if q == '\'' && j+1 < len(f.s) && f.s[j+1] == '\'' {
+					j += 2
+					continue
+				}
+				break
+			}
+			j++
+		}
+		if j >= len(f.s) {
+			return nil, fmt.Errorf("line %d: unterminated string", f.num)
+		}
+		s, err := unquoteYAML(f.s[f.i : j+1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", f.num, err)
+		}
+		f.i = j + 1
+		return yamlScalar{value: s, quoted: true}, nil
+	}
+	start := f.i
+	for f.i < len(f.s) {
+		c := f.s[f.i]
+		if f.depth > 0 && (c == ',' || c == ']' || c == '}') {
+			break
+		}
+		if f.depth > 0 && c == ':' && (f.i+1 == len(f.s) || f.s[f.i+1] == ' ') {
+			break
+		}
+		f.i++
+	}
+	plain := strings.TrimSpace(f.s[start:f.i])
+	if plain == "~" || plain == "null" {
+		return nil, nil
+	}
+	return yamlScalar{value: plain}, nil
+}
+
+// unquoteYAML removes the quotes from a single- or double-quoted scalar.
+func unquoteYAML(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(s)
+}
+
+// decodeYAML stores the parsed YAML tree in the value pointed to by out.
+// Struct fields are matched by their `yaml` tag, falling back to the
+// lower-cased field name.
+func decodeYAML(node any, out any) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("decodeYAML: need a non-nil pointer, got %T", out)
+	}
+	return decodeYAMLValue(node, v.Elem(), "")
+}
+
+// yamlUnmarshaler is implemented by types that decode themselves from a
+// parsed YAML node.
+type yamlUnmarshaler interface {
+	UnmarshalYAML(node any) error
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	yamlUnmarshalerType = reflect.TypeOf((*yamlUnmarshaler)(nil)).Elem()
+)
+
+func decodeYAMLValue(node any, v reflect.Value, path string) error {
+	where := func() string {
+		if path == "" {
+			return "config"
+		}
+		return path
+	}
+	if node == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(yamlUnmarshalerType) {
+		if err := v.Addr().Interface().(yamlUnmarshaler).UnmarshalYAML(node); err != nil {
+			return fmt.Errorf("%s: %v", where(), err)
+		}
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		s, ok := node.(yamlScalar)
+		if !ok {
+			return fmt.Errorf("%s: expected a scalar value", where())
+		}
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s.value)); err != nil {
+			return fmt.Errorf("%s: %v", where(), err)
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeYAMLValue(node, elem.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(plainYAML(node)))
+		return nil
+	case reflect.Struct:
+		m, ok := node.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected a mapping", where())
+		}
+		fields := yamlFields(v.Type())
+		for key, child := range m {
+			idx, ok := fields[key]
+			if !ok {
+				return fmt.Errorf("%s: unknown field %q", where(), key)
+			}
+			if err := decodeYAMLValue(child, v.Field(idx), joinYAMLPath(path, key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		m, ok := node.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected a mapping", where())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for key, child := range m {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := decodeYAMLValue(child, elem, joinYAMLPath(path, key)); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Slice:
+		seq, ok := node.([]any)
+		if !ok {
+			// Allow a single scalar where a list is expected.
+			if _, isScalar := node.(yamlScalar); !isScalar {
+				return fmt.Errorf("%s: expected a list", where())
+			}
+			seq = []any{node}
+		}
+		out := reflect.MakeSlice(v.Type(), len(seq), len(seq))
+		for i, child := range seq {
+			if err := decodeYAMLValue(child, out.Index(i), fmt.Sprintf("%s[%d]", where(), i)); err != nil {
+				return err
+			}
+		}
+		v.Set(out)
+		return nil
+	}
+
+	s, ok := node.(yamlScalar)
+	if !ok {
+		return fmt.Errorf("%s: expected a scalar value", where())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s.value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s.value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", where(), s.value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s.value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", where(), s.value)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s.value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", where(), s.value)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s.value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", where(), s.value)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("%s: unsupported type %s", where(), v.Type())
+	}
+	return nil
+}
+
+// reflectValueOf returns the addressable value that ptr points to.
+func reflectValueOf(ptr any) reflect.Value {
+	return reflect.ValueOf(ptr).Elem()
+}
+
+// yamlFields maps YAML keys to struct field indexes.
+func yamlFields(t reflect.Type) map[string]int {
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+func joinYAMLPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// plainYAML converts a parsed tree into plain Go values (strings instead of
+// yamlScalar) for fields typed as interfaces.
+func plainYAML(node any) any {
+	switch n := node.(type) {
+	case yamlScalar:
+		return n.value
+	case []any:
+		out := make([]any, len(n))
+		for i, c := range n {
+			out[i] = plainYAML(c)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(n))
+		for k, c := range n {
+			out[k] = plainYAML(c)
+		}
+		return out
+	}
+	return node
+}